@@ -0,0 +1,403 @@
+// Package cache wraps a core.Storage with a size-bounded, read-through LRU
+// cache for GetContent.
+//
+// Cached entries are revalidated against the backend with StatFile, by ETag
+// or, when the backend reports none, by last-modified time and size. Writes,
+// copies and deletes made through the wrapper invalidate the affected key;
+// changes made behind its back are picked up by revalidation.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+var (
+	_ core.Storage      = (*Storage)(nil)
+	_ core.Stater       = (*Storage)(nil)
+	_ core.Lister       = (*Storage)(nil)
+	_ core.ObjectReader = (*Storage)(nil)
+	_ core.Binder       = (*Storage)(nil)
+)
+
+// Defaults used for zero Config fields.
+const (
+	DefaultMaxSize       = 64 << 20
+	DefaultMaxObjectSize = 1 << 20
+)
+
+// Config for caching
+type Config struct {
+	// Tier stores cached content. Defaults to NewMemoryTier().
+	Tier Tier
+	// MaxSize bounds the total cached bytes. Defaults to DefaultMaxSize.
+	MaxSize int64
+	// MaxObjectSize is the largest object that gets cached. Defaults to
+	// DefaultMaxObjectSize.
+	MaxObjectSize int64
+	// TTL skips revalidation for entries validated within this long. Zero
+	// revalidates on every read.
+	TTL time.Duration
+}
+
+// Stats cache counters
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+	Size      int64
+}
+
+// entry is one cached object.
+type entry struct {
+	bucketName   string
+	objectName   string
+	size         int64
+	etag         string
+	lastModified time.Time
+	validated    time.Time
+}
+
+// Storage caching wrapper
+type Storage struct {
+	core.Storage
+	tier          Tier
+	maxSize       int64
+	maxObjectSize int64
+	ttl           time.Duration
+	now           func() time.Time
+	opts          core.Options
+	*index
+}
+
+// index of cached entries, shared by the copies With returns.
+type index struct {
+	mu sync.Mutex
+	// keys serialize the tier writes of each object, so its tier content
+	// always matches its entry. Tier I/O never holds mu.
+	keys    [64]sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	stats   Stats
+}
+
+// NewEngine struct
+func NewEngine(next core.Storage, cfg Config) (*Storage, error) {
+	if next == nil {
+		return nil, errors.New("go-storage: cache needs a storage to wrap")
+	}
+	if cfg.Tier == nil {
+		cfg.Tier = NewMemoryTier()
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxSize
+	}
+	if cfg.MaxObjectSize <= 0 {
+		cfg.MaxObjectSize = DefaultMaxObjectSize
+	}
+
+	return &Storage{
+		Storage:       next,
+		tier:          cfg.Tier,
+		maxSize:       cfg.MaxSize,
+		maxObjectSize: cfg.MaxObjectSize,
+		ttl:           cfg.TTL,
+		now:           time.Now,
+		index: &index{
+			lru:     list.New(),
+			entries: map[string]*list.Element{},
+		},
+	}, nil
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() core.Storage {
+	return s.Storage
+}
+
+// With returns a copy of s over the wrapped storage bound to opts, sharing
+// the cache.
+func (s *Storage) With(opts core.Options) (core.Storage, error) {
+	next, err := core.With(s.Storage, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *s
+	c.Storage = next
+	c.opts = s.opts.Merge(opts)
+	return &c, nil
+}
+
+func cacheKey(bucketName, objectName string) string {
+	return bucketName + "/" + objectName
+}
+
+// fresh reports whether info still describes the cached entry.
+func (e *entry) fresh(info *core.ObjectInfo) bool {
+	if e.etag != "" && info.ETag != "" {
+		return e.etag == info.ETag
+	}
+	return e.size == info.Size && e.lastModified.Equal(info.LastModified)
+}
+
+// Stats returns a snapshot of the cache counters.
+func (s *Storage) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Entries = s.lru.Len()
+	return stats
+}
+
+// lookup returns the cached entry for key and whether it needs revalidation.
+func (s *Storage) lookup(key string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	return e, s.ttl <= 0 || s.now().Sub(e.validated) >= s.ttl
+}
+
+// keyLock returns the lock serializing the tier writes of key.
+func (s *Storage) keyLock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &s.keys[h.Sum32()%uint32(len(s.keys))]
+}
+
+// current returns the element of key if it still holds e; the caller holds
+// s.mu.
+func (s *Storage) current(key string, e *entry) (*list.Element, bool) {
+	elem, ok := s.entries[key]
+	return elem, ok && elem.Value.(*entry) == e
+}
+
+// hit loads a cached entry, moving it to the front of the LRU.
+func (s *Storage) hit(key string, e *entry) ([]byte, bool) {
+	s.mu.Lock()
+	_, ok := s.current(key, e)
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	content, err := s.tier.Load(e.bucketName, e.objectName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The entry may have been replaced or dropped while loading.
+	elem, ok := s.current(key, e)
+	if !ok {
+		return nil, false
+	}
+	if err != nil {
+		s.unlink(elem)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	s.stats.Hits++
+	return content, true
+}
+
+// GetContent serves from the cache when the entry is still current and reads
+// through to the backend otherwise.
+func (s *Storage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	// Only current, unencrypted reads are cached: versions are read through,
+	// and so are reads with a bound key, which must not be served to
+	// callers without it or stored in the tier as plaintext.
+	if s.opts.VersionID != "" || s.opts.Encryption != nil {
+		return s.Storage.GetContent(ctx, bucketName, fileName)
+	}
+	key := cacheKey(bucketName, fileName)
+
+	e, revalidate := s.lookup(key)
+	if e != nil && !revalidate {
+		if content, ok := s.hit(key, e); ok {
+			return content, nil
+		}
+	}
+
+	info, err := core.StatFile(ctx, s.Storage, bucketName, fileName)
+	if errors.Is(err, core.ErrNotSupported) {
+		// Entries cannot be revalidated without StatFile.
+		return s.Storage.GetContent(ctx, bucketName, fileName)
+	}
+	if err != nil {
+		s.invalidate(bucketName, fileName)
+		return nil, err
+	}
+	if e != nil && e.fresh(info) {
+		s.mu.Lock()
+		e.validated = s.now()
+		s.mu.Unlock()
+		if content, ok := s.hit(key, e); ok {
+			return content, nil
+		}
+	}
+
+	content, err := s.Storage.GetContent(ctx, bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.stats.Misses++
+	s.mu.Unlock()
+	s.store(bucketName, fileName, content, info)
+	return content, nil
+}
+
+// StatFile returns the object attributes from the wrapped storage.
+func (s *Storage) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	return core.StatFile(ctx, s.Storage, bucketName, fileName)
+}
+
+// ListObjects lists the objects of the wrapped storage.
+func (s *Storage) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	return core.ListObjects(ctx, s.Storage, bucketName, prefix)
+}
+
+// NewReader opens the object on the wrapped storage; streams are not cached.
+func (s *Storage) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	return core.NewReader(ctx, s.Storage, bucketName, fileName)
+}
+
+func (s *Storage) store(bucketName, fileName string, content []byte, info *core.ObjectInfo) {
+	size := int64(len(content))
+	if size > s.maxObjectSize || size > s.maxSize {
+		s.invalidate(bucketName, fileName)
+		return
+	}
+
+	key := cacheKey(bucketName, fileName)
+	lock := s.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := s.tier.Store(bucketName, fileName, content); err != nil {
+		s.drop(key, bucketName, fileName)
+		return
+	}
+
+	s.mu.Lock()
+	// An older entry for key shares the tier content just overwritten.
+	if elem, ok := s.entries[key]; ok {
+		s.unlink(elem)
+	}
+	var evicted []*entry
+	for s.stats.Size+size > s.maxSize && s.lru.Len() > 0 {
+		evicted = append(evicted, s.unlink(s.lru.Back()))
+		s.stats.Evictions++
+	}
+	// The content was read after the stat, so it may be newer than these
+	// validators; the next revalidation then simply refetches it.
+	s.entries[key] = s.lru.PushFront(&entry{
+		bucketName:   bucketName,
+		objectName:   fileName,
+		size:         size,
+		etag:         info.ETag,
+		lastModified: info.LastModified,
+		validated:    s.now(),
+	})
+	s.stats.Size += size
+	s.mu.Unlock()
+
+	// Evicted content is removed without its key lock; if that races a new
+	// store of the key, the entry finds no content and is read through.
+	for _, e := range evicted {
+		_ = s.tier.Remove(e.bucketName, e.objectName)
+	}
+}
+
+// unlink drops an entry from the index, leaving its tier content; the
+// caller holds s.mu.
+func (s *Storage) unlink(elem *list.Element) *entry {
+	e := elem.Value.(*entry)
+	s.lru.Remove(elem)
+	delete(s.entries, cacheKey(e.bucketName, e.objectName))
+	s.stats.Size -= e.size
+	return e
+}
+
+// drop removes the entry and tier content of key; the caller holds its key
+// lock.
+func (s *Storage) drop(key, bucketName, fileName string) {
+	s.mu.Lock()
+	elem, ok := s.entries[key]
+	if ok {
+		s.unlink(elem)
+	}
+	s.mu.Unlock()
+	if ok {
+		_ = s.tier.Remove(bucketName, fileName)
+	}
+}
+
+func (s *Storage) invalidate(bucketName, fileName string) {
+	key := cacheKey(bucketName, fileName)
+	lock := s.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+	s.drop(key, bucketName, fileName)
+}
+
+// UploadFile to storage and invalidate the cached copy.
+func (s *Storage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	defer s.invalidate(bucketName, objectName)
+	return s.Storage.UploadFile(ctx, bucketName, objectName, content, reader)
+}
+
+// ReaderIsBody reports whether the wrapped storage uploads the reader
+// passed to UploadFile.
+func (s *Storage) ReaderIsBody() bool {
+	return core.ReaderIsBody(s.Storage)
+}
+
+// UploadFileByReader to storage and invalidate the cached copy.
+func (s *Storage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	defer s.invalidate(bucketName, objectName)
+	return s.Storage.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+}
+
+// DeleteFile delete file and invalidate the cached copy.
+func (s *Storage) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	defer s.invalidate(bucketName, fileName)
+	return s.Storage.DeleteFile(ctx, bucketName, fileName)
+}
+
+// CopyFile copy src to dest and invalidate the cached destination.
+func (s *Storage) CopyFile(
+	ctx context.Context,
+	srcBucket, srcPath, destBucket, destPath string,
+) error {
+	defer s.invalidate(destBucket, destPath)
+	return s.Storage.CopyFile(ctx, srcBucket, srcPath, destBucket, destPath)
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+	"github.com/appleboy/go-storage/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingDisk counts the reads that reach the backend.
+type countingDisk struct {
+	*disk.Disk
+	gets int
+}
+
+func (c *countingDisk) GetContent(
+	ctx context.Context,
+	bucketName, fileName string,
+) ([]byte, error) {
+	c.gets++
+	return c.Disk.GetContent(ctx, bucketName, fileName)
+}
+
+func newTestEngine(t *testing.T, cfg Config) (*countingDisk, *Storage) {
+	backend := &countingDisk{Disk: disk.NewEngine("", t.TempDir())}
+	s, err := NewEngine(backend, cfg)
+	assert.NoError(t, err)
+	return backend, s
+}
+
+func TestReadThrough(t *testing.T) {
+	for name, tier := range map[string]Tier{
+		"memory": NewMemoryTier(),
+		"disk":   NewDiskTier(t.TempDir()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend, s := newTestEngine(t, Config{Tier: tier})
+			ctx := context.Background()
+			assert.NoError(t, s.UploadFile(ctx, "b", "config.json", []byte(`{"a":1}`), nil))
+
+			for i := 0; i < 3; i++ {
+				content, err := s.GetContent(ctx, "b", "config.json")
+				assert.NoError(t, err)
+				assert.Equal(t, `{"a":1}`, string(content))
+			}
+			assert.Equal(t, 1, backend.gets)
+			stats := s.Stats()
+			assert.Equal(t, int64(2), stats.Hits)
+			assert.Equal(t, int64(1), stats.Misses)
+			assert.Equal(t, int64(7), stats.Size)
+
+			// Writes through the wrapper invalidate the entry.
+			assert.NoError(t, s.UploadFile(ctx, "b", "config.json", []byte(`{"a":2}`), nil))
+			content, err := s.GetContent(ctx, "b", "config.json")
+			assert.NoError(t, err)
+			assert.Equal(t, `{"a":2}`, string(content))
+			assert.Equal(t, 2, backend.gets)
+		})
+	}
+}
+
+func TestRevalidatesChangesBehindTheCache(t *testing.T) {
+	backend, s := newTestEngine(t, Config{})
+	ctx := context.Background()
+	assert.NoError(t, backend.UploadFile(ctx, "b", "a.txt", []byte("old"), nil))
+
+	_, err := s.GetContent(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+
+	// Written straight to the backend; the size change fails revalidation.
+	assert.NoError(t, backend.UploadFile(ctx, "b", "a.txt", []byte("newer"), nil))
+	content, err := s.GetContent(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "newer", string(content))
+
+	// Deleted behind the cache: the stat fails and the entry is dropped.
+	assert.NoError(t, backend.DeleteFile(ctx, "b", "a.txt"))
+	_, err = s.GetContent(ctx, "b", "a.txt")
+	assert.Error(t, err)
+	assert.Equal(t, 0, s.Stats().Entries)
+}
+
+func TestTTLSkipsRevalidation(t *testing.T) {
+	backend, s := newTestEngine(t, Config{TTL: time.Minute})
+	ctx := context.Background()
+	assert.NoError(t, backend.UploadFile(ctx, "b", "a.txt", []byte("old"), nil))
+
+	_, err := s.GetContent(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, backend.UploadFile(ctx, "b", "a.txt", []byte("newer"), nil))
+
+	content, err := s.GetContent(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	content, err = s.GetContent(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "newer", string(content))
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	_, s := newTestEngine(t, Config{MaxSize: 10, MaxObjectSize: 4})
+	ctx := context.Background()
+	for _, name := range []string{"a", "b", "c"} {
+		assert.NoError(t, s.UploadFile(ctx, "b", name, []byte("1234"), nil))
+	}
+	assert.NoError(t, s.UploadFile(ctx, "b", "big", []byte("12345"), nil))
+
+	for _, name := range []string{"a", "b", "a", "c", "big"} {
+		_, err := s.GetContent(ctx, "b", name)
+		assert.NoError(t, err)
+	}
+
+	stats := s.Stats()
+	// "big" exceeds MaxObjectSize and "b" was evicted to make room for "c".
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, int64(8), stats.Size)
+	_, cached := s.entries[cacheKey("b", "a")]
+	assert.True(t, cached)
+	_, cached = s.entries[cacheKey("b", "b")]
+	assert.False(t, cached)
+}
+
+func TestFreshByETag(t *testing.T) {
+	e := &entry{etag: "abc", size: 1}
+	assert.True(t, e.fresh(&core.ObjectInfo{ETag: "abc", Size: 2}))
+	assert.False(t, e.fresh(&core.ObjectInfo{ETag: "def", Size: 1}))
+}
+
+func TestEncryptedReadsAreNotCached(t *testing.T) {
+	backend, s := newTestEngine(t, Config{TTL: time.Minute})
+	ctx := context.Background()
+	assert.NoError(t, backend.UploadFile(ctx, "b", "a.txt", []byte("secret"), nil))
+
+	bound, err := s.With(core.Options{Encryption: &core.Encryption{
+		Type:        core.EncryptionCustomer,
+		CustomerKey: bytes.Repeat([]byte{1}, core.CustomerKeySize),
+	}})
+	assert.NoError(t, err)
+	content, err := bound.GetContent(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(content))
+	assert.Equal(t, 0, s.Stats().Entries)
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	// The memory engine, unlike disk, takes concurrent writes to one key.
+	s, err := NewEngine(memory.NewEngine(""), Config{MaxSize: 16, MaxObjectSize: 8})
+	assert.NoError(t, err)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("%d.txt", i%3)
+			for range 20 {
+				assert.NoError(t, s.UploadFile(ctx, "b", name, []byte(name), nil))
+				content, err := s.GetContent(ctx, "b", name)
+				assert.NoError(t, err)
+				assert.Equal(t, name, string(content))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, s.Stats().Size, int64(16))
+}
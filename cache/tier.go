@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+
+	"github.com/appleboy/go-storage/disk"
+)
+
+// Tier holds cached object content. Size accounting and eviction are done
+// by the cache; a tier only stores and returns bytes.
+type Tier interface {
+	Load(bucketName, objectName string) ([]byte, error)
+	Store(bucketName, objectName string, content []byte) error
+	Remove(bucketName, objectName string) error
+}
+
+// memoryTier keeps content in a map.
+type memoryTier struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemoryTier keeps cached content in process memory.
+func NewMemoryTier() Tier {
+	return &memoryTier{objects: map[string][]byte{}}
+}
+
+func (m *memoryTier) Load(bucketName, objectName string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.objects[bucketName+"/"+objectName]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	// Callers own the returned slice; never hand out the cached one.
+	return bytes.Clone(content), nil
+}
+
+func (m *memoryTier) Store(bucketName, objectName string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[bucketName+"/"+objectName] = bytes.Clone(content)
+	return nil
+}
+
+func (m *memoryTier) Remove(bucketName, objectName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, bucketName+"/"+objectName)
+	return nil
+}
+
+// diskTier stores content with the disk driver, so the cache directory has
+// the same <dir>/<bucket>/<object> layout as a disk engine.
+type diskTier struct {
+	engine *disk.Disk
+}
+
+// NewDiskTier keeps cached content under dir. The cache index lives in
+// memory, so files left by a previous process are overwritten as needed
+// rather than served.
+func NewDiskTier(dir string) Tier {
+	return &diskTier{engine: disk.NewEngine("", dir)}
+}
+
+func (d *diskTier) Load(bucketName, objectName string) ([]byte, error) {
+	return d.engine.GetContent(context.Background(), bucketName, objectName)
+}
+
+func (d *diskTier) Store(bucketName, objectName string, content []byte) error {
+	return d.engine.UploadFileByReader(
+		context.Background(),
+		bucketName,
+		objectName,
+		bytes.NewReader(content),
+		"",
+		int64(len(content)),
+	)
+}
+
+func (d *diskTier) Remove(bucketName, objectName string) error {
+	err := d.engine.DeleteFile(context.Background(), bucketName, objectName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
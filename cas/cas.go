@@ -0,0 +1,263 @@
+// Package cas is a content-addressable, deduplicating object store on top of
+// any core.Storage.
+//
+// Blobs are stored once under their SHA-256 hash. A manifest object maps
+// logical keys to blob hashes and keeps a reference count per blob, so
+// uploading the same content under many keys costs a single blob. Deleting a
+// key only drops a reference; GC removes blobs nobody references anymore.
+//
+// The manifest is updated with read-modify-write under a process-local lock,
+// so a bucket/prefix must only be written by one Store at a time.
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+var (
+	// ErrNotFound is returned for a logical key that is not in the manifest.
+	ErrNotFound = errors.New("cas: key not found")
+	// ErrHashMismatch is returned when a blob no longer matches its hash.
+	ErrHashMismatch = errors.New("cas: blob hash mismatch")
+)
+
+// DefaultPrefix under which the manifest and blobs are stored.
+const DefaultPrefix = "cas"
+
+const manifestName = "manifest.json"
+
+// manifest persisted state
+type manifest struct {
+	// Keys maps a logical key to its blob hash.
+	Keys map[string]string `json:"keys"`
+	// Refs counts the logical keys pointing at each blob hash.
+	Refs map[string]int `json:"refs"`
+}
+
+// Store content-addressable store
+type Store struct {
+	storage core.Storage
+	bucket  string
+	prefix  string
+	mu      sync.Mutex
+}
+
+// NewStore struct. An empty prefix uses DefaultPrefix.
+func NewStore(storage core.Storage, bucket, prefix string) *Store {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Store{
+		storage: storage,
+		bucket:  bucket,
+		prefix:  prefix,
+	}
+}
+
+// blobPath fans blobs out by the first two hex digits to keep directories
+// small on the disk driver.
+func (s *Store) blobPath(hash string) string {
+	return path.Join(s.prefix, "blobs", hash[:2], hash)
+}
+
+func (s *Store) manifestPath() string {
+	return path.Join(s.prefix, manifestName)
+}
+
+// load reads the manifest. Only a missing manifest starts an empty one: any
+// other failure is returned, or the next save would drop every key.
+func (s *Store) load(ctx context.Context) (*manifest, error) {
+	m := &manifest{
+		Keys: map[string]string{},
+		Refs: map[string]int{},
+	}
+	content, err := s.storage.GetContent(ctx, s.bucket, s.manifestPath())
+	if core.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cas: load manifest: %w", err)
+	}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("cas: decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+func (s *Store) save(ctx context.Context, m *manifest) error {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.storage.UploadFileByReader(
+		ctx,
+		s.bucket,
+		s.manifestPath(),
+		bytes.NewReader(content),
+		"application/json",
+		int64(len(content)),
+	)
+}
+
+// Hash returns the hex SHA-256 of content, the name its blob is stored under.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores content under key and returns its blob hash. The blob is only
+// uploaded when no other key already references the same content, and is
+// removed again when the manifest cannot be saved.
+func (s *Store) Put(ctx context.Context, key string, content []byte) (string, error) {
+	hash := Hash(content)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	if old, ok := m.Keys[key]; ok && old == hash {
+		return hash, nil
+	}
+
+	// Refs may hold a zero count for a blob awaiting GC; it is still stored.
+	_, known := m.Refs[hash]
+	uploaded := false
+	if !known || !s.storage.FileExist(ctx, s.bucket, s.blobPath(hash)) {
+		if err := s.storage.UploadFileByReader(
+			ctx,
+			s.bucket,
+			s.blobPath(hash),
+			bytes.NewReader(content),
+			core.DetectContentType(content),
+			int64(len(content)),
+		); err != nil {
+			return "", err
+		}
+		uploaded = !known
+	}
+
+	if old, ok := m.Keys[key]; ok {
+		m.Refs[old]--
+	}
+	m.Keys[key] = hash
+	m.Refs[hash]++
+
+	if err := s.save(ctx, m); err != nil {
+		// The blob is in no saved manifest, so GC would never find it.
+		if uploaded {
+			if delErr := s.storage.DeleteFile(ctx, s.bucket, s.blobPath(hash)); delErr != nil {
+				return "", errors.Join(err, delErr)
+			}
+		}
+		return "", err
+	}
+	return hash, nil
+}
+
+// Get returns the content stored under key, verifying it against its hash.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	m, err := s.load(ctx)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok := m.Keys[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	content, err := s.storage.GetContent(ctx, s.bucket, s.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if Hash(content) != hash {
+		return nil, fmt.Errorf("%w: %s", ErrHashMismatch, key)
+	}
+	return content, nil
+}
+
+// Stat returns the blob hash stored under key.
+func (s *Store) Stat(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	hash, ok := m.Keys[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return hash, nil
+}
+
+// Delete drops key and its reference to the blob. The blob itself is removed
+// by the next GC once no key references it.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	hash, ok := m.Keys[key]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.Keys, key)
+	m.Refs[hash]--
+
+	return s.save(ctx, m)
+}
+
+// GC deletes every blob with no references and returns their hashes.
+func (s *Store) GC(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for hash, refs := range m.Refs {
+		if refs > 0 {
+			continue
+		}
+		if s.storage.FileExist(ctx, s.bucket, s.blobPath(hash)) {
+			if err := s.storage.DeleteFile(ctx, s.bucket, s.blobPath(hash)); err != nil {
+				// Persist what was collected so far before bailing out.
+				if saveErr := s.save(ctx, m); saveErr != nil {
+					return removed, errors.Join(err, saveErr)
+				}
+				return removed, err
+			}
+		}
+		delete(m.Refs, hash)
+		removed = append(removed, hash)
+	}
+	sort.Strings(removed)
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, s.save(ctx, m)
+}
@@ -0,0 +1,151 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutDeduplicates(t *testing.T) {
+	engine := disk.NewEngine("", t.TempDir())
+	s := NewStore(engine, "attachments", "")
+	ctx := context.Background()
+
+	content := []byte("same attachment")
+	h1, err := s.Put(ctx, "user1/report.pdf", content)
+	assert.NoError(t, err)
+	h2, err := s.Put(ctx, "user2/copy.pdf", content)
+	assert.NoError(t, err)
+	assert.Equal(t, h1, h2)
+	assert.Equal(t, Hash(content), h1)
+
+	m, err := s.load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.Refs[h1])
+
+	got, err := s.Get(ctx, "user2/copy.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	_, err = s.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestDeleteAndGC(t *testing.T) {
+	engine := disk.NewEngine("", t.TempDir())
+	s := NewStore(engine, "attachments", "")
+	ctx := context.Background()
+
+	shared, err := s.Put(ctx, "a", []byte("shared"))
+	assert.NoError(t, err)
+	_, err = s.Put(ctx, "b", []byte("shared"))
+	assert.NoError(t, err)
+	single, err := s.Put(ctx, "c", []byte("single"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Delete(ctx, "a"))
+	assert.NoError(t, s.Delete(ctx, "c"))
+	assert.True(t, errors.Is(s.Delete(ctx, "c"), ErrNotFound))
+
+	removed, err := s.GC(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{single}, removed)
+	assert.False(t, engine.FileExist(ctx, "attachments", s.blobPath(single)))
+	assert.True(t, engine.FileExist(ctx, "attachments", s.blobPath(shared)))
+
+	// Overwriting a key moves its reference to the new blob.
+	_, err = s.Put(ctx, "b", []byte("replaced"))
+	assert.NoError(t, err)
+	removed, err = s.GC(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{shared}, removed)
+}
+
+func TestGetVerifiesHash(t *testing.T) {
+	engine := disk.NewEngine("", t.TempDir())
+	s := NewStore(engine, "attachments", "")
+	ctx := context.Background()
+
+	hash, err := s.Put(ctx, "a", []byte("original"))
+	assert.NoError(t, err)
+
+	// Corrupt the blob behind the store's back.
+	err = os.WriteFile(engine.FilePath("attachments", s.blobPath(hash)), []byte("tampered"), 0o600)
+	assert.NoError(t, err)
+
+	_, err = s.Get(ctx, "a")
+	assert.True(t, errors.Is(err, ErrHashMismatch))
+}
+
+var errFlaky = errors.New("flaky backend")
+
+// flaky is a disk engine whose manifest reads or writes can be made to fail.
+type flaky struct {
+	*disk.Disk
+	failRead  bool
+	failWrite bool
+}
+
+func (f *flaky) FileExist(ctx context.Context, bucketName, fileName string) bool {
+	if f.failRead {
+		return false
+	}
+	return f.Disk.FileExist(ctx, bucketName, fileName)
+}
+
+func (f *flaky) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	if f.failRead {
+		return nil, errFlaky
+	}
+	return f.Disk.GetContent(ctx, bucketName, fileName)
+}
+
+func (f *flaky) UploadFileByReader(
+	ctx context.Context,
+	bucketName, fileName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	if f.failWrite && path.Base(fileName) == manifestName {
+		return errFlaky
+	}
+	return f.Disk.UploadFileByReader(ctx, bucketName, fileName, reader, contentType, length)
+}
+
+func TestFailingStorageKeepsManifest(t *testing.T) {
+	engine := &flaky{Disk: disk.NewEngine("", t.TempDir())}
+	s := NewStore(engine, "attachments", "")
+	ctx := context.Background()
+
+	_, err := s.Put(ctx, "a", []byte("a"))
+	assert.NoError(t, err)
+
+	// A failed read is not an empty manifest.
+	engine.failRead = true
+	_, err = s.Put(ctx, "b", []byte("b"))
+	assert.ErrorIs(t, err, errFlaky)
+	assert.ErrorIs(t, s.Delete(ctx, "a"), errFlaky)
+	_, err = s.GC(ctx)
+	assert.ErrorIs(t, err, errFlaky)
+	engine.failRead = false
+	got, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(got))
+
+	// A failed save rolls the new blob back.
+	engine.failWrite = true
+	_, err = s.Put(ctx, "c", []byte("c"))
+	assert.ErrorIs(t, err, errFlaky)
+	assert.False(t, engine.FileExist(ctx, "attachments", s.blobPath(Hash([]byte("c")))))
+	engine.failWrite = false
+	_, err = s.Stat(ctx, "c")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
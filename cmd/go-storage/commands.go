@@ -0,0 +1,1062 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+	"github.com/appleboy/go-storage/transfer"
+
+	gcsstorage "cloud.google.com/go/storage"
+	"github.com/minio/minio-go/v7"
+)
+
+// remoteScheme marks a remote path in commands that also take local ones.
+const remoteScheme = "storage://"
+
+func isRemote(arg string) bool {
+	return strings.HasPrefix(arg, remoteScheme)
+}
+
+// parseRemote splits "storage://bucket/key" or "bucket/key".
+func parseRemote(arg string) (bucketName, key string, err error) {
+	bucketName, key, _ = strings.Cut(strings.TrimPrefix(arg, remoteScheme), "/")
+	if bucketName == "" {
+		return "", "", fmt.Errorf("missing bucket in %q", arg)
+	}
+	return bucketName, key, nil
+}
+
+// parseArgs parses a command's flags and checks its argument count.
+func parseArgs(fs *flag.FlagSet, args []string, want int, usage string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go-storage", usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != want {
+		fs.Usage()
+		return nil, errors.New("usage: go-storage " + usage)
+	}
+	return fs.Args(), nil
+}
+
+// newFlagSet returns a command's flag set, printing usage and flag errors
+// to output.
+func newFlagSet(name string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	return fs
+}
+
+// listEntry is an object, or a common prefix when listing one level.
+type listEntry struct {
+	Prefix string `json:"prefix,omitempty"`
+	*core.ObjectInfo
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("ls", a.stderr)
+	recursive := fs.Bool("r", false, "list every object under the prefix")
+	args, err := parseArgs(fs, args, 1, "ls [-r] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, prefix, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	objects, err := core.ListObjects(ctx, a.engine, bucketName, prefix)
+	if err != nil {
+		return err
+	}
+
+	entries := []listEntry{}
+	seen := map[string]bool{}
+	for i := range objects {
+		obj := &objects[i]
+		rest := strings.TrimPrefix(obj.Name, prefix)
+		if dir, _, nested := strings.Cut(rest, "/"); nested && !*recursive {
+			if p := prefix + dir + "/"; !seen[p] {
+				seen[p] = true
+				entries = append(entries, listEntry{Prefix: p})
+			}
+			continue
+		}
+		entries = append(entries, listEntry{ObjectInfo: obj})
+	}
+
+	return a.print(entries, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, e := range entries {
+			if e.ObjectInfo == nil {
+				fmt.Fprintf(tw, "DIR\t\t%s\t\n", e.Prefix)
+				continue
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t\n",
+				e.Size, e.LastModified.Format(time.DateTime), e.Name)
+		}
+		_ = tw.Flush()
+	})
+}
+
+// versionFlag adds -version to a command acting on one object.
+func versionFlag(fs *flag.FlagSet) *string {
+	return fs.String("version", "", "act on this version of the object")
+}
+
+// with returns the engine bound to the options set by flags such as
+// -version.
+func (a *app) with(opts core.Options) (core.Storage, error) {
+	return core.With(a.engine, opts)
+}
+
+func runStat(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("stat", a.stderr)
+	versionID := versionFlag(fs)
+	args, err := parseArgs(fs, args, 1, "stat [-version id] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, key, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	engine, err := a.with(core.Options{VersionID: *versionID})
+	if err != nil {
+		return err
+	}
+	info, err := core.StatFile(ctx, engine, bucketName, key)
+	if err != nil {
+		return err
+	}
+	return a.print(info, func(w io.Writer) {
+		fmt.Fprintf(w, "Name:          %s/%s\n", info.Bucket, info.Name)
+		if info.VersionID != "" {
+			fmt.Fprintf(w, "Version:       %s\n", info.VersionID)
+		}
+		fmt.Fprintf(w, "Size:          %d\n", info.Size)
+		fmt.Fprintf(w, "Content-Type:  %s\n", info.ContentType)
+		fmt.Fprintf(w, "ETag:          %s\n", info.ETag)
+		fmt.Fprintf(w, "Last-Modified: %s\n", info.LastModified.Format(time.RFC3339))
+		for k, v := range info.Metadata {
+			fmt.Fprintf(w, "Metadata:      %s=%s\n", k, v)
+		}
+	})
+}
+
+// operation is one object moved or removed by cp, mv or rm.
+type operation struct {
+	Action      string `json:"action"`
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+}
+
+func (a *app) printOperations(ops []operation) error {
+	return a.print(ops, func(w io.Writer) {
+		for _, op := range ops {
+			if op.Destination == "" {
+				fmt.Fprintf(w, "%s: %s\n", op.Action, op.Source)
+				continue
+			}
+			fmt.Fprintf(w, "%s: %s -> %s\n", op.Action, op.Source, op.Destination)
+		}
+	})
+}
+
+func remoteName(bucketName, key string) string {
+	return remoteScheme + bucketName + "/" + key
+}
+
+// pair is a source and destination of one copy.
+type pair struct {
+	src, dst string
+}
+
+// expand lists the files or objects a copy covers. With recursive set the
+// source is a directory or prefix, and each entry keeps its path below it.
+func (a *app) expand(ctx context.Context, src, dst string, recursive bool) ([]pair, error) {
+	if !recursive {
+		return []pair{{src, target(dst, path.Base(filepath.ToSlash(src)))}}, nil
+	}
+
+	var rels []string
+	if isRemote(src) {
+		bucketName, prefix, err := parseRemote(src)
+		if err != nil {
+			return nil, err
+		}
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		src = remoteName(bucketName, prefix)
+		objects, err := core.ListObjects(ctx, a.engine, bucketName, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			rels = append(rels, strings.TrimPrefix(obj.Name, prefix))
+		}
+	} else {
+		err := filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(src, name)
+			rels = append(rels, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pairs := make([]pair, 0, len(rels))
+	for _, rel := range rels {
+		pairs = append(pairs, pair{join(src, rel), join(dst, rel)})
+	}
+	return pairs, nil
+}
+
+// target appends base to a destination naming a directory: a remote path
+// that is only a bucket or ends in "/", or an existing local directory.
+func target(dst, base string) string {
+	if isRemote(dst) {
+		if _, key, _ := parseRemote(dst); key == "" || strings.HasSuffix(key, "/") {
+			return strings.TrimSuffix(dst, "/") + "/" + base
+		}
+		return dst
+	}
+	if st, err := os.Stat(dst); err == nil && st.IsDir() {
+		return filepath.Join(dst, base)
+	}
+	return dst
+}
+
+// join appends a slash-separated relative path to a local or remote path.
+func join(base, rel string) string {
+	if isRemote(base) {
+		return strings.TrimSuffix(base, "/") + "/" + rel
+	}
+	return filepath.Join(base, filepath.FromSlash(rel))
+}
+
+func (a *app) copyOne(ctx context.Context, src, dst string) error {
+	switch {
+	case isRemote(src) && isRemote(dst):
+		srcBucket, srcKey, err := parseRemote(src)
+		if err != nil {
+			return err
+		}
+		dstBucket, dstKey, err := parseRemote(dst)
+		if err != nil {
+			return err
+		}
+		return a.engine.CopyFile(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	case isRemote(src):
+		bucketName, key, err := parseRemote(src)
+		if err != nil {
+			return err
+		}
+		return a.engine.DownloadFile(ctx, bucketName, key, dst)
+	case isRemote(dst):
+		bucketName, key, err := parseRemote(dst)
+		if err != nil {
+			return err
+		}
+		return a.upload(ctx, src, bucketName, key)
+	default:
+		return errors.New("one of source or destination must be a " + remoteScheme + " path")
+	}
+}
+
+func (a *app) upload(ctx context.Context, name, bucketName, key string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	st, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	contentType := core.DetectContentType(head[:n])
+	return a.engine.UploadFileByReader(ctx, bucketName, key, file, contentType, st.Size())
+}
+
+func (a *app) remove(ctx context.Context, name string) error {
+	if !isRemote(name) {
+		return os.Remove(name)
+	}
+	bucketName, key, err := parseRemote(name)
+	if err != nil {
+		return err
+	}
+	return a.engine.DeleteFile(ctx, bucketName, key)
+}
+
+func (a *app) copyAll(ctx context.Context, name string, args []string, move bool) error {
+	fs := newFlagSet(name, a.stderr)
+	recursive := fs.Bool("r", false, "copy every file or object under the source")
+	args, err := parseArgs(fs, args, 2, name+" [-r] <src> <dst>")
+	if err != nil {
+		return err
+	}
+	pairs, err := a.expand(ctx, args[0], args[1], *recursive)
+	if err != nil {
+		return err
+	}
+
+	action := "copied"
+	if move {
+		action = "moved"
+	}
+	ops := make([]operation, 0, len(pairs))
+	for _, p := range pairs {
+		err := a.copyOne(ctx, p.src, p.dst)
+		if err == nil && move {
+			err = a.remove(ctx, p.src)
+		}
+		if err != nil {
+			_ = a.printOperations(ops)
+			return fmt.Errorf("%s: %w", p.src, err)
+		}
+		ops = append(ops, operation{Action: action, Source: p.src, Destination: p.dst})
+	}
+	return a.printOperations(ops)
+}
+
+func runCopy(ctx context.Context, a *app, args []string) error {
+	return a.copyAll(ctx, "cp", args, false)
+}
+
+func runMove(ctx context.Context, a *app, args []string) error {
+	return a.copyAll(ctx, "mv", args, true)
+}
+
+func runRemove(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("rm", a.stderr)
+	recursive := fs.Bool("r", false, "remove every object under the prefix")
+	versionID := fs.String("version", "", "remove this version of the object for good")
+	bypass := bypassFlag(fs)
+	args, err := parseArgs(fs, args, 1, "rm [-r] [-version id] [-bypass-governance] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, key, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	if !*recursive && key == "" {
+		return errors.New("rm needs an object key, or -r to remove a prefix")
+	}
+	if *recursive && *versionID != "" {
+		return errors.New("rm: -version removes one object, it cannot be used with -r")
+	}
+	engine, err := a.with(core.Options{VersionID: *versionID, GovernanceBypass: *bypass})
+	if err != nil {
+		return err
+	}
+	if *recursive {
+		// "logs" removes logs/..., never a sibling such as logs-archive/....
+		if key != "" && !strings.HasSuffix(key, "/") {
+			key += "/"
+		}
+		objects, err := core.ListObjects(ctx, engine, bucketName, key)
+		if err != nil {
+			return err
+		}
+		keys = keys[:0]
+		for _, obj := range objects {
+			keys = append(keys, obj.Name)
+		}
+	}
+
+	ops := make([]operation, 0, len(keys))
+	for _, k := range keys {
+		if err := engine.DeleteFile(ctx, bucketName, k); err != nil {
+			_ = a.printOperations(ops)
+			return fmt.Errorf("%s: %w", remoteName(bucketName, k), err)
+		}
+		ops = append(ops, operation{Action: "removed", Source: remoteName(bucketName, k)})
+	}
+	return a.printOperations(ops)
+}
+
+func runCat(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("cat", a.stderr)
+	versionID := versionFlag(fs)
+	args, err := parseArgs(fs, args, 1, "cat [-version id] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, key, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	engine, err := a.with(core.Options{VersionID: *versionID})
+	if err != nil {
+		return err
+	}
+	content, err := engine.GetContent(ctx, bucketName, key)
+	if err != nil {
+		return err
+	}
+	_, err = a.stdout.Write(content)
+	return err
+}
+
+func runSign(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("sign", a.stderr)
+	expiry := fs.Duration("expiry", 15*time.Minute, "how long the URL stays valid")
+	filename := fs.String("filename", "", "file name offered to the browser")
+	inline := fs.Bool("inline", false, "let the browser display the file instead of saving it")
+	contentType := fs.String("content-type", "", "override the response Content-Type")
+	cacheControl := fs.String("cache-control", "", "override the response Cache-Control")
+	versionID := fs.String("version", "", "sign an older version of the object")
+	args, err := parseArgs(fs, args, 1, "sign [-expiry 15m] [-filename name] [-inline] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, key, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	signed, err := a.engine.SignedURL(ctx, bucketName, key, &core.SignedURLOptions{
+		Expiry:          *expiry,
+		DefaultFilename: *filename,
+		Inline:          *inline,
+		ContentType:     *contentType,
+		CacheControl:    *cacheControl,
+		VersionID:       *versionID,
+	})
+	if err != nil {
+		return err
+	}
+	out := struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{signed, time.Now().Add(*expiry).UTC()}
+	return a.print(out, func(w io.Writer) { fmt.Fprintln(w, signed) })
+}
+
+func runMakeBucket(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("mb", a.stderr)
+	region := fs.String("region", a.cfg.Region, "bucket region")
+	lock := fs.Bool("lock", false, "create the bucket with object lock")
+	args, err := parseArgs(fs, args, 1, "mb [-region r] [-lock] <bucket>")
+	if err != nil {
+		return err
+	}
+	bucketName, _, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	engine, err := a.with(core.Options{ObjectLock: *lock})
+	if err != nil {
+		return err
+	}
+	if err := engine.CreateBucket(ctx, bucketName, *region); err != nil {
+		return err
+	}
+	return a.printOperations([]operation{{Action: "created", Source: bucketName}})
+}
+
+func runRemoveBucket(ctx context.Context, a *app, args []string) error {
+	args, err := parseArgs(newFlagSet("rb", a.stderr), args, 1, "rb <bucket>")
+	if err != nil {
+		return err
+	}
+	bucketName, _, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	if err := a.removeBucket(ctx, bucketName); err != nil {
+		return err
+	}
+	return a.printOperations([]operation{{Action: "removed", Source: bucketName}})
+}
+
+// removeBucket deletes an empty bucket. core.Storage has no call for it, so
+// it goes through the driver's client.
+func (a *app) removeBucket(ctx context.Context, bucketName string) error {
+	switch client := a.engine.Client().(type) {
+	case *minio.Client:
+		return client.RemoveBucket(ctx, bucketName)
+	case *gcsstorage.Client:
+		return client.Bucket(bucketName).Delete(ctx)
+	default:
+		if d, ok := a.engine.(*disk.Disk); ok {
+			return d.RemoveBucket(ctx, bucketName)
+		}
+		return fmt.Errorf("rb is not supported by the %s driver", a.cfg.Driver)
+	}
+}
+
+func runLifecycle(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: go-storage lifecycle set|get|delete|apply ...")
+	}
+	switch args[0] {
+	case "set":
+		fs := newFlagSet("lifecycle set", a.stderr)
+		id := fs.String("id", "", "rule ID; without it -days and -prefix set the default rule")
+		days := fs.Int("days", 0, "expire objects after this many days")
+		prefix := fs.String("prefix", "", "only apply to objects under this prefix")
+		var tags patterns
+		fs.Var(&tags, "tag", "only apply to objects with this key=value tag, repeatable")
+		transitionDays := fs.Int("transition-days", 0, "transition to -storage-class after n days")
+		storageClass := fs.String("storage-class", "", "storage class to transition objects to")
+		noncurrentDays := fs.Int("noncurrent-days", 0, "expire old versions n days after replaced")
+		abortDays := fs.Int("abort-days", 0, "abort unfinished uploads after n days")
+		disabled := fs.Bool("disabled", false, "store the rule without applying it")
+		rest, err := parseArgs(fs, args[1:], 1, "lifecycle set [flags] <bucket>")
+		if err != nil {
+			return err
+		}
+		bucketName, _, err := parseRemote(rest[0])
+		if err != nil {
+			return err
+		}
+		cfg := &core.LifecycleConfig{Days: *days, Prefix: *prefix}
+		if *id != "" {
+			rule := core.LifecycleRule{
+				ID:                        *id,
+				Disabled:                  *disabled,
+				Prefix:                    *prefix,
+				ExpirationDays:            *days,
+				NoncurrentExpirationDays:  *noncurrentDays,
+				AbortIncompleteUploadDays: *abortDays,
+			}
+			for _, tag := range tags {
+				key, value, ok := strings.Cut(tag, "=")
+				if !ok {
+					return fmt.Errorf("invalid -tag %q, want key=value", tag)
+				}
+				if rule.Tags == nil {
+					rule.Tags = map[string]string{}
+				}
+				rule.Tags[key] = value
+			}
+			if *storageClass != "" {
+				rule.Transition = &core.LifecycleTransition{
+					Days:         *transitionDays,
+					StorageClass: *storageClass,
+				}
+			}
+			cfg = &core.LifecycleConfig{Rules: []core.LifecycleRule{rule}}
+		} else if len(tags) > 0 || *storageClass != "" || *noncurrentDays != 0 ||
+			*abortDays != 0 || *disabled {
+			return errors.New("lifecycle set: rule options need an -id")
+		}
+		return a.engine.SetLifeCycle(ctx, bucketName, cfg)
+	case "get":
+		rest, err := parseArgs(newFlagSet("lifecycle get", a.stderr), args[1:], 1, "lifecycle get <bucket>")
+		if err != nil {
+			return err
+		}
+		bucketName, _, err := parseRemote(rest[0])
+		if err != nil {
+			return err
+		}
+		cfg, err := core.GetLifeCycle(ctx, a.engine, bucketName)
+		if err != nil {
+			return err
+		}
+		rules := cfg.Rules
+		if rules == nil {
+			rules = []core.LifecycleRule{}
+		}
+		return a.print(rules, func(w io.Writer) {
+			for _, r := range rules {
+				fmt.Fprintln(w, formatRule(r))
+			}
+		})
+	case "delete":
+		fs := newFlagSet("lifecycle delete", a.stderr)
+		var ids patterns
+		fs.Var(&ids, "id", "rule ID to delete, repeatable; without it every rule is deleted")
+		rest, err := parseArgs(fs, args[1:], 1, "lifecycle delete [-id id] <bucket>")
+		if err != nil {
+			return err
+		}
+		bucketName, _, err := parseRemote(rest[0])
+		if err != nil {
+			return err
+		}
+		return core.DeleteLifeCycle(ctx, a.engine, bucketName, ids...)
+	case "apply":
+		_, err := parseArgs(newFlagSet("lifecycle apply", a.stderr), args[1:], 0, "lifecycle apply")
+		if err != nil {
+			return err
+		}
+		d, ok := a.engine.(*disk.Disk)
+		if !ok {
+			return fmt.Errorf(
+				"lifecycle apply is only needed by the disk driver; %s expires objects itself",
+				a.cfg.Driver,
+			)
+		}
+		removed, err := d.ApplyLifecycle(ctx)
+		ops := make([]operation, 0, len(removed))
+		for _, o := range removed {
+			source := remoteName(o.Bucket, o.Name)
+			if o.VersionID != "" {
+				source += "?versionId=" + url.QueryEscape(o.VersionID)
+			}
+			ops = append(ops, operation{Action: "expired", Source: source})
+		}
+		return errors.Join(a.printOperations(ops), err)
+	default:
+		return fmt.Errorf("unknown lifecycle command %q", args[0])
+	}
+}
+
+func runVersioning(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: go-storage versioning enable|suspend|status <bucket>")
+	}
+	if !slices.Contains([]string{"enable", "suspend", "status"}, args[0]) {
+		return fmt.Errorf("unknown versioning command %q", args[0])
+	}
+	name := "versioning " + args[0]
+	rest, err := parseArgs(newFlagSet(name, a.stderr), args[1:], 1, name+" <bucket>")
+	if err != nil {
+		return err
+	}
+	bucketName, _, err := parseRemote(rest[0])
+	if err != nil {
+		return err
+	}
+	versioner := core.VersionerOf(a.engine)
+	switch args[0] {
+	case "enable":
+		return versioner.EnableVersioning(ctx, bucketName)
+	case "suspend":
+		return versioner.SuspendVersioning(ctx, bucketName)
+	case "status":
+		status, err := versioner.GetVersioning(ctx, bucketName)
+		if err != nil {
+			return err
+		}
+		if status == core.VersioningOff {
+			status = "Off"
+		}
+		out := struct {
+			Status core.VersioningStatus `json:"status"`
+		}{status}
+		return a.print(out, func(w io.Writer) { fmt.Fprintln(w, status) })
+	}
+	return nil
+}
+
+func runVersions(ctx context.Context, a *app, args []string) error {
+	args, err := parseArgs(newFlagSet("versions", a.stderr), args, 1, "versions <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, prefix, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	versions, err := core.VersionerOf(a.engine).ListObjectVersions(ctx, bucketName, prefix)
+	if err != nil {
+		return err
+	}
+	if versions == nil {
+		versions = []core.ObjectVersion{}
+	}
+	return a.print(versions, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, v := range versions {
+			state := ""
+			switch {
+			case v.DeleteMarker:
+				state = "deleted"
+			case v.IsLatest:
+				state = "latest"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", v.VersionID, state,
+				v.Size, v.LastModified.Format(time.DateTime), v.Name)
+		}
+		_ = tw.Flush()
+	})
+}
+
+func runRestore(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("restore", a.stderr)
+	versionID := fs.String("version", "", "version to make current again")
+	args, err := parseArgs(fs, args, 1, "restore -version id <remote>")
+	if err != nil {
+		return err
+	}
+	if *versionID == "" {
+		return errors.New("restore needs -version")
+	}
+	bucketName, key, err := parseRemote(args[0])
+	if err != nil {
+		return err
+	}
+	if err := storage.Restore(ctx, a.engine, bucketName, key, *versionID); err != nil {
+		return err
+	}
+	return a.printOperations([]operation{{
+		Action: "restored",
+		Source: remoteName(bucketName, key) + "?versionId=" + url.QueryEscape(*versionID),
+	}})
+}
+
+// bypassFlag adds -bypass-governance to a command that may override
+// governance retention.
+func bypassFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("bypass-governance", false, "override governance retention")
+}
+
+// runRetention sets, clears or shows the default retention of a bucket, or
+// the retention of an object when the remote path has a key.
+func runRetention(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: go-storage retention set|clear|get ...")
+	}
+	if !slices.Contains([]string{"set", "clear", "get"}, args[0]) {
+		return fmt.Errorf("unknown retention command %q", args[0])
+	}
+	name := "retention " + args[0]
+	fs := newFlagSet(name, a.stderr)
+	mode := fs.String("mode", "governance", "governance or compliance")
+	days := fs.Int("days", 0, "retain for this many days")
+	years := fs.Int("years", 0, "retain for this many years")
+	until := fs.String("until", "", "retain an object until this RFC 3339 time")
+	versionID := versionFlag(fs)
+	bypass := bypassFlag(fs)
+	rest, err := parseArgs(fs, args[1:], 1, name+" [flags] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, key, err := parseRemote(rest[0])
+	if err != nil {
+		return err
+	}
+	engine, err := a.with(core.Options{VersionID: *versionID, GovernanceBypass: *bypass})
+	if err != nil {
+		return err
+	}
+	locker := core.LockerOf(engine)
+
+	if key == "" {
+		switch args[0] {
+		case "set":
+			if *until != "" {
+				return errors.New("retention set: -until needs an object key")
+			}
+			return locker.SetBucketRetention(ctx, bucketName, &core.BucketRetention{
+				Mode:  core.RetentionMode(strings.ToUpper(*mode)),
+				Days:  *days,
+				Years: *years,
+			})
+		case "clear":
+			return locker.SetBucketRetention(ctx, bucketName, nil)
+		}
+		retention, err := locker.GetBucketRetention(ctx, bucketName)
+		if err != nil {
+			return err
+		}
+		return a.print(retention, func(w io.Writer) {
+			switch {
+			case retention == nil:
+				fmt.Fprintln(w, "none")
+			case retention.Years > 0:
+				fmt.Fprintf(w, "%s\t%d years\n", retention.Mode, retention.Years)
+			default:
+				fmt.Fprintf(w, "%s\t%d days\n", retention.Mode, retention.Days)
+			}
+		})
+	}
+
+	switch args[0] {
+	case "set":
+		retention := &core.ObjectRetention{Mode: core.RetentionMode(strings.ToUpper(*mode))}
+		switch {
+		case *until != "" && (*days != 0 || *years != 0):
+			return errors.New("retention set: use either -until or -days and -years")
+		case *until != "":
+			if retention.RetainUntil, err = time.Parse(time.RFC3339, *until); err != nil {
+				return fmt.Errorf("invalid -until: %w", err)
+			}
+		default:
+			retention.RetainUntil = time.Now().AddDate(*years, 0, *days).UTC()
+		}
+		return locker.SetObjectRetention(ctx, bucketName, key, retention)
+	case "clear":
+		return locker.SetObjectRetention(ctx, bucketName, key, nil)
+	}
+	retention, err := locker.GetObjectRetention(ctx, bucketName, key)
+	if err != nil {
+		return err
+	}
+	return a.print(retention, func(w io.Writer) {
+		if retention == nil {
+			fmt.Fprintln(w, "none")
+			return
+		}
+		fmt.Fprintf(w, "%s\tuntil %s\n", retention.Mode, retention.RetainUntil.Format(time.RFC3339))
+	})
+}
+
+// runHold places, releases or shows the legal hold of an object.
+func runHold(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: go-storage hold on|off|status [-version id] <remote>")
+	}
+	if !slices.Contains([]string{"on", "off", "status"}, args[0]) {
+		return fmt.Errorf("unknown hold command %q", args[0])
+	}
+	name := "hold " + args[0]
+	fs := newFlagSet(name, a.stderr)
+	versionID := versionFlag(fs)
+	rest, err := parseArgs(fs, args[1:], 1, name+" [-version id] <remote>")
+	if err != nil {
+		return err
+	}
+	bucketName, key, err := parseRemote(rest[0])
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New(name + " needs an object key")
+	}
+	engine, err := a.with(core.Options{VersionID: *versionID})
+	if err != nil {
+		return err
+	}
+	locker := core.LockerOf(engine)
+	if args[0] != "status" {
+		return locker.SetLegalHold(ctx, bucketName, key, args[0] == "on")
+	}
+	hold, err := locker.GetLegalHold(ctx, bucketName, key)
+	if err != nil {
+		return err
+	}
+	out := struct {
+		LegalHold bool `json:"legal_hold"`
+	}{hold}
+	return a.print(out, func(w io.Writer) {
+		if hold {
+			fmt.Fprintln(w, "ON")
+			return
+		}
+		fmt.Fprintln(w, "OFF")
+	})
+}
+
+// formatRule renders a lifecycle rule on one line for lifecycle get.
+func formatRule(r core.LifecycleRule) string {
+	fields := []string{r.ID, fmt.Sprintf("prefix=%q", r.Prefix)}
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("tag=%s=%s", k, r.Tags[k]))
+	}
+	if r.ExpirationDays != 0 {
+		fields = append(fields, fmt.Sprintf("days=%d", r.ExpirationDays))
+	}
+	if t := r.Transition; t != nil {
+		fields = append(fields, fmt.Sprintf("transition=%s@%dd", t.StorageClass, t.Days))
+	}
+	if r.NoncurrentExpirationDays != 0 {
+		fields = append(fields, fmt.Sprintf("noncurrent-days=%d", r.NoncurrentExpirationDays))
+	}
+	if r.AbortIncompleteUploadDays != 0 {
+		fields = append(fields, fmt.Sprintf("abort-days=%d", r.AbortIncompleteUploadDays))
+	}
+	if r.Disabled {
+		fields = append(fields, "disabled")
+	}
+	return strings.Join(fields, "\t")
+}
+
+// patterns collects a repeatable flag.
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+func runSync(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("sync", a.stderr)
+	var opts transfer.DirOptions
+	fs.Var((*patterns)(&opts.Include), "include", "only sync files matching this glob, repeatable")
+	fs.Var((*patterns)(&opts.Exclude), "exclude", "skip files matching this glob, repeatable")
+	fs.BoolVar(&opts.Delete, "delete", false, "remove destination files missing from the source")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "list the planned actions without changing anything")
+	fs.IntVar(&opts.Concurrency, "concurrency", transfer.DefaultConcurrency, "files in flight")
+	compare := fs.String("compare", "size", "how to detect changes: size, mtime or checksum")
+	args, err := parseArgs(fs, args, 2, "sync [flags] <src> <dst>")
+	if err != nil {
+		return err
+	}
+	switch *compare {
+	case "size":
+		opts.Compare = transfer.CompareSize
+	case "mtime":
+		opts.Compare = transfer.CompareModTime
+	case "checksum":
+		opts.Compare = transfer.CompareChecksum
+	default:
+		return fmt.Errorf("unknown -compare %q", *compare)
+	}
+
+	src, dst := args[0], args[1]
+	var report *transfer.Report
+	switch {
+	case isRemote(src) && isRemote(dst):
+		report, err = a.syncRemote(ctx, src, dst, opts)
+	case isRemote(src):
+		var bucketName, prefix string
+		if bucketName, prefix, err = parseRemote(src); err == nil {
+			report, err = transfer.SyncDown(ctx, a.engine, bucketName, prefix, dst, opts)
+		}
+	case isRemote(dst):
+		var bucketName, prefix string
+		if bucketName, prefix, err = parseRemote(dst); err == nil {
+			report, err = transfer.SyncUp(ctx, src, a.engine, bucketName, prefix, opts)
+		}
+	default:
+		err = errors.New("one of source or destination must be a " + remoteScheme + " path")
+	}
+	if report != nil {
+		if printErr := a.printReport(report); err == nil {
+			err = printErr
+		}
+	}
+	return err
+}
+
+// syncRemote syncs two prefixes of the configured engine. Include and
+// exclude patterns only apply to directory syncs.
+func (a *app) syncRemote(
+	ctx context.Context,
+	src, dst string,
+	opts transfer.DirOptions,
+) (*transfer.Report, error) {
+	if len(opts.Include) > 0 || len(opts.Exclude) > 0 || opts.DryRun {
+		return nil, errors.New("-include, -exclude and -dry-run need a local side")
+	}
+	srcBucket, srcPrefix, err := parseRemote(src)
+	if err != nil {
+		return nil, err
+	}
+	dstBucket, dstPrefix, err := parseRemote(dst)
+	if err != nil {
+		return nil, err
+	}
+	m, err := transfer.NewManager(a.engine, a.engine, transfer.Config{
+		Concurrency: opts.Concurrency,
+		Delete:      opts.Delete,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.Sync(ctx, transfer.Job{
+		SrcBucket: srcBucket,
+		SrcPrefix: srcPrefix,
+		DstBucket: dstBucket,
+		DstPrefix: dstPrefix,
+	})
+}
+
+// result is a transfer.Result with its error as a string, for JSON.
+type result struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+func results(in []transfer.Result) []result {
+	out := make([]result, 0, len(in))
+	for _, r := range in {
+		res := result{Key: r.Key, Action: string(r.Action), Size: r.Size}
+		if r.Err != nil {
+			res.Error = r.Err.Error()
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+func (a *app) printReport(r *transfer.Report) error {
+	out := struct {
+		Copied   int      `json:"copied"`
+		Skipped  int      `json:"skipped"`
+		Deleted  int      `json:"deleted"`
+		Failed   int      `json:"failed"`
+		Bytes    int64    `json:"bytes"`
+		Duration string   `json:"duration"`
+		DryRun   bool     `json:"dry_run,omitempty"`
+		Planned  []result `json:"planned,omitempty"`
+		Failures []result `json:"failures,omitempty"`
+	}{
+		Copied:   r.Copied,
+		Skipped:  r.Skipped,
+		Deleted:  r.Deleted,
+		Failed:   r.Failed,
+		Bytes:    r.Bytes,
+		Duration: r.Duration.String(),
+		DryRun:   r.DryRun,
+		Planned:  results(r.Planned),
+		Failures: results(r.Failures),
+	}
+	return a.print(out, func(w io.Writer) {
+		for _, p := range r.Planned {
+			if p.Action != transfer.Skipped {
+				fmt.Fprintf(w, "would %s: %s\n", verb(p.Action), p.Key)
+			}
+		}
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "failed: %s: %v\n", f.Key, f.Err)
+		}
+		fmt.Fprintln(w, r.String())
+	})
+}
+
+// verb names a planned action in dry-run output.
+func verb(action transfer.Action) string {
+	if action == transfer.Deleted {
+		return "delete"
+	}
+	return "copy"
+}
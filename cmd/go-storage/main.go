@@ -0,0 +1,287 @@
+// Command go-storage runs everyday bucket operations against any driver
+// supported by storage.NewEngine.
+//
+// The engine is configured from a JSON file holding a storage.Config, then
+// STORAGE_* environment variables, then flags, each overriding the last.
+// Remote paths are written "storage://bucket/key"; commands that only take
+// remote paths also accept a plain "bucket/key".
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+
+	// The drivers the tool can open.
+	_ "github.com/appleboy/go-storage/disk"
+	_ "github.com/appleboy/go-storage/gcs"
+	_ "github.com/appleboy/go-storage/memory"
+	_ "github.com/appleboy/go-storage/minio"
+)
+
+// version is set at build time.
+var version = "dev"
+
+const usage = `Usage: go-storage [flags] <command> [arguments]
+
+Commands:
+  ls [-r] <remote>                 list objects under a bucket or prefix
+  stat [-version id] <remote>      show object attributes
+  cp [-r] <src> <dst>              copy local to remote, remote to local or remote to remote
+  mv [-r] <src> <dst>              copy, then remove the source
+  rm [-r] <remote>                 remove an object, or every object under a prefix
+  rm -version id <remote>          remove one version of an object for good
+  rm -bypass-governance <remote>   remove an object under governance retention
+  cat [-version id] <remote>       write an object to stdout
+  sign [-expiry 15m] <remote>      print a signed download URL
+  mb [-region r] [-lock] <bucket>  make a bucket, with object lock for retention and holds
+  rb <bucket>                      remove an empty bucket
+  lifecycle set [flags] <bucket>   add or replace a rule, see "go-storage lifecycle set -h"
+  lifecycle get <bucket>           list the lifecycle rules
+  lifecycle delete [-id id] <bucket>
+  lifecycle apply                  delete expired objects now (disk driver, for cron)
+  versioning enable|suspend|status <bucket>
+  versions <remote>                list every version of the objects under a prefix
+  restore -version id <remote>     make an older version current again
+  retention set [flags] <remote>   set the default retention of a bucket, or lock an object
+  retention get|clear <remote>     show or remove a bucket or object retention
+  hold on|off|status <remote>      place, release or show the legal hold of an object
+  sync [flags] <src> <dst>         copy new and changed files, see "go-storage sync -h"
+  version                          print the version
+
+Remote paths are written storage://bucket/key.
+
+Flags:
+`
+
+// setting binds one storage.Config field to a flag and an environment
+// variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	str   *string
+	bool  *bool
+}
+
+func settings(cfg *storage.Config) []setting {
+	return []setting{
+		{
+			flag: "driver", env: "STORAGE_DRIVER",
+			usage: "storage driver: disk, s3, gcs or mem", str: &cfg.Driver,
+		},
+		{
+			flag: "endpoint", env: "STORAGE_ENDPOINT",
+			usage: "s3 endpoint, host:port", str: &cfg.Endpoint,
+		},
+		{
+			flag: "access-id", env: "STORAGE_ACCESS_ID",
+			usage: "s3 access key or gcs signer email", str: &cfg.AccessID,
+		},
+		{
+			flag: "secret-key", env: "STORAGE_SECRET_KEY",
+			usage: "s3 secret key, gcs PEM key or disk URL signing key", str: &cfg.SecretKey,
+		},
+		{
+			flag: "ssl", env: "STORAGE_SSL",
+			usage: "use https for s3", bool: &cfg.SSL,
+		},
+		{
+			flag: "insecure", env: "STORAGE_INSECURE_SKIP_VERIFY",
+			usage: "skip TLS certificate verification", bool: &cfg.InsecureSkipVerify,
+		},
+		{
+			flag: "region", env: "STORAGE_REGION",
+			usage: "s3 region", str: &cfg.Region,
+		},
+		{
+			flag: "path", env: "STORAGE_PATH",
+			usage: "disk root directory", str: &cfg.Path,
+		},
+		{
+			flag: "addr", env: "STORAGE_ADDR",
+			usage: "disk public host for file URLs", str: &cfg.Addr,
+		},
+		{
+			flag: "project", env: "STORAGE_PROJECT_ID",
+			usage: "gcs project ID", str: &cfg.ProjectID,
+		},
+	}
+}
+
+func (s setting) set(value string) error {
+	if s.str != nil {
+		*s.str = value
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.env, err)
+	}
+	*s.bool = b
+	return nil
+}
+
+// loadConfig reads the config file, then the environment, then the flags
+// that were set explicitly.
+func loadConfig(
+	path string,
+	getenv func(string) string,
+	fs *flag.FlagSet,
+) (storage.Config, error) {
+	var cfg storage.Config
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(content, &cfg); err != nil {
+			return cfg, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	byFlag := map[string]setting{}
+	for _, s := range settings(&cfg) {
+		byFlag[s.flag] = s
+		if v := getenv(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				return cfg, err
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := byFlag[f.Name]; ok && err == nil {
+			err = s.set(f.Value.String())
+		}
+	})
+	return cfg, err
+}
+
+// app is the state shared by every command.
+type app struct {
+	engine core.Storage
+	cfg    storage.Config
+	stdout io.Writer
+	// stderr receives usage and flag errors.
+	stderr io.Writer
+	json   bool
+}
+
+// print writes v as JSON with -json, or calls text otherwise.
+func (a *app) print(v any, text func(w io.Writer)) error {
+	if !a.json {
+		text(a.stdout)
+		return nil
+	}
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"ls":         runList,
+	"stat":       runStat,
+	"cp":         runCopy,
+	"mv":         runMove,
+	"rm":         runRemove,
+	"cat":        runCat,
+	"sign":       runSign,
+	"mb":         runMakeBucket,
+	"rb":         runRemoveBucket,
+	"lifecycle":  runLifecycle,
+	"versioning": runVersioning,
+	"versions":   runVersions,
+	"restore":    runRestore,
+	"retention":  runRetention,
+	"hold":       runHold,
+	"sync":       runSync,
+}
+
+// run is main without the process exit, so tests can drive it.
+func run(
+	ctx context.Context,
+	args []string,
+	getenv func(string) string,
+	stdout, stderr io.Writer,
+) error {
+	fs := flag.NewFlagSet("go-storage", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var flagCfg storage.Config
+	for _, s := range settings(&flagCfg) {
+		if s.str != nil {
+			fs.StringVar(s.str, s.flag, "", s.usage+" ($"+s.env+")")
+		} else {
+			fs.BoolVar(s.bool, s.flag, false, s.usage+" ($"+s.env+")")
+		}
+	}
+	configPath := fs.String(
+		"config", getenv("STORAGE_CONFIG"), "JSON config file ($STORAGE_CONFIG)",
+	)
+	jsonOutput := fs.Bool("json", false, "print JSON for scripting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	name, rest := fs.Arg(0), fs.Args()[1:]
+	if name == "version" {
+		fmt.Fprintln(stdout, version)
+		return nil
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	cfg, err := loadConfig(*configPath, getenv, fs)
+	if err != nil {
+		return err
+	}
+	engine, err := storage.NewEngine(cfg)
+	if err != nil {
+		return err
+	}
+	return cmd(ctx, &app{
+		engine: engine,
+		cfg:    cfg,
+		stdout: stdout,
+		stderr: stderr,
+		json:   *jsonOutput,
+	}, rest)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	stop()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "go-storage:", strings.TrimPrefix(err.Error(), "go-storage: "))
+		os.Exit(1)
+	}
+}
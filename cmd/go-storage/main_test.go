@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cli runs the command against a disk engine rooted at root.
+func cli(t *testing.T, root string, args ...string) (string, error) {
+	t.Helper()
+	env := map[string]string{"STORAGE_DRIVER": "disk", "STORAGE_PATH": root}
+	var stdout, stderr bytes.Buffer
+	getenv := func(k string) string { return env[k] }
+	err := run(context.Background(), args, getenv, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "storage.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"driver": "s3",
+		"endpoint": "file.example.com",
+		"region": "file-region",
+		"access_id": "file-id"
+	}`), 0o600))
+	env := map[string]string{
+		"STORAGE_ENDPOINT": "env.example.com",
+		"STORAGE_REGION":   "env-region",
+		"STORAGE_SSL":      "true",
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("region", "", "")
+	fs.String("endpoint", "", "")
+	assert.NoError(t, fs.Parse([]string{"-region", "flag-region"}))
+
+	cfg, err := loadConfig(file, func(k string) string { return env[k] }, fs)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3", cfg.Driver)
+	assert.Equal(t, "file-id", cfg.AccessID)
+	assert.Equal(t, "env.example.com", cfg.Endpoint)
+	assert.Equal(t, "flag-region", cfg.Region)
+	assert.True(t, cfg.SSL)
+
+	env["STORAGE_SSL"] = "maybe"
+	_, err = loadConfig("", func(k string) string { return env[k] }, fs)
+	assert.Error(t, err)
+}
+
+func TestParseRemote(t *testing.T) {
+	bucketName, key, err := parseRemote("storage://photos/2024/a.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "photos", bucketName)
+	assert.Equal(t, "2024/a.jpg", key)
+
+	bucketName, key, err = parseRemote("photos")
+	assert.NoError(t, err)
+	assert.Equal(t, "photos", bucketName)
+	assert.Empty(t, key)
+
+	_, _, err = parseRemote("storage:///a.jpg")
+	assert.Error(t, err)
+}
+
+func TestCommands(t *testing.T) {
+	root := t.TempDir()
+	local := t.TempDir()
+	site := filepath.Join(local, "site")
+	assert.NoError(t, os.MkdirAll(filepath.Join(site, "css"), 0o750))
+	assert.NoError(t, os.WriteFile(filepath.Join(site, "index.html"), []byte("<html>"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(site, "css", "a.css"), []byte("body{}"), 0o600))
+
+	_, err := cli(t, root, "mb", "assets")
+	assert.NoError(t, err)
+
+	// cp into a bucket keeps the file name.
+	_, err = cli(t, root, "cp", filepath.Join(site, "index.html"), "storage://assets")
+	assert.NoError(t, err)
+	out, err := cli(t, root, "cat", "assets/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<html>", out)
+
+	_, err = cli(t, root, "cp", "-r", site, "storage://assets/www")
+	assert.NoError(t, err)
+
+	out, err = cli(t, root, "-json", "ls", "assets/www/")
+	assert.NoError(t, err)
+	var entries []map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(out), &entries))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "www/css/", entries[0]["prefix"])
+	assert.Equal(t, "www/index.html", entries[1]["name"])
+
+	out, err = cli(t, root, "ls", "-r", "assets/www/")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "www/css/a.css")
+
+	out, err = cli(t, root, "-json", "stat", "assets/www/css/a.css")
+	assert.NoError(t, err)
+	var info map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(out), &info))
+	assert.Equal(t, float64(6), info["size"])
+
+	download := filepath.Join(t.TempDir(), "a.css")
+	_, err = cli(t, root, "mv", "storage://assets/www/css/a.css", download)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(download)
+	assert.NoError(t, err)
+	assert.Equal(t, "body{}", string(content))
+	_, err = cli(t, root, "stat", "assets/www/css/a.css")
+	assert.Error(t, err)
+
+	out, err = cli(t, root, "rm", "-r", "assets/www/")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed: storage://assets/www/index.html\n", out)
+
+	_, err = cli(t, root, "rm", "assets")
+	assert.Error(t, err)
+}
+
+func TestRemoveKeepsSiblingPrefix(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(t.TempDir(), "a.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("a"), 0o600))
+	_, err := cli(t, root, "cp", file, "storage://logs/logs/a.txt")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "cp", file, "storage://logs/logs-archive/a.txt")
+	assert.NoError(t, err)
+
+	out, err := cli(t, root, "rm", "-r", "storage://logs/logs")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed: storage://logs/logs/a.txt\n", out)
+	_, err = cli(t, root, "stat", "storage://logs/logs-archive/a.txt")
+	assert.NoError(t, err)
+}
+
+func TestSyncCommand(t *testing.T) {
+	root := t.TempDir()
+	local := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(local, "a.txt"), []byte("a"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(local, "b.log"), []byte("b"), 0o600))
+
+	out, err := cli(t, root, "-json", "sync", "-dry-run", "-exclude", "*.log",
+		local, "storage://backup/day1")
+	assert.NoError(t, err)
+	var report struct {
+		Copied  int  `json:"copied"`
+		DryRun  bool `json:"dry_run"`
+		Planned []struct {
+			Key string `json:"key"`
+		} `json:"planned"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, "a.txt", report.Planned[0].Key)
+
+	out, err = cli(t, root, "sync", local, "storage://backup/day1")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "copied 2"))
+
+	out, err = cli(t, root, "sync", "storage://backup/day1", "storage://backup/day2")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "copied 2"))
+
+	_, err = cli(t, root, "sync", "-compare", "fuzzy", local, "storage://backup/day1")
+	assert.Error(t, err)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	_, err := cli(t, t.TempDir(), "frobnicate")
+	assert.Error(t, err)
+
+	out, err := cli(t, t.TempDir(), "version")
+	assert.NoError(t, err)
+	assert.Equal(t, "dev\n", out)
+}
+
+func TestCommandUsageGoesToStderr(t *testing.T) {
+	env := map[string]string{"STORAGE_DRIVER": "disk", "STORAGE_PATH": t.TempDir()}
+	getenv := func(k string) string { return env[k] }
+
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), []string{"ls"}, getenv, &stdout, &stderr)
+	assert.Error(t, err)
+	assert.Contains(t, stderr.String(), "Usage: go-storage ls")
+	assert.Empty(t, stdout.String())
+
+	stderr.Reset()
+	err = run(context.Background(), []string{"ls", "-z", "b"}, getenv, &stdout, &stderr)
+	assert.Error(t, err)
+	assert.Contains(t, stderr.String(), "flag provided but not defined: -z")
+}
+
+func TestLifecycleApply(t *testing.T) {
+	root := t.TempDir()
+	_, err := cli(t, root, "mb", "logs")
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "a.log")
+	assert.NoError(t, os.WriteFile(file, []byte("a"), 0o600))
+	_, err = cli(t, root, "cp", file, "storage://logs/tmp/")
+	assert.NoError(t, err)
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(root, "logs", "tmp", "a.log"), old, old))
+
+	_, err = cli(t, root, "lifecycle", "set", "-days", "1", "-prefix", "tmp/", "logs")
+	assert.NoError(t, err)
+	out, err := cli(t, root, "lifecycle", "apply")
+	assert.NoError(t, err)
+	assert.Equal(t, "expired: storage://logs/tmp/a.log\n", out)
+	out, err = cli(t, root, "lifecycle", "apply")
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+
+	_, err = cli(t, root, "lifecycle", "set", "-id", "uploads", "-abort-days", "2", "logs")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "lifecycle", "set", "-abort-days", "2", "logs")
+	assert.Error(t, err)
+	out, err = cli(t, root, "lifecycle", "get", "logs")
+	assert.NoError(t, err)
+	assert.Equal(t, "logs-lifecycle-rule\tprefix=\"tmp/\"\tdays=1\n"+
+		"uploads\tprefix=\"\"\tabort-days=2\n", out)
+
+	_, err = cli(t, root, "lifecycle", "delete", "-id", "logs-lifecycle-rule", "logs")
+	assert.NoError(t, err)
+	out, err = cli(t, root, "-json", "lifecycle", "get", "logs")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"id":"uploads","abort_incomplete_upload_days":2}]`, out)
+	_, err = cli(t, root, "lifecycle", "delete", "logs")
+	assert.NoError(t, err)
+	out, err = cli(t, root, "-json", "lifecycle", "get", "logs")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[]`, out)
+}
+
+func TestRemoveBucketWithConfig(t *testing.T) {
+	root := t.TempDir()
+	_, err := cli(t, root, "mb", "-lock", "records")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "versioning", "enable", "records")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "lifecycle", "set", "-days", "1", "records")
+	assert.NoError(t, err)
+
+	out, err := cli(t, root, "rb", "records")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed: records\n", out)
+	_, err = os.Stat(filepath.Join(root, "records"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestVersioningCommands(t *testing.T) {
+	root := t.TempDir()
+	_, err := cli(t, root, "mb", "docs")
+	assert.NoError(t, err)
+	out, err := cli(t, root, "versioning", "status", "docs")
+	assert.NoError(t, err)
+	assert.Equal(t, "Off\n", out)
+	_, err = cli(t, root, "versioning", "enable", "docs")
+	assert.NoError(t, err)
+	out, err = cli(t, root, "-json", "versioning", "status", "docs")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"status":"Enabled"}`, out)
+	_, err = cli(t, root, "versioning", "frobnicate", "docs")
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "a.txt")
+	for _, content := range []string{"v1", "v2"} {
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+		_, err = cli(t, root, "cp", file, "storage://docs/a.txt")
+		assert.NoError(t, err)
+	}
+	out, err = cli(t, root, "-json", "versions", "storage://docs/")
+	assert.NoError(t, err)
+	var versions []struct {
+		VersionID string `json:"version_id"`
+		IsLatest  bool   `json:"is_latest"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(out), &versions))
+	assert.Len(t, versions, 2)
+	assert.True(t, versions[0].IsLatest)
+	old := versions[1].VersionID
+
+	out, err = cli(t, root, "cat", "-version", old, "storage://docs/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", out)
+	_, err = cli(t, root, "restore", "storage://docs/a.txt")
+	assert.Error(t, err)
+	out, err = cli(t, root, "restore", "-version", old, "storage://docs/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "restored: storage://docs/a.txt?versionId="+old+"\n", out)
+	out, err = cli(t, root, "cat", "storage://docs/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", out)
+
+	_, err = cli(t, root, "rm", "-r", "-version", old, "storage://docs/")
+	assert.Error(t, err)
+	_, err = cli(t, root, "rm", "-version", old, "storage://docs/a.txt")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "stat", "-version", old, "storage://docs/a.txt")
+	assert.Error(t, err)
+}
+
+func TestObjectLockCommands(t *testing.T) {
+	root := t.TempDir()
+	_, err := cli(t, root, "mb", "-lock", "records")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "retention", "set", "-mode", "compliance", "-years", "7", "records")
+	assert.NoError(t, err)
+	out, err := cli(t, root, "retention", "get", "records")
+	assert.NoError(t, err)
+	assert.Equal(t, "COMPLIANCE\t7 years\n", out)
+	_, err = cli(t, root, "retention", "set", "-until", "2030-01-01T00:00:00Z", "records")
+	assert.Error(t, err)
+	_, err = cli(t, root, "retention", "clear", "records")
+	assert.NoError(t, err)
+	out, err = cli(t, root, "-json", "retention", "get", "records")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `null`, out)
+
+	file := filepath.Join(t.TempDir(), "a.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("a"), 0o600))
+	_, err = cli(t, root, "cp", file, "storage://records/a.txt")
+	assert.NoError(t, err)
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	_, err = cli(t, root, "retention", "set", "-until", until, "storage://records/a.txt")
+	assert.NoError(t, err)
+	out, err = cli(t, root, "retention", "get", "storage://records/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "GOVERNANCE\tuntil "+until+"\n", out)
+
+	_, err = cli(t, root, "hold", "on", "storage://records/a.txt")
+	assert.NoError(t, err)
+	out, err = cli(t, root, "-json", "hold", "status", "storage://records/a.txt")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"legal_hold":true}`, out)
+	_, err = cli(t, root, "rm", "-bypass-governance", "storage://records/a.txt")
+	assert.Error(t, err)
+	_, err = cli(t, root, "hold", "off", "storage://records/a.txt")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "rm", "storage://records/a.txt")
+	assert.Error(t, err)
+	_, err = cli(t, root, "rm", "-bypass-governance", "storage://records/a.txt")
+	assert.NoError(t, err)
+	_, err = cli(t, root, "hold", "on", "records")
+	assert.Error(t, err)
+}
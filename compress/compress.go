@@ -0,0 +1,466 @@
+// Package compress wraps a core.Storage and transparently compresses uploads
+// whose content type is on an allowlist.
+//
+// The codec is stored as the object's Content-Encoding and in the user
+// metadata under MetadataKey. Reads through the wrapper decompress such
+// objects; objects written without the wrapper are returned untouched.
+// Server-side copies keep the stored, compressed bytes, and signed URLs serve
+// them with the Content-Encoding header, so HTTP clients decode them.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	_ core.Storage      = (*Storage)(nil)
+	_ core.Stater       = (*Storage)(nil)
+	_ core.Lister       = (*Storage)(nil)
+	_ core.ObjectReader = (*Storage)(nil)
+	_ core.Binder       = (*Storage)(nil)
+)
+
+// Codec compression format
+type Codec string
+
+const (
+	// Gzip compresses with gzip (RFC 1952).
+	Gzip Codec = "gzip"
+	// Zstd compresses with Zstandard (RFC 8878).
+	Zstd Codec = "zstd"
+)
+
+const (
+	// MetadataKey is the user metadata key that records the codec.
+	MetadataKey = "go-storage-compression"
+	// SizeMetadataKey is the user metadata key that records the size of the
+	// uncompressed content, when it is known at upload.
+	SizeMetadataKey = "go-storage-uncompressed-size"
+)
+
+// DefaultContentTypes compressed when Config.ContentTypes is empty.
+var DefaultContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/javascript",
+}
+
+// Config for compression
+type Config struct {
+	// Codec defaults to Gzip.
+	Codec Codec
+	// ContentTypes lists the media types to compress. An entry may end in
+	// "/*" to match a whole type. Defaults to DefaultContentTypes.
+	ContentTypes []string
+	// MinSize skips uploads smaller than this many bytes.
+	MinSize int64
+}
+
+// Storage compressing wrapper
+type Storage struct {
+	core.Storage
+	codec        Codec
+	contentTypes []string
+	minSize      int64
+	opts         core.Options
+}
+
+// NewEngine struct
+func NewEngine(next core.Storage, cfg Config) (*Storage, error) {
+	if next == nil {
+		return nil, errors.New("go-storage: compress needs a storage to wrap")
+	}
+	if cfg.Codec == "" {
+		cfg.Codec = Gzip
+	}
+	switch cfg.Codec {
+	case Gzip, Zstd:
+	default:
+		return nil, errors.New("go-storage: unknown compression codec " + string(cfg.Codec))
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = DefaultContentTypes
+	}
+	// Compressed uploads record the codec through bound upload options.
+	if _, err := core.With(next, core.Options{Upload: &core.UploadOptions{}}); err != nil {
+		return nil, fmt.Errorf("go-storage: compress cannot record the codec: %w", err)
+	}
+
+	return &Storage{
+		Storage:      next,
+		codec:        cfg.Codec,
+		contentTypes: cfg.ContentTypes,
+		minSize:      cfg.MinSize,
+	}, nil
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() core.Storage {
+	return s.Storage
+}
+
+// With returns a copy of s over the wrapped storage bound to opts.
+// Compressed uploads add the codec to opts.Upload.
+func (s *Storage) With(opts core.Options) (core.Storage, error) {
+	next, err := core.With(s.Storage, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *s
+	c.Storage = next
+	c.opts = c.opts.Merge(opts)
+	return &c, nil
+}
+
+// shouldCompress reports whether contentType is on the allowlist.
+func (s *Storage) shouldCompress(contentType string, size int64) bool {
+	if size < s.minSize {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range s.contentTypes {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadFile compresses content when its detected type is on the allowlist.
+// When the wrapped storage uploads the reader, as reported by
+// core.ReaderIsBody, the reader is compressed instead. Otherwise the reader
+// is a progress reader, as with minio, and is read as far as content has
+// been compressed.
+func (s *Storage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	// Detect on the raw bytes so the stored type describes the content,
+	// not the compressed stream.
+	contentType := core.DetectContentType(content)
+	var body io.Reader = bytes.NewReader(content)
+	length := int64(len(content))
+	size := length
+	if reader != nil && core.ReaderIsBody(s.Storage) {
+		// content may only be the head of the body, whose length is
+		// unknown and never below MinSize.
+		body, length, size = reader, -1, s.minSize
+	} else if reader != nil {
+		body = &progressReader{Reader: body, progress: reader}
+	}
+	if !s.shouldCompress(contentType, size) {
+		return s.Storage.UploadFile(ctx, bucketName, objectName, content, reader)
+	}
+	return s.upload(ctx, bucketName, objectName, body, contentType, length)
+}
+
+// progressReader reads as many bytes from progress as it returns, the way
+// minio advances the progress reader passed to UploadFile.
+type progressReader struct {
+	io.Reader
+	progress io.Reader
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	if n > 0 {
+		_, _ = io.CopyN(io.Discard, p.progress, int64(n))
+	}
+	return n, err
+}
+
+// ReaderIsBody reports whether the wrapped storage uploads the reader
+// passed to UploadFile.
+func (s *Storage) ReaderIsBody() bool {
+	return core.ReaderIsBody(s.Storage)
+}
+
+// UploadFileByReader compresses the stream when its type is on the allowlist.
+// An empty contentType is detected from the first 512 bytes.
+func (s *Storage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	if contentType == "" {
+		buffer := make([]byte, 512)
+		n, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		contentType = core.DetectContentType(buffer[:n])
+		reader = io.MultiReader(bytes.NewReader(buffer[:n]), reader)
+	}
+	// An unknown length (-1) is never below MinSize.
+	size := length
+	if size < 0 {
+		size = s.minSize
+	}
+	if !s.shouldCompress(contentType, size) {
+		return s.Storage.UploadFileByReader(
+			ctx, bucketName, objectName, reader, contentType, length,
+		)
+	}
+	return s.upload(ctx, bucketName, objectName, reader, contentType, length)
+}
+
+// upload streams the compressed reader to the backend, records the codec
+// and, when length is known, the uncompressed size.
+func (s *Storage) upload(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	upload := core.UploadOptions{}
+	if s.opts.Upload != nil {
+		upload = *s.opts.Upload
+	}
+	upload.Metadata = maps.Clone(upload.Metadata)
+	if upload.Metadata == nil {
+		upload.Metadata = map[string]string{}
+	}
+	upload.Metadata[MetadataKey] = string(s.codec)
+	if length >= 0 {
+		upload.Metadata[SizeMetadataKey] = strconv.FormatInt(length, 10)
+	}
+	upload.ContentEncoding = string(s.codec)
+	opts := s.opts
+	opts.Upload = &upload
+	next, err := core.With(s.Storage, opts)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(s.compress(pw, reader))
+	}()
+	err = next.UploadFileByReader(ctx, bucketName, objectName, pr, contentType, -1)
+	// Stop the compressor when the backend gave up before reading it all,
+	// and wait so reader is no longer in use once upload returns.
+	_ = pr.CloseWithError(errors.New("go-storage: upload stopped"))
+	<-done
+	return err
+}
+
+// compress writes reader to w with the codec.
+func (s *Storage) compress(w io.Writer, reader io.Reader) error {
+	cw, err := s.newWriter(w)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(cw, reader); err != nil {
+		_ = cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+func (s *Storage) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if s.codec == Zstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// newReader returns a decompressing reader for codec.
+func newReader(codec Codec, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, errors.New("go-storage: unknown compression codec " + string(codec))
+	}
+}
+
+// codecOf returns the codec recorded on the object, or "" for raw objects.
+// Objects written before Content-Encoding was set only carry MetadataKey.
+func codecOf(info *core.ObjectInfo) Codec {
+	switch codec := Codec(info.ContentEncoding); codec {
+	case Gzip, Zstd:
+		return codec
+	}
+	return Codec(info.Metadata[MetadataKey])
+}
+
+// decoded describes the content of a compressed object once decompressed.
+func decoded(info *core.ObjectInfo) {
+	if codecOf(info) == "" {
+		return
+	}
+	info.ContentEncoding = ""
+	info.Size = -1
+	if size, err := strconv.ParseInt(info.Metadata[SizeMetadataKey], 10, 64); err == nil {
+		info.Size = size
+	}
+}
+
+// NewReader opens the object and decompresses it. The size is -1 when the
+// object was uploaded from a stream of unknown length.
+func (s *Storage) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	body, info, err := core.NewReader(ctx, s.Storage, bucketName, fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	codec := codecOf(info)
+	if codec == "" {
+		return body, info, nil
+	}
+	r, err := newReader(codec, body)
+	if err != nil {
+		_ = body.Close()
+		return nil, nil, err
+	}
+	decoded(info)
+	return &decoder{ReadCloser: r, body: body}, info, nil
+}
+
+// decoder closes both the decompressor and the stored stream.
+type decoder struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (d *decoder) Close() error {
+	err := d.ReadCloser.Close()
+	if bodyErr := d.body.Close(); err == nil {
+		err = bodyErr
+	}
+	return err
+}
+
+// GetContent returns the decompressed content.
+func (s *Storage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	r, _, err := s.NewReader(ctx, bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// StatFile reports the uncompressed size of compressed objects, or -1 when
+// it was not known at upload.
+func (s *Storage) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	info, err := core.StatFile(ctx, s.Storage, bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	decoded(info)
+	return info, nil
+}
+
+// ListObjects lists the objects of the wrapped storage, with their stored
+// sizes.
+func (s *Storage) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	return core.ListObjects(ctx, s.Storage, bucketName, prefix)
+}
+
+// DownloadFile downloads, decompresses and saves the object as a file in the
+// local filesystem.
+func (s *Storage) DownloadFile(ctx context.Context, bucketName, fileName, target string) error {
+	return s.download(ctx, bucketName, fileName, target, nil)
+}
+
+// DownloadFileByProgress downloads, decompresses and saves the object as a
+// file in the local filesystem. The bar tracks uncompressed bytes.
+func (s *Storage) DownloadFileByProgress(
+	ctx context.Context,
+	bucketName, fileName, target string,
+	bar *pb.ProgressBar,
+) error {
+	return s.download(ctx, bucketName, fileName, target, bar)
+}
+
+func (s *Storage) download(
+	ctx context.Context,
+	bucketName, fileName, target string,
+	bar *pb.ProgressBar,
+) error {
+	r, info, err := s.NewReader(ctx, bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if dir := filepath.Dir(target); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	// Write next to the target and rename, so a failed decode never leaves
+	// a truncated file behind.
+	partPath := target + ".part.compress"
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = f
+	if bar != nil {
+		if info.Size >= 0 {
+			bar.SetTotal(info.Size)
+		}
+		w = bar.NewProxyWriter(f)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(partPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(partPath)
+		return err
+	}
+	return os.Rename(partPath, target)
+}
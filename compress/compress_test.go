@@ -0,0 +1,189 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+	"github.com/appleboy/go-storage/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// storedCodec returns the codec recorded on the stored object.
+func storedCodec(t *testing.T, backend core.Storage, bucketName, name string) string {
+	t.Helper()
+	info, err := core.StatFile(context.Background(), backend, bucketName, name)
+	assert.NoError(t, err)
+	return info.Metadata[MetadataKey]
+}
+
+func TestRoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat(`{"level":"info","msg":"hello"}`+"\n", 200))
+	for _, codec := range []Codec{Gzip, Zstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			backend := disk.NewEngine("", t.TempDir())
+			s, err := NewEngine(backend, Config{Codec: codec})
+			assert.NoError(t, err)
+			ctx := context.Background()
+
+			assert.NoError(t, s.UploadFile(ctx, "logs", "app.log", content, nil))
+
+			// The backend holds fewer bytes than were uploaded.
+			raw, err := backend.GetContent(ctx, "logs", "app.log")
+			assert.NoError(t, err)
+			assert.Less(t, len(raw), len(content))
+			assert.Equal(t, string(codec), storedCodec(t, backend, "logs", "app.log"))
+
+			got, err := s.GetContent(ctx, "logs", "app.log")
+			assert.NoError(t, err)
+			assert.Equal(t, content, got)
+
+			info, err := s.StatFile(ctx, "logs", "app.log")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), info.Size)
+
+			target := filepath.Join(t.TempDir(), "out", "app.log")
+			assert.NoError(t, s.DownloadFile(ctx, "logs", "app.log", target))
+			got, err = os.ReadFile(target)
+			assert.NoError(t, err)
+			assert.Equal(t, content, got)
+		})
+	}
+}
+
+func TestUploadFileByReader(t *testing.T) {
+	backend := disk.NewEngine("", t.TempDir())
+	s, err := NewEngine(backend, Config{ContentTypes: []string{"application/json"}})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	content := []byte(strings.Repeat(`{"a":1}`, 100))
+	assert.NoError(t, s.UploadFileByReader(
+		ctx, "b", "data.json", bytes.NewReader(content),
+		"application/json; charset=utf-8", int64(len(content)),
+	))
+	assert.Equal(t, string(Gzip), storedCodec(t, backend, "b", "data.json"))
+
+	got, err := s.GetContent(ctx, "b", "data.json")
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Types off the allowlist are stored as-is.
+	png := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("x", 100))
+	assert.NoError(t, s.UploadFileByReader(
+		ctx, "b", "image.png", bytes.NewReader(png), "", int64(len(png)),
+	))
+	raw, err := backend.GetContent(ctx, "b", "image.png")
+	assert.NoError(t, err)
+	assert.Equal(t, png, raw)
+	assert.Empty(t, storedCodec(t, backend, "b", "image.png"))
+}
+
+// bodyDisk uploads the reader passed to UploadFile, as the gcs driver does.
+type bodyDisk struct {
+	*disk.Disk
+}
+
+func (b *bodyDisk) ReaderIsBody() bool {
+	return true
+}
+
+func (b *bodyDisk) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	if reader == nil {
+		return b.Disk.UploadFile(ctx, bucketName, objectName, content, nil)
+	}
+	return b.Disk.UploadFileByReader(ctx, bucketName, objectName, reader, "", -1)
+}
+
+func TestUploadFileReaderBody(t *testing.T) {
+	backend := &bodyDisk{Disk: disk.NewEngine("", t.TempDir())}
+	s, err := NewEngine(backend, Config{})
+	assert.NoError(t, err)
+	assert.True(t, core.ReaderIsBody(s))
+	ctx := context.Background()
+
+	// content is only the sniff prefix; the reader is the body.
+	content := []byte(strings.Repeat("line\n", 500))
+	assert.NoError(t, s.UploadFile(ctx, "b", "app.log", content[:64], bytes.NewReader(content)))
+	assert.Equal(t, string(Gzip), storedCodec(t, backend, "b", "app.log"))
+	got, err := s.GetContent(ctx, "b", "app.log")
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestUploadFileProgress(t *testing.T) {
+	backend := disk.NewEngine("", t.TempDir())
+	s, err := NewEngine(backend, Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// The disk driver does not upload the reader; like minio's progress
+	// reader, it is still read as far as the content is compressed.
+	content := []byte(strings.Repeat("line\n", 500))
+	progress := bytes.NewReader(content)
+	assert.NoError(t, s.UploadFile(ctx, "b", "app.log", content, progress))
+	assert.Equal(t, string(Gzip), storedCodec(t, backend, "b", "app.log"))
+	assert.Zero(t, progress.Len())
+
+	got, err := s.GetContent(ctx, "b", "app.log")
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestContentEncoding(t *testing.T) {
+	backend := memory.NewEngine("")
+	s, err := NewEngine(backend, Config{Codec: Zstd})
+	assert.NoError(t, err)
+	ctx := context.Background()
+	bound, err := s.With(core.Options{Upload: &core.UploadOptions{CacheControl: "no-cache"}})
+	assert.NoError(t, err)
+
+	// A stream of unknown length is compressed without its size.
+	content := []byte(strings.Repeat("line\n", 500))
+	assert.NoError(t, bound.UploadFileByReader(
+		ctx, "b", "app.log", bytes.NewReader(content), "text/plain", -1,
+	))
+
+	stored, err := backend.StatFile(ctx, "b", "app.log")
+	assert.NoError(t, err)
+	assert.Equal(t, string(Zstd), stored.ContentEncoding)
+	assert.Equal(t, "no-cache", stored.CacheControl)
+	assert.Less(t, stored.Size, int64(len(content)))
+
+	r, info, err := s.NewReader(ctx, "b", "app.log")
+	assert.NoError(t, err)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, content, got)
+	assert.Empty(t, info.ContentEncoding)
+	assert.Equal(t, int64(-1), info.Size)
+}
+
+func TestShouldCompress(t *testing.T) {
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{MinSize: 10})
+	assert.NoError(t, err)
+
+	assert.True(t, s.shouldCompress("text/plain; charset=utf-8", 10))
+	assert.True(t, s.shouldCompress("application/json", 100))
+	assert.False(t, s.shouldCompress("text/plain", 9))
+	assert.False(t, s.shouldCompress("image/png", 100))
+	assert.False(t, s.shouldCompress("not a type", 100))
+}
+
+func TestNewEngineUnknownCodec(t *testing.T) {
+	_, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{Codec: "lz4"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package core
+
+import "fmt"
+
+// Options are settings for the calls made through one engine value. Bind
+// them with With: unlike context values, they never reach unrelated calls
+// that reuse a context, such as background uploads.
+type Options struct {
+	// Encryption overrides the engine encryption settings, on s3 and gcs.
+	// Bind the same value for reads, copies and signed URLs of SSE-C
+	// objects, since the provider needs the key on every request. Use
+	// EncryptionNone to drop the engine default.
+	Encryption *Encryption
+	// Upload sets extra attributes on the objects UploadFile and
+	// UploadFileByReader write.
+	Upload *UploadOptions
+	// VersionID makes GetContent, DownloadFile, StatFile, FileExist,
+	// NewReader and DeleteFile act on the given object version, and CopyFile
+	// copy from it. DeleteFile then removes that version for good.
+	VersionID string
+	// ObjectLock makes CreateBucket create a bucket with object lock, which
+	// retention and legal holds need. Some providers cannot turn it on for
+	// an existing bucket.
+	ObjectLock bool
+	// GovernanceBypass lets DeleteFile, uploads, copies and
+	// SetObjectRetention override governance retention.
+	GovernanceBypass bool
+}
+
+// isZero reports whether o leaves every call as it is.
+func (o Options) isZero() bool {
+	return o == Options{}
+}
+
+// Merge returns o with the fields set in next replacing its own.
+func (o Options) Merge(next Options) Options {
+	if next.Encryption != nil {
+		o.Encryption = next.Encryption
+	}
+	if next.Upload != nil {
+		o.Upload = next.Upload
+	}
+	if next.VersionID != "" {
+		o.VersionID = next.VersionID
+	}
+	o.ObjectLock = o.ObjectLock || next.ObjectLock
+	o.GovernanceBypass = o.GovernanceBypass || next.GovernanceBypass
+	return o
+}
+
+// EncryptionOr returns the encryption set in o, or engine when there is
+// none.
+func (o Options) EncryptionOr(engine *Encryption) *Encryption {
+	if o.Encryption != nil {
+		return o.Encryption
+	}
+	return engine
+}
+
+// Binder is implemented by a Storage that applies Options. It is optional:
+// use With.
+type Binder interface {
+	// With returns a copy of the storage that applies opts to every call.
+	// Fields set in opts replace those of an earlier With, the others are
+	// kept. The copy shares the client, cache and queues of the original.
+	With(opts Options) (Storage, error)
+}
+
+// With returns s bound to opts with s's Binder, or s itself for zero opts.
+// Storages without a Binder are refused other opts with an error wrapping
+// ErrNotSupported.
+func With(s Storage, opts Options) (Storage, error) {
+	if opts.isZero() {
+		return s, nil
+	}
+	if b, ok := s.(Binder); ok {
+		return b.With(opts)
+	}
+	return nil, fmt.Errorf("%w: %T cannot bind options", ErrNotSupported, s)
+}
@@ -2,8 +2,12 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
@@ -21,14 +25,106 @@ func DetectContentType(content []byte) string {
 
 // SignedURLOptions download options
 type SignedURLOptions struct {
-	Expiry          time.Duration
+	Expiry time.Duration
+	// DefaultFilename is offered to the browser in Content-Disposition.
 	DefaultFilename string
+	// Inline asks the browser to display the file rather than download it.
+	Inline bool
+	// ContentType and CacheControl override the response headers.
+	ContentType  string
+	CacheControl string
+	// VersionID signs a URL for an older version of the object.
+	VersionID string
 }
 
-// LifecycleConfig for set lifecycle
-type LifecycleConfig struct {
-	Days   int
-	Prefix string
+// ContentDisposition returns the Content-Disposition header for the options,
+// or "" when there is neither a filename nor Inline.
+func (o *SignedURLOptions) ContentDisposition() string {
+	disposition := "attachment"
+	if o.Inline {
+		disposition = "inline"
+	}
+	if o.DefaultFilename == "" {
+		if o.Inline {
+			return disposition
+		}
+		return ""
+	}
+	return ContentDisposition(disposition, o.DefaultFilename)
+}
+
+// ResponseParams returns the response-* query parameters that S3 and GCS
+// accept on signed URLs to override the response headers.
+func (o *SignedURLOptions) ResponseParams() url.Values {
+	params := url.Values{}
+	if v := o.ContentDisposition(); v != "" {
+		params.Set("response-content-disposition", v)
+	}
+	if o.ContentType != "" {
+		params.Set("response-content-type", o.ContentType)
+	}
+	if o.CacheControl != "" {
+		params.Set("response-cache-control", o.CacheControl)
+	}
+	return params
+}
+
+// ContentDisposition formats a Content-Disposition header for filename. Names
+// that are not plain printable ASCII get an ASCII fallback in filename and
+// the exact name in filename* (RFC 6266, RFC 5987).
+func ContentDisposition(disposition, filename string) string {
+	fallback := []rune(filename)
+	exact := true
+	for i, r := range fallback {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			fallback[i] = '_'
+			exact = false
+		}
+	}
+	header := disposition + `; filename="` + string(fallback) + `"`
+	if !exact {
+		header += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return header
+}
+
+// encodeRFC5987 percent-encodes every byte outside attr-char.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	return b.String()
+}
+
+// ObjectInfo object attributes
+type ObjectInfo struct {
+	Bucket       string    `json:"bucket"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	CacheControl string    `json:"cache_control,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	// Metadata holds user-defined metadata. Keys are lower-cased, since
+	// providers disagree on the case they return them in.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// VersionID identifies the object version, on versioned buckets.
+	VersionID string `json:"version_id,omitempty"`
+	// ContentEncoding is the stored Content-Encoding, such as gzip.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	// Encryption is the server-side encryption StatFile found on the object,
+	// on s3 and gcs.
+	Encryption EncryptionType `json:"encryption,omitempty"`
 }
 
 // Storage for s3 and disk
@@ -84,6 +180,69 @@ type Storage interface {
 		bucketName, filePath string,
 		opts *SignedURLOptions,
 	) (string, error)
-	// SetLifeCycle on bucket or an object prefix.
+	// SetLifeCycle merges rules into the bucket lifecycle, replacing those
+	// with the same ID.
 	SetLifeCycle(ctx context.Context, bucketName string, opts *LifecycleConfig) error
 }
+
+// ReaderBody is implemented by a Storage whose UploadFile sends a non-nil
+// reader as the object body instead of content, as the gcs driver does.
+// Other drivers ignore the reader or, like minio, read progress into it.
+type ReaderBody interface {
+	// ReaderIsBody reports whether UploadFile uploads reader.
+	ReaderIsBody() bool
+}
+
+// ReaderIsBody reports whether s implements ReaderBody and uploads the
+// reader passed to UploadFile.
+func ReaderIsBody(s Storage) bool {
+	r, ok := s.(ReaderBody)
+	return ok && r.ReaderIsBody()
+}
+
+// Unwrap returns the storage s wraps, when s is a wrapper such as compress
+// or retry with an Unwrap() Storage method, or nil.
+func Unwrap(s Storage) Storage {
+	u, ok := s.(interface{ Unwrap() Storage })
+	if !ok {
+		return nil
+	}
+	return u.Unwrap()
+}
+
+// Stater is implemented by a Storage that reports object attributes. It is
+// optional: use StatFile.
+type Stater interface {
+	// StatFile returns the object attributes. bucket + filename
+	StatFile(ctx context.Context, bucketName, fileName string) (*ObjectInfo, error)
+}
+
+// StatFile returns the object attributes from s's Stater, or an error
+// wrapping ErrNotSupported.
+func StatFile(ctx context.Context, s Storage, bucketName, fileName string) (*ObjectInfo, error) {
+	if st, ok := s.(Stater); ok {
+		return st.StatFile(ctx, bucketName, fileName)
+	}
+	return nil, fmt.Errorf("%w: %T has no StatFile", ErrNotSupported, s)
+}
+
+// Lister is implemented by a Storage that lists objects. It is optional:
+// use ListObjects.
+type Lister interface {
+	// ListObjects returns every object whose name starts with prefix,
+	// recursively, sorted by name.
+	ListObjects(ctx context.Context, bucketName, prefix string) ([]ObjectInfo, error)
+}
+
+// ListObjects lists the objects under prefix with s's Lister, or returns
+// an error wrapping ErrNotSupported.
+func ListObjects(ctx context.Context, s Storage, bucketName, prefix string) ([]ObjectInfo, error) {
+	if l, ok := s.(Lister); ok {
+		return l.ListObjects(ctx, bucketName, prefix)
+	}
+	return nil, fmt.Errorf("%w: %T has no ListObjects", ErrNotSupported, s)
+}
+
+// ErrNotSupported is returned, wrapped, when a storage lacks an optional
+// interface such as Versioner or Locker.
+var ErrNotSupported = errors.New("go-storage: not supported")
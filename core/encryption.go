@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+)
+
+// EncryptionType server-side encryption mode
+type EncryptionType string
+
+const (
+	// EncryptionNone leaves objects to the bucket default encryption.
+	EncryptionNone EncryptionType = ""
+	// EncryptionS3 encrypts objects with keys managed by the provider (SSE-S3).
+	EncryptionS3 EncryptionType = "SSE-S3"
+	// EncryptionKMS encrypts objects with a key held in a KMS (SSE-KMS / CMEK).
+	EncryptionKMS EncryptionType = "SSE-KMS"
+	// EncryptionCustomer encrypts objects with a key supplied on every request
+	// (SSE-C / customer-supplied encryption key).
+	EncryptionCustomer EncryptionType = "SSE-C"
+)
+
+// CustomerKeySize is the length in bytes of an AES-256 customer key.
+const CustomerKeySize = 32
+
+// Encryption for server-side encryption settings
+type Encryption struct {
+	Type EncryptionType
+	// KMSKeyID is the S3 KMS key ID or the GCS key resource name
+	// (projects/p/locations/l/keyRings/r/cryptoKeys/k). Used with EncryptionKMS.
+	KMSKeyID string
+	// KMSContext is an optional S3 encryption context. Used with EncryptionKMS.
+	KMSContext map[string]string
+	// CustomerKey is the raw AES-256 key. Used with EncryptionCustomer.
+	CustomerKey []byte
+}
+
+// Validate checks the settings are complete for the selected type.
+func (e *Encryption) Validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Type {
+	case EncryptionNone, EncryptionS3:
+		return nil
+	case EncryptionKMS:
+		if e.KMSKeyID == "" {
+			return errors.New("go-storage: SSE-KMS requires a key ID")
+		}
+		return nil
+	case EncryptionCustomer:
+		if len(e.CustomerKey) != CustomerKeySize {
+			return errors.New("go-storage: SSE-C requires a 32-byte key")
+		}
+		return nil
+	default:
+		return errors.New("go-storage: unknown encryption type " + string(e.Type))
+	}
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// NotExist marks err as a missing object or bucket, so IsNotExist reports it.
+// Drivers use it to translate their SDK errors; the message and err itself
+// are kept for errors.Is and errors.As.
+func NotExist(err error) error {
+	if err == nil {
+		return nil
+	}
+	return notExistError{err}
+}
+
+type notExistError struct{ err error }
+
+func (e notExistError) Error() string { return e.err.Error() }
+
+func (e notExistError) Unwrap() error { return e.err }
+
+func (e notExistError) Is(target error) bool { return target == fs.ErrNotExist }
+
+// IsNotExist reports whether err means the object or bucket does not exist,
+// on any driver. It is errors.Is(err, fs.ErrNotExist).
+func IsNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
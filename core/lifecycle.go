@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// LifecycleConfig for set lifecycle. Days and Prefix are a shorthand for a
+// single expiration rule named "<bucket>-lifecycle-rule".
+type LifecycleConfig struct {
+	// Days expires the objects under Prefix after this many days.
+	Days   int    `json:"days,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Rules are merged into the bucket lifecycle by ID.
+	Rules []LifecycleRule `json:"rules,omitempty"`
+}
+
+// LifecycleRule is one rule of a bucket lifecycle. A rule needs an ID and at
+// least one action.
+type LifecycleRule struct {
+	ID string `json:"id"`
+	// Disabled keeps the rule without applying it.
+	Disabled bool `json:"disabled,omitempty"`
+	// Prefix and Tags select the objects the rule applies to. An object
+	// must carry every tag.
+	Prefix string            `json:"prefix,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// ExpirationDays deletes objects this many days after creation.
+	ExpirationDays int `json:"expiration_days,omitempty"`
+	// Transition moves objects to another storage class.
+	Transition *LifecycleTransition `json:"transition,omitempty"`
+	// NoncurrentExpirationDays deletes old versions this many days after
+	// they were replaced.
+	NoncurrentExpirationDays int `json:"noncurrent_expiration_days,omitempty"`
+	// AbortIncompleteUploadDays aborts multipart uploads still unfinished
+	// this many days after they started.
+	AbortIncompleteUploadDays int `json:"abort_incomplete_upload_days,omitempty"`
+}
+
+// LifecycleTransition moves objects to StorageClass Days after creation.
+type LifecycleTransition struct {
+	Days         int    `json:"days"`
+	StorageClass string `json:"storage_class"`
+}
+
+// LifecycleRules returns the rules to set on the bucket: the Days and Prefix
+// shorthand, if used, then Rules. It fails on incomplete or duplicate rules.
+func (c *LifecycleConfig) LifecycleRules(bucketName string) ([]LifecycleRule, error) {
+	if c == nil {
+		return nil, errors.New("go-storage: opts cannot be nil")
+	}
+	var rules []LifecycleRule
+	if c.Days != 0 || len(c.Rules) == 0 {
+		if c.Days <= 0 {
+			return nil, errors.New("go-storage: Days must be greater than 0")
+		}
+		rules = append(rules, LifecycleRule{
+			ID:             bucketName + "-lifecycle-rule",
+			Prefix:         c.Prefix,
+			ExpirationDays: c.Days,
+		})
+	}
+	rules = append(rules, c.Rules...)
+
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("go-storage: duplicate lifecycle rule %q", r.ID)
+		}
+		seen[r.ID] = true
+	}
+	return rules, nil
+}
+
+func (r *LifecycleRule) validate() error {
+	if r.ID == "" {
+		return errors.New("go-storage: lifecycle rule needs an ID")
+	}
+	if r.ExpirationDays < 0 || r.NoncurrentExpirationDays < 0 || r.AbortIncompleteUploadDays < 0 {
+		return fmt.Errorf("go-storage: lifecycle rule %q has negative days", r.ID)
+	}
+	if t := r.Transition; t != nil && (t.Days < 0 || t.StorageClass == "") {
+		return fmt.Errorf("go-storage: lifecycle rule %q needs a transition storage class", r.ID)
+	}
+	if r.ExpirationDays == 0 && r.Transition == nil && r.NoncurrentExpirationDays == 0 &&
+		r.AbortIncompleteUploadDays == 0 {
+		return fmt.Errorf("go-storage: lifecycle rule %q has no action", r.ID)
+	}
+	return nil
+}
+
+// MergeLifecycleRules returns current with each update replacing the rule
+// with the same ID, or appended when there is none.
+func MergeLifecycleRules(current, updates []LifecycleRule) []LifecycleRule {
+	merged := slices.Clone(current)
+	for _, u := range updates {
+		i := slices.IndexFunc(merged, func(r LifecycleRule) bool { return r.ID == u.ID })
+		if i < 0 {
+			merged = append(merged, u)
+			continue
+		}
+		merged[i] = u
+	}
+	return merged
+}
+
+// RemoveLifecycleRules returns rules without those named by ids. With no ids
+// it returns none.
+func RemoveLifecycleRules(rules []LifecycleRule, ids ...string) []LifecycleRule {
+	if len(ids) == 0 {
+		return nil
+	}
+	return slices.DeleteFunc(slices.Clone(rules), func(r LifecycleRule) bool {
+		return slices.Contains(ids, r.ID)
+	})
+}
+
+// LifecycleManager is implemented by a Storage that reads and removes
+// lifecycle rules. It is optional: use GetLifeCycle and DeleteLifeCycle,
+// which also look through wrappers.
+type LifecycleManager interface {
+	// GetLifeCycle returns the bucket lifecycle rules.
+	GetLifeCycle(ctx context.Context, bucketName string) (*LifecycleConfig, error)
+	// DeleteLifeCycle removes the rules with the given IDs, or every rule
+	// when no ID is given.
+	DeleteLifeCycle(ctx context.Context, bucketName string, ids ...string) error
+}
+
+// AsLifecycleManager returns the first of s and the storages it wraps, found
+// with Unwrap, that implements LifecycleManager.
+func AsLifecycleManager(s Storage) (LifecycleManager, bool) {
+	for w := s; w != nil; w = Unwrap(w) {
+		if l, ok := w.(LifecycleManager); ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// GetLifeCycle returns the bucket lifecycle rules from the LifecycleManager
+// AsLifecycleManager finds, or an error wrapping ErrNotSupported.
+func GetLifeCycle(ctx context.Context, s Storage, bucketName string) (*LifecycleConfig, error) {
+	l, ok := AsLifecycleManager(s)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T has no GetLifeCycle", ErrNotSupported, s)
+	}
+	return l.GetLifeCycle(ctx, bucketName)
+}
+
+// DeleteLifeCycle removes lifecycle rules with the LifecycleManager
+// AsLifecycleManager finds, or returns an error wrapping ErrNotSupported.
+func DeleteLifeCycle(ctx context.Context, s Storage, bucketName string, ids ...string) error {
+	l, ok := AsLifecycleManager(s)
+	if !ok {
+		return fmt.Errorf("%w: %T has no DeleteLifeCycle", ErrNotSupported, s)
+	}
+	return l.DeleteLifeCycle(ctx, bucketName, ids...)
+}
@@ -0,0 +1,36 @@
+package core
+
+import "strings"
+
+// UploadOptions extra object attributes for an upload
+type UploadOptions struct {
+	// Metadata is user-defined metadata stored with the object.
+	Metadata map[string]string
+	// CacheControl is served as the object's Cache-Control header.
+	CacheControl string
+	// ContentEncoding is served as the object's Content-Encoding header, for
+	// content stored compressed.
+	ContentEncoding string
+}
+
+// UploadOptions returns the attributes of info to set on a copy of the
+// object.
+func (info *ObjectInfo) UploadOptions() *UploadOptions {
+	return &UploadOptions{
+		Metadata:        info.Metadata,
+		CacheControl:    info.CacheControl,
+		ContentEncoding: info.ContentEncoding,
+	}
+}
+
+// LowerKeys returns a copy of metadata with lower-cased keys.
+func LowerKeys(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
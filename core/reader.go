@@ -0,0 +1,56 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+)
+
+// ObjectReader is implemented by a Storage that streams an object with the
+// attributes of the same response, so they always describe the content
+// read. It is optional: use NewReader.
+type ObjectReader interface {
+	// NewReader opens the object, or the version bound with
+	// Options.VersionID, for reading. The caller closes the reader.
+	NewReader(ctx context.Context, bucketName, fileName string) (io.ReadCloser, *ObjectInfo, error)
+}
+
+// readAttempts bounds how often NewReader rereads an object that keeps
+// changing.
+const readAttempts = 3
+
+// NewReader opens an object with s's ObjectReader. Other storages are read
+// with StatFile and GetContent, and reread while the object changes between
+// the two.
+func NewReader(
+	ctx context.Context,
+	s Storage,
+	bucketName, fileName string,
+) (io.ReadCloser, *ObjectInfo, error) {
+	if r, ok := s.(ObjectReader); ok {
+		return r.NewReader(ctx, bucketName, fileName)
+	}
+	for range readAttempts {
+		info, err := StatFile(ctx, s, bucketName, fileName)
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := s.GetContent(ctx, bucketName, fileName)
+		if err != nil {
+			return nil, nil, err
+		}
+		after, err := StatFile(ctx, s, bucketName, fileName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if after.ETag == info.ETag && after.VersionID == info.VersionID &&
+			after.LastModified.Equal(info.LastModified) {
+			return io.NopCloser(bytes.NewReader(content)), info, nil
+		}
+	}
+	return nil, nil, fmt.Errorf(
+		"go-storage: %s changed while it was read", path.Join(bucketName, fileName),
+	)
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrObjectLocked is returned, wrapped, when an object under retention or
+// legal hold is deleted or overwritten.
+var ErrObjectLocked = errors.New("go-storage: object is locked")
+
+// Locker is implemented by a Storage with object lock: retention and legal
+// holds. It is optional, like Versioner: find it with AsLocker.
+type Locker interface {
+	// SetBucketRetention sets the default retention of new objects in a
+	// bucket created with object lock. A nil retention removes it.
+	SetBucketRetention(ctx context.Context, bucketName string, retention *BucketRetention) error
+	// GetBucketRetention returns the default retention, or nil when there is
+	// none.
+	GetBucketRetention(ctx context.Context, bucketName string) (*BucketRetention, error)
+	// SetObjectRetention locks an object version until a date.
+	SetObjectRetention(
+		ctx context.Context,
+		bucketName, fileName string,
+		retention *ObjectRetention,
+	) error
+	// GetObjectRetention returns the object retention, or nil when there is
+	// none.
+	GetObjectRetention(ctx context.Context, bucketName, fileName string) (*ObjectRetention, error)
+	// SetLegalHold places or releases a legal hold, which locks an object
+	// version until released.
+	SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error
+	// GetLegalHold reports whether an object version is under legal hold.
+	GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error)
+}
+
+// AsLocker returns the first of s and the storages it wraps, found with
+// Unwrap, that implements Locker.
+func AsLocker(s Storage) (Locker, bool) {
+	for w := s; w != nil; w = Unwrap(w) {
+		if l, ok := w.(Locker); ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// LockerOf returns the Locker AsLocker finds. When there is none, the
+// methods of the result return an error wrapping ErrNotSupported.
+func LockerOf(s Storage) Locker {
+	if l, ok := AsLocker(s); ok {
+		return l
+	}
+	return noLock{s}
+}
+
+type noLock struct{ s Storage }
+
+func (n noLock) err() error {
+	return fmt.Errorf("%w: %T has no object lock", ErrNotSupported, n.s)
+}
+
+func (n noLock) SetBucketRetention(context.Context, string, *BucketRetention) error {
+	return n.err()
+}
+
+func (n noLock) GetBucketRetention(context.Context, string) (*BucketRetention, error) {
+	return nil, n.err()
+}
+
+func (n noLock) SetObjectRetention(context.Context, string, string, *ObjectRetention) error {
+	return n.err()
+}
+
+func (n noLock) GetObjectRetention(context.Context, string, string) (*ObjectRetention, error) {
+	return nil, n.err()
+}
+
+func (n noLock) SetLegalHold(context.Context, string, string, bool) error {
+	return n.err()
+}
+
+func (n noLock) GetLegalHold(context.Context, string, string) (bool, error) {
+	return false, n.err()
+}
+
+// RetentionMode of an object lock
+type RetentionMode string
+
+const (
+	// RetentionGovernance locks objects, but engines bound with
+	// Options.GovernanceBypass may still delete them or shorten their
+	// retention.
+	RetentionGovernance RetentionMode = "GOVERNANCE"
+	// RetentionCompliance locks objects for everyone until they expire. The
+	// retention can be extended, never shortened or removed.
+	RetentionCompliance RetentionMode = "COMPLIANCE"
+)
+
+func (m RetentionMode) valid() bool {
+	return m == RetentionGovernance || m == RetentionCompliance
+}
+
+// BucketRetention is the default retention given to new objects of a bucket
+// created with object lock. Exactly one of Days and Years is set.
+type BucketRetention struct {
+	Mode  RetentionMode `json:"mode"`
+	Days  int           `json:"days,omitempty"`
+	Years int           `json:"years,omitempty"`
+}
+
+// Validate reports an unknown mode or a missing or ambiguous period.
+func (r *BucketRetention) Validate() error {
+	if !r.Mode.valid() {
+		return fmt.Errorf("go-storage: unknown retention mode %q", r.Mode)
+	}
+	if r.Days < 0 || r.Years < 0 || (r.Days == 0) == (r.Years == 0) {
+		return errors.New("go-storage: retention needs either Days or Years")
+	}
+	return nil
+}
+
+// RetainUntil returns when an object written at t stops being retained.
+func (r *BucketRetention) RetainUntil(t time.Time) time.Time {
+	return t.AddDate(r.Years, 0, r.Days).UTC()
+}
+
+// ObjectRetention locks one object version until RetainUntil.
+type ObjectRetention struct {
+	Mode        RetentionMode `json:"mode"`
+	RetainUntil time.Time     `json:"retain_until"`
+}
+
+// Validate reports an unknown mode or a RetainUntil that is not in the
+// future.
+func (r *ObjectRetention) Validate() error {
+	if !r.Mode.valid() {
+		return fmt.Errorf("go-storage: unknown retention mode %q", r.Mode)
+	}
+	if !r.RetainUntil.After(time.Now()) {
+		return errors.New("go-storage: retention must end in the future")
+	}
+	return nil
+}
+
+// Active reports whether the retention still locks the object.
+func (r *ObjectRetention) Active() bool {
+	return r != nil && time.Now().Before(r.RetainUntil)
+}
+
+// CheckObjectLock returns ErrObjectLocked when an object with retention r and
+// legal hold may not be deleted or overwritten. bypass lifts governance
+// retention, never compliance retention or a legal hold.
+func CheckObjectLock(r *ObjectRetention, legalHold, bypass bool) error {
+	switch {
+	case legalHold:
+		return fmt.Errorf("%w: legal hold", ErrObjectLocked)
+	case r.Active() && (r.Mode == RetentionCompliance || !bypass):
+		return fmt.Errorf("%w: %s retention until %s", ErrObjectLocked,
+			r.Mode, r.RetainUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckRetentionChange returns ErrObjectLocked when the retention of an
+// object may not go from current to next, nil removing it. An active
+// retention can only be extended, unless it is governance retention and
+// bypass is set.
+func CheckRetentionChange(current, next *ObjectRetention, bypass bool) error {
+	if !current.Active() || (current.Mode == RetentionGovernance && bypass) {
+		return nil
+	}
+	if next == nil || next.RetainUntil.Before(current.RetainUntil) ||
+		(current.Mode == RetentionCompliance && next.Mode != RetentionCompliance) {
+		return fmt.Errorf("%w: %s retention can only be extended", ErrObjectLocked, current.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+// VersioningStatus of a bucket
+type VersioningStatus string
+
+const (
+	// VersioningOff is a bucket that never had versioning enabled.
+	VersioningOff VersioningStatus = ""
+	// VersioningEnabled keeps every version of an object.
+	VersioningEnabled VersioningStatus = "Enabled"
+	// VersioningSuspended keeps the versions made while it was enabled.
+	VersioningSuspended VersioningStatus = "Suspended"
+)
+
+// ObjectVersion is one version of an object, as listed by
+// ListObjectVersions.
+type ObjectVersion struct {
+	ObjectInfo
+	// IsLatest marks the current version.
+	IsLatest bool `json:"is_latest"`
+	// DeleteMarker marks a version recording a delete. It has no content.
+	DeleteMarker bool `json:"delete_marker,omitempty"`
+}
+
+// Versioner is implemented by a Storage whose buckets can keep object
+// versions. It is optional, like the database/sql/driver interfaces: find
+// it with AsVersioner, which also looks through wrappers.
+type Versioner interface {
+	// EnableVersioning keeps every version of the bucket's objects.
+	EnableVersioning(ctx context.Context, bucketName string) error
+	// SuspendVersioning stops keeping new versions. Existing ones are kept.
+	SuspendVersioning(ctx context.Context, bucketName string) error
+	// GetVersioning returns the bucket versioning status.
+	GetVersioning(ctx context.Context, bucketName string) (VersioningStatus, error)
+	// ListObjectVersions returns every version of the objects whose name
+	// starts with prefix, sorted by name, newest first.
+	ListObjectVersions(ctx context.Context, bucketName, prefix string) ([]ObjectVersion, error)
+}
+
+// AsVersioner returns the first of s and the storages it wraps, found with
+// Unwrap, that implements Versioner.
+func AsVersioner(s Storage) (Versioner, bool) {
+	for w := s; w != nil; w = Unwrap(w) {
+		if v, ok := w.(Versioner); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// VersionerOf returns the Versioner AsVersioner finds. When there is none,
+// the methods of the result return an error wrapping ErrNotSupported.
+func VersionerOf(s Storage) Versioner {
+	if v, ok := AsVersioner(s); ok {
+		return v
+	}
+	return noVersioning{s}
+}
+
+type noVersioning struct{ s Storage }
+
+func (n noVersioning) err() error {
+	return fmt.Errorf("%w: %T has no versioning", ErrNotSupported, n.s)
+}
+
+func (n noVersioning) EnableVersioning(context.Context, string) error {
+	return n.err()
+}
+
+func (n noVersioning) SuspendVersioning(context.Context, string) error {
+	return n.err()
+}
+
+func (n noVersioning) GetVersioning(context.Context, string) (VersioningStatus, error) {
+	return VersioningOff, n.err()
+}
+
+func (n noVersioning) ListObjectVersions(
+	context.Context,
+	string, string,
+) ([]ObjectVersion, error) {
+	return nil, n.err()
+}
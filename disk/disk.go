@@ -1,23 +1,42 @@
 package disk
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/appleboy/go-storage/core"
 
 	"github.com/cheggaaa/pb/v3"
 )
 
-var _ core.Storage = (*Disk)(nil)
+var (
+	_ core.Storage          = (*Disk)(nil)
+	_ core.Stater           = (*Disk)(nil)
+	_ core.Lister           = (*Disk)(nil)
+	_ core.Versioner        = (*Disk)(nil)
+	_ core.LifecycleManager = (*Disk)(nil)
+	_ core.Locker           = (*Disk)(nil)
+	_ core.ObjectReader     = (*Disk)(nil)
+	_ core.Binder           = (*Disk)(nil)
+)
+
+// partSuffix marks a file still being written.
+const partSuffix = ".part.disk"
 
-func copyFile(src, dst string) error {
-	sourceFileStat, err := os.Stat(src)
+func copyFile(root *os.Root, src, dst string) error {
+	sourceFileStat, err := root.Stat(src)
 	if err != nil {
 		return err
 	}
@@ -26,17 +45,17 @@ func copyFile(src, dst string) error {
 		return fmt.Errorf("%s is not a regular file", src)
 	}
 
-	source, err := os.Open(src)
+	source, err := root.Open(src)
 	if err != nil {
 		return err
 	}
 	defer source.Close()
 
-	if _, err := os.Stat(dst); err == nil {
+	if _, err := root.Stat(dst); err == nil {
 		return fmt.Errorf("file %s already exists", dst)
 	}
 
-	destination, err := os.Create(dst)
+	destination, err := root.Create(dst)
 	if err != nil {
 		return err
 	}
@@ -46,16 +65,72 @@ func copyFile(src, dst string) error {
 		// by the "already exists" guard above and readers never see a
 		// truncated file.
 		_ = destination.Close()
-		_ = os.Remove(dst)
+		_ = root.Remove(dst)
 		return err
 	}
 	return destination.Close()
 }
 
+// InvalidNameError reports a bucket or object name that is empty or would
+// resolve outside the bucket. It wraps fs.ErrInvalid.
+type InvalidNameError struct {
+	Kind   string // "bucket" or "object"
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("go-storage: invalid %s name %q: %s", e.Kind, e.Name, e.Reason)
+}
+
+// Unwrap returns fs.ErrInvalid.
+func (e *InvalidNameError) Unwrap() error {
+	return fs.ErrInvalid
+}
+
+func checkBucket(bucketName string) error {
+	switch {
+	case bucketName == "":
+		return &InvalidNameError{Kind: "bucket", Name: bucketName, Reason: "empty"}
+	case strings.ContainsAny(bucketName, `/\`):
+		return &InvalidNameError{Kind: "bucket", Name: bucketName, Reason: "contains a separator"}
+	case !filepath.IsLocal(bucketName):
+		return &InvalidNameError{Kind: "bucket", Name: bucketName, Reason: "leaves the root"}
+	}
+	return nil
+}
+
+// objectPath validates the names and returns the object's path inside the
+// root.
+func objectPath(bucketName, fileName string) (string, error) {
+	if err := checkBucket(bucketName); err != nil {
+		return "", err
+	}
+	switch {
+	case fileName == "":
+		return "", &InvalidNameError{Kind: "object", Name: fileName, Reason: "empty"}
+	case strings.HasPrefix(fileName, "/"):
+		return "", &InvalidNameError{Kind: "object", Name: fileName, Reason: "absolute path"}
+	case !filepath.IsLocal(filepath.FromSlash(fileName)):
+		return "", &InvalidNameError{Kind: "object", Name: fileName, Reason: "leaves the bucket"}
+	case strings.HasSuffix(fileName, partSuffix) ||
+		strings.HasSuffix(fileName, metaSuffix) ||
+		strings.Contains(fileName, metaSuffix+"/"):
+		return "", &InvalidNameError{Kind: "object", Name: fileName, Reason: "reserved suffix"}
+	}
+	return filepath.Join(bucketName, filepath.FromSlash(fileName)), nil
+}
+
 // Disk client
 type Disk struct {
 	Host string
 	Path string
+	// SigningKey lets SignedURL sign its query parameters with an HMAC.
+	// Handler only honours response-* and versionId parameters that carry a
+	// valid signature, so without a key it serves current objects only.
+	SigningKey []byte
+
+	opts core.Options
 }
 
 // NewEngine struct
@@ -66,65 +141,214 @@ func NewEngine(host, path string) *Disk {
 	}
 }
 
+// With returns a copy of d applying opts. Disk has no server-side
+// encryption, so opts.Encryption is ignored.
+func (d *Disk) With(opts core.Options) (core.Storage, error) {
+	c := *d
+	c.opts = c.opts.Merge(opts)
+	return &c, nil
+}
+
+// root opens the storage root. Every file operation goes through it, so
+// names and symlinks cannot reach outside d.Path.
+func (d *Disk) root() (*os.Root, error) {
+	dir := d.Path
+	if dir == "" {
+		dir = "."
+	}
+	return os.OpenRoot(dir)
+}
+
+// createRoot is root for writes, creating d.Path first.
+func (d *Disk) createRoot() (*os.Root, error) {
+	if d.Path != "" {
+		if err := os.MkdirAll(d.Path, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	return d.root()
+}
+
 // UploadFile to upload file to disk
 func (d *Disk) UploadFile(
-	_ context.Context,
+	ctx context.Context,
 	bucketName, fileName string,
 	content []byte,
 	_ io.Reader,
 ) error {
+	name, err := objectPath(bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	root, err := d.createRoot()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
 	// check folder exists
 	// ex: bucket + foo/bar/uuid.tar.gz
-	storage := path.Join(d.Path, bucketName, filepath.Dir(fileName))
-	if err := os.MkdirAll(storage, os.ModePerm); err != nil {
+	if err := root.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
 		return err
 	}
-	return os.WriteFile(d.FilePath(bucketName, fileName), content, os.FileMode(0o644))
+	return replace(root, bucketName, fileName, name, d.opts.GovernanceBypass, func(versionID string) error {
+		sum := newHash()
+		if err := writeFile(root, name, io.TeeReader(bytes.NewReader(content), sum), nil); err != nil {
+			return err
+		}
+		contentType := core.DetectContentType(content)
+		return writeSidecar(root, name, newSidecar(d.opts.Upload, contentType, sum, versionID))
+	})
 }
 
 // UploadFileByReader to upload file to disk
 func (d *Disk) UploadFileByReader(
-	_ context.Context,
+	ctx context.Context,
 	bucketName, fileName string,
 	reader io.Reader,
-	_ string, _ int64,
+	contentType string, _ int64,
 ) error {
+	name, err := objectPath(bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	root, err := d.createRoot()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
 	// check folder exists
 	// ex: bucket + foo/bar/uuid.tar.gz
-	storage := path.Join(d.Path, bucketName, filepath.Dir(fileName))
-	if err := os.MkdirAll(storage, os.ModePerm); err != nil {
+	if err := root.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
 		return err
 	}
+	if contentType == "" {
+		reader, contentType = sniff(reader)
+	}
+	return replace(root, bucketName, fileName, name, d.opts.GovernanceBypass, func(versionID string) error {
+		sum := newHash()
+		if err := writeFile(root, name, io.TeeReader(reader, sum), nil); err != nil {
+			return err
+		}
+		return writeSidecar(root, name, newSidecar(d.opts.Upload, contentType, sum, versionID))
+	})
+}
 
-	content, err := io.ReadAll(reader)
+// CreateBucket create bucket. With core.Options.ObjectLock, objects in the
+// bucket can be locked; that also turns it on for an existing bucket.
+func (d *Disk) CreateBucket(ctx context.Context, bucketName, region string) error {
+	if err := checkBucket(bucketName); err != nil {
+		return err
+	}
+	root, err := d.createRoot()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(d.FilePath(bucketName, fileName), content, os.FileMode(0o644))
+	defer root.Close()
+	if err := root.MkdirAll(bucketName, os.ModePerm); err != nil {
+		return err
+	}
+	if !d.opts.ObjectLock {
+		return nil
+	}
+	lock, err := readObjectLock(root, bucketName)
+	if err != nil || lock != nil {
+		return err
+	}
+	return writeObjectLock(root, bucketName, &objectLock{})
 }
 
-// CreateBucket create bucket
-func (d *Disk) CreateBucket(_ context.Context, bucketName, region string) error {
-	storage := path.Join(d.Path, bucketName)
-	if err := os.MkdirAll(storage, os.ModePerm); err != nil {
+// RemoveBucket deletes an empty bucket along with its lifecycle, versioning
+// and object lock files. A bucket that still holds objects or noncurrent
+// versions is left alone.
+func (d *Disk) RemoveBucket(_ context.Context, bucketName string) error {
+	if err := checkBucket(bucketName); err != nil {
 		return err
 	}
-
-	return nil
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	entries, err := fs.ReadDir(root.FS(), bucketName)
+	if err != nil {
+		return err
+	}
+	notEmpty := fmt.Errorf("go-storage: bucket %q is not empty", bucketName)
+	for _, entry := range entries {
+		switch entry.Name() {
+		case lifecycleFile, versioningFile, objectLockFile:
+		case versionsDir:
+			// Deleting the last version can leave empty key directories.
+			err := fs.WalkDir(root.FS(), path.Join(bucketName, versionsDir),
+				func(_ string, entry fs.DirEntry, err error) error {
+					if err == nil && !entry.IsDir() {
+						return notEmpty
+					}
+					return err
+				})
+			if err != nil {
+				return err
+			}
+		default:
+			return notEmpty
+		}
+	}
+	for _, entry := range entries {
+		if err := root.RemoveAll(filepath.Join(bucketName, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return root.Remove(bucketName)
 }
 
-// FilePath for store path + file name
+// FilePath for store path + file name. The names are cleaned as if rooted
+// at d.Path, so "../" cannot climb out of it.
 func (d *Disk) FilePath(bucketName, fileName string) string {
-	return path.Join(
+	sep := string(filepath.Separator)
+	return filepath.Join(
 		d.Path,
-		bucketName,
-		fileName,
+		filepath.Join(sep, filepath.FromSlash(bucketName), filepath.FromSlash(fileName)),
 	)
 }
 
-// DeleteFile delete file
-func (d *Disk) DeleteFile(_ context.Context, bucketName, fileName string) error {
-	return os.Remove(d.FilePath(bucketName, fileName))
+// DeleteFile delete file. When versioning is on, the object becomes a
+// noncurrent version; no delete marker is written. A version bound with
+// core.Options.VersionID is removed for good. Locked objects are refused, even
+// on versioned buckets.
+func (d *Disk) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	name, err := objectPath(bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	bypass := d.opts.GovernanceBypass
+	if versionID := d.opts.VersionID; versionID != "" {
+		return deleteVersion(root, bucketName, fileName, name, versionID, bypass)
+	}
+	if err := checkLock(root, name, bypass); err != nil {
+		return err
+	}
+	status, err := readVersioning(root, bucketName)
+	if err != nil {
+		return err
+	}
+	if status != core.VersioningOff {
+		archived, err := archive(root, bucketName, fileName, name,
+			status == core.VersioningSuspended)
+		if err != nil || archived != "" {
+			return err
+		}
+	}
+	if err := root.Remove(name); err != nil {
+		return err
+	}
+	return removeSidecar(root, name)
 }
 
 // GetFileURL for storage host + bucket + filename
@@ -138,45 +362,375 @@ func (d *Disk) GetFileURL(bucketName, fileName string) string {
 	return path.Join(d.Path, bucketName, fileName)
 }
 
+// fileSystem is the part of os.Root that writeFile needs, so it can write
+// inside the storage root or to a caller's local path.
+type fileSystem interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+}
+
+// localFS is the process file system.
+type localFS struct{}
+
+func (localFS) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (localFS) Rename(oldname, newname string) error { return os.Rename(oldname, newname) }
+
+func (localFS) Remove(name string) error { return os.Remove(name) }
+
+// writeFile streams reader into name through a temporary ".part" file, so a
+// failed write never leaves a truncated file behind.
+func writeFile(fsys fileSystem, name string, reader io.Reader, bar *pb.ProgressBar) error {
+	part := name + partSuffix
+	file, err := fsys.OpenFile(part, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = file
+	if bar != nil {
+		w = bar.NewProxyWriter(file)
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		_ = file.Close()
+		_ = fsys.Remove(part)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = fsys.Remove(part)
+		return err
+	}
+	return fsys.Rename(part, name)
+}
+
 // DownloadFile downloads and saves the object as a file in the local filesystem.
-func (d *Disk) DownloadFile(_ context.Context, bucketName, fileName, target string) error {
-	return nil
+func (d *Disk) DownloadFile(ctx context.Context, bucketName, fileName, target string) error {
+	return d.DownloadFileByProgress(ctx, bucketName, fileName, target, nil)
 }
 
 // DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
 func (d *Disk) DownloadFileByProgress(
-	_ context.Context,
+	ctx context.Context,
 	bucketName, fileName, target string,
-	_ *pb.ProgressBar,
+	bar *pb.ProgressBar,
 ) error {
-	return nil
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		return err
+	}
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return err
+	}
+	source, err := root.Open(name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	st, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return fmt.Errorf("%s is a directory", fileName)
+	}
+
+	if dir := filepath.Dir(target); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	if bar != nil {
+		bar.SetTotal(st.Size())
+	}
+	return writeFile(localFS{}, target, source, bar)
 }
 
 // GetContent for storage bucket + filename
-func (d *Disk) GetContent(_ context.Context, bucketName, fileName string) ([]byte, error) {
-	return os.ReadFile(d.FilePath(bucketName, fileName))
+func (d *Disk) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	return root.ReadFile(name)
 }
 
-// CopyFile copy src to dest
+// NewReader opens the object with the attributes of its sidecar. Reading
+// fails at the end when the object was replaced in between.
+func (d *Disk) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		return nil, nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := f.Stat()
+	if err == nil && st.IsDir() {
+		err = fmt.Errorf("%s is a directory", fileName)
+	}
+	var meta *sidecar
+	if err == nil {
+		meta, err = readSidecar(root, name)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	info := &core.ObjectInfo{
+		Bucket:       bucketName,
+		Name:         fileName,
+		Size:         st.Size(),
+		LastModified: st.ModTime(),
+	}
+	meta.apply(info)
+	if info.ETag == "" {
+		return f, info, nil
+	}
+	return &checked{
+		ReadCloser: f,
+		sum:        newHash(),
+		etag:       info.ETag,
+		name:       path.Join(bucketName, fileName),
+	}, info, nil
+}
+
+// CopyFile copy src to dest. The source can be a version bound with
+// core.Options.VersionID.
 func (d *Disk) CopyFile(
-	_ context.Context,
+	ctx context.Context,
 	srcBucketName, srcFile, destBucketName, destFile string,
 ) error {
-	src := d.FilePath(srcBucketName, srcFile)
-	dest := d.FilePath(destBucketName, destFile)
-	return copyFile(src, dest)
+	if _, err := objectPath(srcBucketName, srcFile); err != nil {
+		return err
+	}
+	dest, err := objectPath(destBucketName, destFile)
+	if err != nil {
+		return err
+	}
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	src, err := resolve(root, srcBucketName, srcFile, d.opts.VersionID)
+	if err != nil {
+		return err
+	}
+	meta, err := readSidecar(root, src)
+	if err != nil {
+		return err
+	}
+	srcVersion, err := currentVersion(root, src)
+	if err != nil {
+		return err
+	}
+	return replace(root, destBucketName, destFile, dest, d.opts.GovernanceBypass, func(versionID string) error {
+		if _, err := root.Stat(src); src == dest && errors.Is(err, fs.ErrNotExist) {
+			// Copying an object onto itself: it was just made noncurrent.
+			src = versionPath(destBucketName, destFile, srcVersion)
+		}
+		if err := copyFile(root, src, dest); err != nil {
+			return err
+		}
+		if meta == nil {
+			if versionID == "" {
+				return nil
+			}
+			meta = &sidecar{}
+		}
+		meta.UploadedAt = time.Now().UTC()
+		meta.VersionID = versionID
+		meta.NoncurrentAt = time.Time{}
+		// The copy is not locked, beyond the default retention.
+		meta.Retention, meta.LegalHold = nil, false
+		return writeSidecar(root, dest, meta)
+	})
+}
+
+// stat returns the file info of an object inside the root.
+func (d *Disk) stat(ctx context.Context, bucketName, fileName string) (fs.FileInfo, error) {
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	return root.Stat(name)
+}
+
+// info returns the attributes of an object, from the file and its sidecar.
+func (d *Disk) info(ctx context.Context, bucketName, fileName string) (*core.ObjectInfo, error) {
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	st, err := root.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", fileName)
+	}
+	info := &core.ObjectInfo{
+		Bucket:       bucketName,
+		Name:         fileName,
+		Size:         st.Size(),
+		LastModified: st.ModTime(),
+	}
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		return nil, err
+	}
+	meta.apply(info)
+	return info, nil
 }
 
 // FileExist check object exist. bucket + filename
-func (d *Disk) FileExist(_ context.Context, bucketName, fileName string) bool {
-	_, err := os.Stat(d.FilePath(bucketName, fileName))
+func (d *Disk) FileExist(ctx context.Context, bucketName, fileName string) bool {
+	_, err := d.stat(ctx, bucketName, fileName)
 
 	return err == nil
 }
 
+// StatFile returns the object attributes. bucket + filename
+func (d *Disk) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	return d.info(ctx, bucketName, fileName)
+}
+
+// ListObjects returns every file whose name starts with prefix.
+func (d *Disk) ListObjects(
+	_ context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	if err := checkBucket(bucketName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	if _, err := root.Stat(bucketName); err != nil {
+		return nil, err
+	}
+
+	// Only walk the directory the prefix points into. A prefix no valid key
+	// can start with matches nothing.
+	start := bucketName
+	if dir := path.Dir(prefix); strings.Contains(prefix, "/") && dir != "." {
+		start = path.Join(bucketName, dir)
+	}
+	if !fs.ValidPath(start) {
+		return nil, nil
+	}
+
+	var objects []core.ObjectInfo
+	err = fs.WalkDir(root.FS(), start, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && name == start {
+				return fs.SkipDir
+			}
+			return err
+		}
+		// Skip the noncurrent versions, directories, sidecars and the part
+		// files of uploads in flight.
+		if entry.IsDir() && strings.HasSuffix(name, metaSuffix) {
+			return fs.SkipDir
+		}
+		if entry.IsDir() || strings.HasSuffix(name, partSuffix) ||
+			strings.HasSuffix(name, metaSuffix) {
+			return nil
+		}
+		key := strings.TrimPrefix(name, bucketName+"/")
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		st, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		info := core.ObjectInfo{
+			Bucket:       bucketName,
+			Name:         key,
+			Size:         st.Size(),
+			LastModified: st.ModTime(),
+		}
+		meta, err := readSidecar(root, filepath.FromSlash(name))
+		if err != nil {
+			return err
+		}
+		meta.apply(&info)
+		objects = append(objects, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// WalkDir orders by path segment ("a/b" before "a.txt"); sort by the
+	// full key to match S3 and GCS listings.
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+	return objects, nil
+}
+
 // BucketExists Checks if a bucket exists.
 func (d *Disk) BucketExists(_ context.Context, bucketName string) (found bool, err error) {
-	if _, err := os.Stat(d.FilePath(bucketName, "")); err != nil {
+	if err := checkBucket(bucketName); err != nil {
+		return false, err
+	}
+	root, err := d.root()
+	if err == nil {
+		defer root.Close()
+		_, err = root.Stat(bucketName)
+	}
+	if err != nil {
 		// A missing bucket directory is the normal "does not exist" case,
 		// not a failure; only surface real stat errors.
 		if os.IsNotExist(err) {
@@ -193,15 +747,36 @@ func (d *Disk) Client() interface{} {
 	return nil
 }
 
-// SignedURL support signed URL
+// SignedURL returns the file URL. With a SigningKey, the response-* and
+// versionId parameters are added and signed for Handler, and opts.Expiry
+// is required. Without one, Handler would refuse them, so the response-*
+// parameters are left out and a version is an error.
 func (d *Disk) SignedURL(
 	_ context.Context,
 	bucketName, filename string,
 	opts *core.SignedURLOptions,
 ) (string, error) {
-	return d.GetFileURL(bucketName, filename), nil
-}
-
-func (d *Disk) SetLifeCycle(_ context.Context, _ string, _ *core.LifecycleConfig) error {
-	return nil
+	if opts == nil {
+		return "", errors.New("go-storage: opts cannot be nil")
+	}
+	fileURL := d.GetFileURL(bucketName, filename)
+	if len(d.SigningKey) == 0 {
+		if opts.VersionID != "" {
+			return "", errors.New("go-storage: signing a version needs a SigningKey")
+		}
+		return fileURL, nil
+	}
+	params := opts.ResponseParams()
+	if opts.VersionID != "" {
+		params.Set("versionId", opts.VersionID)
+	}
+	if len(params) == 0 {
+		return fileURL, nil
+	}
+	if opts.Expiry <= 0 {
+		return "", errors.New("go-storage: signed URLs need an expiry")
+	}
+	params.Set("expires", strconv.FormatInt(time.Now().Add(opts.Expiry).Unix(), 10))
+	params.Set("signature", d.sign(bucketName, filename, params))
+	return fileURL + "?" + params.Encode(), nil
 }
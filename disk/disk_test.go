@@ -2,7 +2,21 @@ package disk
 
 import (
 	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
 )
 
 func TestDisk_BucketExists(t *testing.T) {
@@ -116,3 +130,949 @@ func TestDisk_GetFileURL(t *testing.T) {
 		})
 	}
 }
+
+func TestDisk_ListObjects(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	for _, name := range []string{"a.txt", "a/b.txt", "a/c/d.txt", "ab.txt", "z.txt"} {
+		if err := d.UploadFile(ctx, "bucket", name, []byte(name), nil); err != nil {
+			t.Fatalf("UploadFile(%s): %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "", want: []string{"a.txt", "a/b.txt", "a/c/d.txt", "ab.txt", "z.txt"}},
+		{prefix: "a", want: []string{"a.txt", "a/b.txt", "a/c/d.txt", "ab.txt"}},
+		{prefix: "a/", want: []string{"a/b.txt", "a/c/d.txt"}},
+		{prefix: "a/c/d", want: []string{"a/c/d.txt"}},
+		{prefix: "missing/", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			objects, err := d.ListObjects(ctx, "bucket", tt.prefix)
+			if err != nil {
+				t.Fatalf("ListObjects(%q): %v", tt.prefix, err)
+			}
+			var got []string
+			for _, o := range objects {
+				got = append(got, o.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListObjects(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := d.ListObjects(ctx, "missing", ""); err == nil {
+		t.Errorf("ListObjects(missing bucket) returned no error")
+	}
+}
+
+func TestDisk_DownloadFile(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.UploadFile(ctx, "bucket", "a/b.txt", []byte("hello"), nil); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	target := filepath.Join(t.TempDir(), "nested", "b.txt")
+	if err := d.DownloadFile(ctx, "bucket", "a/b.txt", target); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("downloaded %q, want %q", content, "hello")
+	}
+
+	if err := d.DownloadFile(ctx, "bucket", "missing.txt", target); !os.IsNotExist(err) {
+		t.Errorf("DownloadFile(missing) = %v, want not-exist", err)
+	}
+}
+
+func TestDisk_UploadFileReplaces(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("open files cannot be replaced on windows")
+	}
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.UploadFile(ctx, "bucket", "a.txt", []byte("old content"), nil); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	// A reader of the old object keeps seeing it whole.
+	file, err := os.Open(d.FilePath("bucket", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := d.UploadFile(ctx, "bucket", "a.txt", []byte("new"), nil); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	old, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "old content" {
+		t.Errorf("open reader got %q, want %q", old, "old content")
+	}
+	if content, _ := d.GetContent(ctx, "bucket", "a.txt"); string(content) != "new" {
+		t.Errorf("GetContent = %q, want %q", content, "new")
+	}
+}
+
+func TestDisk_SignedURL(t *testing.T) {
+	d := NewEngine("https://cdn.example.com", "data")
+	d.SigningKey = []byte("secret")
+	tests := []struct {
+		name string
+		opts *core.SignedURLOptions
+		want string
+	}{
+		{
+			name: "no options",
+			opts: &core.SignedURLOptions{Expiry: time.Hour},
+			want: "https://cdn.example.com/data/test/a.pdf",
+		},
+		{
+			name: "ascii filename",
+			opts: &core.SignedURLOptions{Expiry: time.Hour, DefaultFilename: "report.pdf"},
+			want: "https://cdn.example.com/data/test/a.pdf" +
+				"?response-content-disposition=attachment%3B+filename%3D%22report.pdf%22",
+		},
+		{
+			name: "quoted and non-ascii filename",
+			opts: &core.SignedURLOptions{
+				Expiry:          time.Hour,
+				DefaultFilename: `報告 "final".pdf`,
+				Inline:          true,
+			},
+			want: "https://cdn.example.com/data/test/a.pdf?response-content-disposition=" +
+				url.QueryEscape(`inline; filename="__ _final_.pdf"; `+
+					`filename*=UTF-8''%E5%A0%B1%E5%91%8A%20%22final%22.pdf`),
+		},
+		{
+			name: "response headers",
+			opts: &core.SignedURLOptions{
+				Expiry:       time.Hour,
+				Inline:       true,
+				ContentType:  "application/pdf",
+				CacheControl: "no-store",
+			},
+			want: "https://cdn.example.com/data/test/a.pdf?response-cache-control=no-store" +
+				"&response-content-disposition=inline&response-content-type=application%2Fpdf",
+		},
+		{
+			name: "version",
+			opts: &core.SignedURLOptions{Expiry: time.Hour, VersionID: "v1"},
+			want: "https://cdn.example.com/data/test/a.pdf?versionId=v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.SignedURL(context.Background(), "test", "a.pdf", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := u.Query()
+			if len(query) > 0 && (!d.verify("test", "a.pdf", query) || !query.Has("expires")) {
+				t.Errorf("SignedURL() = %v, want a valid signature", got)
+			}
+			query.Del("expires")
+			query.Del("signature")
+			u.RawQuery = query.Encode()
+			if u.String() != tt.want {
+				t.Errorf("SignedURL() = %v, want %v", u, tt.want)
+			}
+		})
+	}
+
+	if _, err := d.SignedURL(context.Background(), "test", "a.pdf", nil); err == nil {
+		t.Error("SignedURL(nil) should fail")
+	}
+
+	if _, err := d.SignedURL(context.Background(), "test", "a.pdf", &core.SignedURLOptions{
+		VersionID: "v1",
+	}); err == nil {
+		t.Error("SignedURL without an expiry should fail")
+	}
+
+	// Without a signing key, Handler would refuse the parameters.
+	d.SigningKey = nil
+	got, err := d.SignedURL(context.Background(), "test", "a.pdf", &core.SignedURLOptions{
+		DefaultFilename: "report.pdf",
+	})
+	if err != nil || got != "https://cdn.example.com/data/test/a.pdf" {
+		t.Errorf("SignedURL() = %v, %v, want the plain URL", got, err)
+	}
+	if _, err := d.SignedURL(context.Background(), "test", "a.pdf", &core.SignedURLOptions{
+		Expiry:    time.Hour,
+		VersionID: "v1",
+	}); err == nil {
+		t.Error("SignedURL of a version without a signing key should fail")
+	}
+}
+
+func TestDisk_Sandbox(t *testing.T) {
+	base := t.TempDir()
+	outside := filepath.Join(base, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d := NewEngine("", filepath.Join(base, "root"))
+	ctx := context.Background()
+	if err := d.UploadFile(ctx, "bucket", "ok.txt", []byte("ok"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		bucketName string
+		fileName   string
+	}{
+		{name: "object traversal", bucketName: "bucket", fileName: "../../secret.txt"},
+		{name: "nested traversal", bucketName: "bucket", fileName: "a/../../../secret.txt"},
+		{name: "absolute object", bucketName: "bucket", fileName: "/etc/passwd"},
+		{name: "empty object", bucketName: "bucket", fileName: ""},
+		{name: "bucket traversal", bucketName: "..", fileName: "secret.txt"},
+		{name: "bucket separator", bucketName: "../root/bucket", fileName: "ok.txt"},
+		{name: "empty bucket", bucketName: "", fileName: "ok.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nameErr *InvalidNameError
+			_, err := d.GetContent(ctx, tt.bucketName, tt.fileName)
+			if !errors.As(err, &nameErr) || !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("GetContent() error = %v, want InvalidNameError", err)
+			}
+			err = d.UploadFile(ctx, tt.bucketName, tt.fileName, []byte("x"), nil)
+			if !errors.As(err, &nameErr) {
+				t.Errorf("UploadFile() error = %v, want InvalidNameError", err)
+			}
+			err = d.DeleteFile(ctx, tt.bucketName, tt.fileName)
+			if !errors.As(err, &nameErr) {
+				t.Errorf("DeleteFile() error = %v, want InvalidNameError", err)
+			}
+			err = d.CopyFile(ctx, "bucket", "ok.txt", tt.bucketName, tt.fileName)
+			if !errors.As(err, &nameErr) {
+				t.Errorf("CopyFile() error = %v, want InvalidNameError", err)
+			}
+			if d.FileExist(ctx, tt.bucketName, tt.fileName) {
+				t.Error("FileExist() = true")
+			}
+			rel, err := filepath.Rel(d.Path, d.FilePath(tt.bucketName, tt.fileName))
+			if err != nil || !filepath.IsLocal(rel) && rel != "." {
+				t.Errorf("FilePath() = %q, want a path inside the root", d.FilePath(tt.bucketName, tt.fileName))
+			}
+		})
+	}
+
+	// A symlink inside the root must not lead outside it.
+	link := filepath.Join(base, "root", "bucket", "link.txt")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if content, err := d.GetContent(ctx, "bucket", "link.txt"); err == nil {
+		t.Errorf("GetContent() through symlink = %q, want error", content)
+	}
+	if err := os.Symlink(base, filepath.Join(base, "root", "bucket", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UploadFile(ctx, "bucket", "up/secret.txt", []byte("pwned"), nil); err == nil {
+		t.Error("UploadFile() through symlinked directory should fail")
+	}
+	content, err := os.ReadFile(outside)
+	if err != nil || string(content) != "secret" {
+		t.Errorf("outside file = %q, %v", content, err)
+	}
+	objects, err := d.ListObjects(ctx, "bucket", "../")
+	if err != nil || len(objects) != 0 {
+		t.Errorf("ListObjects(../) = %v, %v", objects, err)
+	}
+}
+
+func TestDisk_Metadata(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	bound, err := d.With(core.Options{Upload: &core.UploadOptions{
+		Metadata:     map[string]string{"Owner": "alice"},
+		CacheControl: "max-age=60",
+	}})
+	if err != nil {
+		t.Fatalf("With: %v", err)
+	}
+	content := "hello world"
+	err = bound.UploadFileByReader(
+		context.Background(), "bucket", "a.json", strings.NewReader(content), "application/json", -1,
+	)
+	if err != nil {
+		t.Fatalf("UploadFileByReader: %v", err)
+	}
+	html := []byte("<html></html>")
+	if err := d.UploadFile(context.Background(), "bucket", "b.html", html, nil); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	info, err := d.StatFile(context.Background(), "bucket", "a.json")
+	if err != nil {
+		t.Fatalf("StatFile: %v", err)
+	}
+	want := core.ObjectInfo{
+		Bucket:       "bucket",
+		Name:         "a.json",
+		Size:         int64(len(content)),
+		ContentType:  "application/json",
+		CacheControl: "max-age=60",
+		ETag:         "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		Metadata:     map[string]string{"owner": "alice"},
+		LastModified: info.LastModified,
+	}
+	if !reflect.DeepEqual(*info, want) {
+		t.Errorf("StatFile = %+v, want %+v", *info, want)
+	}
+	info, err = d.StatFile(context.Background(), "bucket", "b.html")
+	if err != nil || info.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("detected content type = %+v, %v", info, err)
+	}
+
+	// The sidecar follows the object on copy and delete, and never lists.
+	if err := d.CopyFile(context.Background(), "bucket", "a.json", "bucket", "c.json"); err != nil {
+		t.Fatalf("CopyFile: %v", err)
+	}
+	if err := d.DeleteFile(context.Background(), "bucket", "a.json"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	objects, err := d.ListObjects(context.Background(), "bucket", "")
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.Name)
+		if o.Name == "c.json" && (o.ContentType != want.ContentType || o.ETag != want.ETag) {
+			t.Errorf("copied object = %+v", o)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"b.html", "c.json"}) {
+		t.Errorf("ListObjects = %v", names)
+	}
+	_, err = os.Stat(filepath.Join(d.Path, "bucket", "a.json"+metaSuffix))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("sidecar of deleted object still exists: %v", err)
+	}
+	err = d.UploadFile(context.Background(), "bucket", "x"+metaSuffix, nil, nil)
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("upload with reserved suffix: %v", err)
+	}
+}
+
+func TestDisk_Handler(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	d.SigningKey = []byte("secret")
+	bound, err := d.With(core.Options{Upload: &core.UploadOptions{
+		CacheControl: "no-cache",
+	}})
+	if err != nil {
+		t.Fatalf("With: %v", err)
+	}
+	err = bound.UploadFileByReader(
+		context.Background(), "bucket", "dir/a.css", strings.NewReader("body{}"), "text/css", -1,
+	)
+	if err != nil {
+		t.Fatalf("UploadFileByReader: %v", err)
+	}
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+
+	signed := func(opts *core.SignedURLOptions) string {
+		signedURL, err := d.SignedURL(context.Background(), "bucket", "dir/a.css", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(signedURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "/bucket/dir/a.css?" + u.RawQuery
+	}
+	override := signed(&core.SignedURLOptions{
+		Expiry:      time.Hour,
+		ContentType: "text/plain",
+		Inline:      true,
+	})
+	params := url.Values{"response-content-type": {"text/plain"}, "expires": {"1"}}
+	params.Set("signature", d.sign("bucket", "dir/a.css", params))
+	expired := "/bucket/dir/a.css?" + params.Encode()
+
+	tests := []struct {
+		path   string
+		status int
+		header map[string]string
+	}{
+		{
+			path:   "/bucket/dir/a.css",
+			status: http.StatusOK,
+			header: map[string]string{
+				"Content-Type":  "text/css",
+				"Cache-Control": "no-cache",
+				"ETag":          `"aa676972bbd2b68e94ef8e91e81d20be"`,
+			},
+		},
+		{
+			path:   override,
+			status: http.StatusOK,
+			header: map[string]string{
+				"Content-Type":        "text/plain",
+				"Content-Disposition": "inline",
+			},
+		},
+		// Unsigned, tampered or expired overrides are refused.
+		{
+			path:   "/bucket/dir/a.css?response-content-type=text%2Fhtml",
+			status: http.StatusForbidden,
+		},
+		{
+			path:   strings.Replace(override, "text%2Fplain", "text%2Fhtml", 1),
+			status: http.StatusForbidden,
+		},
+		{path: expired, status: http.StatusForbidden},
+		{path: "/bucket/dir/a.css?versionId=v1", status: http.StatusForbidden},
+		{
+			path:   signed(&core.SignedURLOptions{Expiry: time.Hour, VersionID: "missing"}),
+			status: http.StatusNotFound,
+		},
+		{
+			path:   signed(&core.SignedURLOptions{Expiry: time.Hour, VersionID: "../x"}),
+			status: http.StatusNotFound,
+		},
+		{path: "/bucket/missing", status: http.StatusNotFound},
+		{path: "/bucket/dir", status: http.StatusNotFound},
+		{path: "/bucket/dir/a.css" + metaSuffix, status: http.StatusBadRequest},
+		{path: "/bucket/%2E%2E/x", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			for key, want := range tt.header {
+				if got := resp.Header.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDisk_Lifecycle(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.SetLifeCycle(ctx, "bucket", &core.LifecycleConfig{Days: 1}); err == nil {
+		t.Error("SetLifeCycle on a missing bucket should fail")
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"tmp/a/1.txt", "tmp/2.txt", "tmp/new.txt", "keep/3.txt"} {
+		if err := d.UploadFile(ctx, "bucket", name, []byte(name), nil); err != nil {
+			t.Fatalf("UploadFile(%s): %v", name, err)
+		}
+		if name != "tmp/new.txt" {
+			if err := os.Chtimes(d.FilePath("bucket", name), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// A stale part file of an upload that never finished.
+	part := d.FilePath("bucket", "tmp/upload.txt") + partSuffix
+	if err := os.WriteFile(part, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(part, old, old); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []core.LifecycleConfig{
+		{Rules: []core.LifecycleRule{{ID: "keep", Prefix: "keep/", ExpirationDays: 1}}},
+		{Rules: []core.LifecycleRule{{ID: "keep", Prefix: "keep/", ExpirationDays: 30}}},
+		{Rules: []core.LifecycleRule{{ID: "off", ExpirationDays: 1, Disabled: true}}},
+		{Days: 1, Prefix: "tmp/"},
+		{Rules: []core.LifecycleRule{{ID: "uploads", AbortIncompleteUploadDays: 1}}},
+	} {
+		if err := d.SetLifeCycle(ctx, "bucket", &cfg); err != nil {
+			t.Fatalf("SetLifeCycle(%+v): %v", cfg, err)
+		}
+	}
+	cfg, err := d.GetLifeCycle(ctx, "bucket")
+	if err != nil {
+		t.Fatalf("GetLifeCycle: %v", err)
+	}
+	want := []core.LifecycleRule{
+		{ID: "keep", Prefix: "keep/", ExpirationDays: 30},
+		{ID: "off", ExpirationDays: 1, Disabled: true},
+		{ID: "bucket-lifecycle-rule", Prefix: "tmp/", ExpirationDays: 1},
+		{ID: "uploads", AbortIncompleteUploadDays: 1},
+	}
+	if !reflect.DeepEqual(cfg.Rules, want) {
+		t.Errorf("GetLifeCycle = %+v, want %+v", cfg.Rules, want)
+	}
+	tagged := &core.LifecycleConfig{Rules: []core.LifecycleRule{
+		{ID: "tagged", Tags: map[string]string{"a": "b"}, ExpirationDays: 1},
+	}}
+	if err := d.SetLifeCycle(ctx, "bucket", tagged); err == nil {
+		t.Error("SetLifeCycle with tags should fail")
+	}
+
+	removed, err := d.ApplyLifecycle(ctx)
+	if err != nil {
+		t.Fatalf("ApplyLifecycle: %v", err)
+	}
+	var names []string
+	for _, o := range removed {
+		names = append(names, o.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"tmp/2.txt", "tmp/a/1.txt"}) {
+		t.Errorf("ApplyLifecycle removed %v", names)
+	}
+
+	objects, err := d.ListObjects(ctx, "bucket", "")
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	names = nil
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"keep/3.txt", "tmp/new.txt"}) {
+		t.Errorf("ListObjects = %v", names)
+	}
+	_, err = os.Stat(filepath.Join(d.Path, "bucket", "tmp", "a"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("empty directory not pruned: %v", err)
+	}
+	sidecar := filepath.Join(d.Path, "bucket", "tmp", "2.txt"+metaSuffix)
+	if _, err := os.Stat(sidecar); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("sidecar of expired object still exists: %v", err)
+	}
+	if _, err := os.Stat(part); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("stale upload still exists: %v", err)
+	}
+
+	if err := d.DeleteLifeCycle(ctx, "bucket", "keep", "off"); err != nil {
+		t.Fatalf("DeleteLifeCycle: %v", err)
+	}
+	if cfg, _ := d.GetLifeCycle(ctx, "bucket"); len(cfg.Rules) != 2 {
+		t.Errorf("rules after DeleteLifeCycle(keep, off) = %+v", cfg.Rules)
+	}
+	if err := d.DeleteLifeCycle(ctx, "bucket"); err != nil {
+		t.Fatalf("DeleteLifeCycle: %v", err)
+	}
+	if cfg, _ := d.GetLifeCycle(ctx, "bucket"); len(cfg.Rules) != 0 {
+		t.Errorf("rules after DeleteLifeCycle() = %+v", cfg.Rules)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.UploadFile(ctx, "bucket", "tmp/a.txt", []byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(d.FilePath("bucket", "tmp/a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLifeCycle(ctx, "bucket", &core.LifecycleConfig{Days: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := make(chan []core.ObjectInfo, 1)
+	j := NewJanitor(d, JanitorConfig{
+		Interval: time.Hour,
+		OnRun: func(removed []core.ObjectInfo, err error) {
+			if err != nil {
+				t.Errorf("janitor run: %v", err)
+			}
+			runs <- removed
+		},
+	})
+	j.Start()
+	defer j.Stop()
+
+	select {
+	case removed := <-runs:
+		if len(removed) != 1 || removed[0].Name != "tmp/a.txt" {
+			t.Errorf("janitor removed %+v", removed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("janitor did not run")
+	}
+	if d.FileExist(ctx, "bucket", "tmp/a.txt") {
+		t.Error("expired object still exists")
+	}
+}
+
+func TestDisk_Versioning(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.EnableVersioning(ctx, "bucket"); err == nil {
+		t.Error("EnableVersioning on a missing bucket should fail")
+	}
+	if err := d.CreateBucket(ctx, "bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Written before versioning: the null version.
+	if err := d.UploadFile(ctx, "bucket", "a.txt", []byte("v0"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnableVersioning(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := d.GetVersioning(ctx, "bucket"); err != nil ||
+		status != core.VersioningEnabled {
+		t.Fatalf("GetVersioning() = %q, %v", status, err)
+	}
+	for _, content := range []string{"v1", "v2"} {
+		if err := d.UploadFile(ctx, "bucket", "a.txt", []byte(content), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := d.ListObjectVersions(ctx, "bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || !versions[0].IsLatest || versions[1].IsLatest ||
+		versions[2].VersionID != nullVersion {
+		t.Fatalf("ListObjectVersions() = %+v", versions)
+	}
+	info, err := d.StatFile(ctx, "bucket", "a.txt")
+	if err != nil || info.VersionID != versions[0].VersionID {
+		t.Fatalf("StatFile() = %+v, %v", info, err)
+	}
+	v1 := atVersion(t, d, versions[1].VersionID)
+	if got, err := v1.GetContent(ctx, "bucket", "a.txt"); err != nil || string(got) != "v1" {
+		t.Errorf("GetContent(v1) = %q, %v", got, err)
+	}
+	null := atVersion(t, d, nullVersion)
+	if got, err := null.GetContent(ctx, "bucket", "a.txt"); err != nil || string(got) != "v0" {
+		t.Errorf("GetContent(null) = %q, %v", got, err)
+	}
+	if objects, _ := d.ListObjects(ctx, "bucket", ""); len(objects) != 1 {
+		t.Errorf("ListObjects() = %+v, want the current object only", objects)
+	}
+	if _, err := d.StatFile(ctx, "bucket", "x/.versions.meta.disk/a"); err == nil {
+		t.Error("StatFile should reject names with a reserved segment")
+	}
+
+	// Restore v1 by copying it over the current object.
+	if err := v1.CopyFile(ctx, "bucket", "a.txt", "bucket", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.GetContent(ctx, "bucket", "a.txt"); string(got) != "v1" {
+		t.Errorf("GetContent() after restore = %q", got)
+	}
+
+	// A delete keeps the object as a noncurrent version.
+	if err := d.DeleteFile(ctx, "bucket", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if d.FileExist(ctx, "bucket", "a.txt") {
+		t.Error("FileExist() after DeleteFile")
+	}
+	versions, _ = d.ListObjectVersions(ctx, "bucket", "a")
+	if len(versions) != 4 || versions[0].IsLatest {
+		t.Fatalf("ListObjectVersions() after delete = %+v", versions)
+	}
+
+	// Deleting a version removes it for good; deleting the current one
+	// brings the latest noncurrent version back.
+	if err := v1.DeleteFile(ctx, "bucket", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if v1.FileExist(ctx, "bucket", "a.txt") {
+		t.Error("FileExist(v1) after deleting the version")
+	}
+	if err := d.UploadFile(ctx, "bucket", "a.txt", []byte("v3"), nil); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = d.StatFile(ctx, "bucket", "a.txt")
+	if err := atVersion(t, d, info.VersionID).DeleteFile(ctx, "bucket", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.GetContent(ctx, "bucket", "a.txt"); string(got) != "v1" {
+		t.Errorf("GetContent() after deleting the current version = %q, want v1", got)
+	}
+
+	// Suspended, uploads replace the null version.
+	if err := d.SuspendVersioning(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"s1", "s2"} {
+		if err := d.UploadFile(ctx, "bucket", "a.txt", []byte(content), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, _ = d.ListObjectVersions(ctx, "bucket", "")
+	if len(versions) != 3 || versions[0].VersionID != nullVersion {
+		t.Fatalf("ListObjectVersions() when suspended = %+v", versions)
+	}
+
+	// Noncurrent versions expire through the lifecycle rules.
+	err = d.SetLifeCycle(ctx, "bucket", &core.LifecycleConfig{Rules: []core.LifecycleRule{
+		{ID: "old", NoncurrentExpirationDays: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := d.ApplyLifecycle(ctx); err != nil || len(removed) != 0 {
+		t.Fatalf("ApplyLifecycle() = %+v, %v", removed, err)
+	}
+	root, err := d.root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	old := time.Now().Add(-48 * time.Hour)
+	err = walkVersions(root, "bucket", func(name, _, _ string, _ fs.FileInfo) error {
+		meta, err := readSidecar(root, name)
+		if err != nil {
+			return err
+		}
+		meta.NoncurrentAt = old
+		return writeSidecar(root, name, meta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := d.ApplyLifecycle(ctx)
+	if err != nil || len(removed) != 2 || removed[0].VersionID == "" {
+		t.Fatalf("ApplyLifecycle() = %+v, %v", removed, err)
+	}
+	versions, _ = d.ListObjectVersions(ctx, "bucket", "")
+	if len(versions) != 1 || !versions[0].IsLatest {
+		t.Errorf("ListObjectVersions() after expiry = %+v", versions)
+	}
+	if _, err := root.Stat(filepath.Join("bucket", versionsDir)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("versions directory left behind: %v", err)
+	}
+}
+
+func TestDisk_LifecycleVersioned(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.CreateBucket(ctx, "bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnableVersioning(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UploadFile(ctx, "bucket", "a.txt", []byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := d.StatFile(ctx, "bucket", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(d.FilePath("bucket", "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLifeCycle(ctx, "bucket", &core.LifecycleConfig{Days: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired current object becomes a noncurrent version.
+	removed, err := d.ApplyLifecycle(ctx)
+	if err != nil || len(removed) != 1 || removed[0].Name != "a.txt" {
+		t.Fatalf("ApplyLifecycle() = %+v, %v", removed, err)
+	}
+	if d.FileExist(ctx, "bucket", "a.txt") {
+		t.Error("expired object is still current")
+	}
+	versions, err := d.ListObjectVersions(ctx, "bucket", "")
+	if err != nil || len(versions) != 1 || versions[0].IsLatest ||
+		versions[0].VersionID != info.VersionID {
+		t.Fatalf("ListObjectVersions() = %+v, %v", versions, err)
+	}
+	content, err := atVersion(t, d, info.VersionID).GetContent(ctx, "bucket", "a.txt")
+	if err != nil || string(content) != "a" {
+		t.Errorf("GetContent(version) = %q, %v", content, err)
+	}
+}
+
+func TestDisk_ObjectLock(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := d.CreateBucket(ctx, "plain", ""); err != nil {
+		t.Fatal(err)
+	}
+	retention := &core.BucketRetention{Mode: core.RetentionGovernance, Days: 1}
+	if err := d.SetBucketRetention(ctx, "plain", retention); err == nil {
+		t.Error("SetBucketRetention without object lock should fail")
+	}
+	if err := bind(t, d, core.Options{ObjectLock: true}).CreateBucket(ctx, "records", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.GetBucketRetention(ctx, "records"); err != nil || got != nil {
+		t.Fatalf("GetBucketRetention() = %+v, %v", got, err)
+	}
+	if err := d.SetBucketRetention(ctx, "records", &core.BucketRetention{
+		Mode: core.RetentionGovernance,
+	}); err == nil {
+		t.Error("SetBucketRetention without a period should fail")
+	}
+	if err := d.SetBucketRetention(ctx, "records", retention); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.GetBucketRetention(ctx, "records"); err != nil || *got != *retention {
+		t.Fatalf("GetBucketRetention() = %+v, %v", got, err)
+	}
+
+	// New objects get the default retention.
+	if err := d.UploadFile(ctx, "records", "a.txt", []byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetObjectRetention(ctx, "records", "a.txt")
+	if err != nil || got == nil || got.Mode != core.RetentionGovernance ||
+		got.RetainUntil.Before(time.Now().Add(23*time.Hour)) {
+		t.Fatalf("GetObjectRetention() = %+v, %v", got, err)
+	}
+	if err := d.DeleteFile(ctx, "records", "a.txt"); !errors.Is(err, core.ErrObjectLocked) {
+		t.Errorf("DeleteFile() = %v, want ErrObjectLocked", err)
+	}
+	err = d.UploadFile(ctx, "records", "a.txt", []byte("b"), nil)
+	if !errors.Is(err, core.ErrObjectLocked) {
+		t.Errorf("UploadFile() = %v, want ErrObjectLocked", err)
+	}
+	if err := d.CopyFile(ctx, "records", "a.txt", "plain", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.GetObjectRetention(ctx, "plain", "a.txt"); err != nil || got != nil {
+		t.Errorf("copy retention = %+v, %v", got, err)
+	}
+
+	// Governance retention can only be shortened with the bypass.
+	shorter := &core.ObjectRetention{
+		Mode:        core.RetentionGovernance,
+		RetainUntil: time.Now().Add(time.Hour),
+	}
+	err = d.SetObjectRetention(ctx, "records", "a.txt", shorter)
+	if !errors.Is(err, core.ErrObjectLocked) {
+		t.Errorf("SetObjectRetention(shorter) = %v, want ErrObjectLocked", err)
+	}
+	bypass := bind(t, d, core.Options{GovernanceBypass: true})
+	if err := bypass.SetObjectRetention(ctx, "records", "a.txt", shorter); err != nil {
+		t.Fatal(err)
+	}
+
+	// A legal hold wins over the bypass.
+	if err := d.SetLegalHold(ctx, "records", "a.txt", true); err != nil {
+		t.Fatal(err)
+	}
+	if hold, err := d.GetLegalHold(ctx, "records", "a.txt"); err != nil || !hold {
+		t.Fatalf("GetLegalHold() = %v, %v", hold, err)
+	}
+	if err := bypass.DeleteFile(ctx, "records", "a.txt"); !errors.Is(err, core.ErrObjectLocked) {
+		t.Errorf("DeleteFile(hold) = %v, want ErrObjectLocked", err)
+	}
+	if err := d.SetLegalHold(ctx, "records", "a.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bypass.DeleteFile(ctx, "records", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compliance retention holds for everyone and can only be extended.
+	if err := d.UploadFile(ctx, "records", "b.txt", []byte("b"), nil); err != nil {
+		t.Fatal(err)
+	}
+	compliance := &core.ObjectRetention{
+		Mode:        core.RetentionCompliance,
+		RetainUntil: time.Now().Add(48 * time.Hour),
+	}
+	if err := d.SetObjectRetention(ctx, "records", "b.txt", compliance); err != nil {
+		t.Fatal(err)
+	}
+	if err := bypass.SetObjectRetention(ctx, "records", "b.txt", nil); err == nil {
+		t.Error("removing compliance retention should fail")
+	}
+	if err := bypass.DeleteFile(ctx, "records", "b.txt"); !errors.Is(err, core.ErrObjectLocked) {
+		t.Errorf("DeleteFile(compliance) = %v, want ErrObjectLocked", err)
+	}
+
+	// Lifecycle rules skip locked objects.
+	old := time.Now().Add(-72 * time.Hour)
+	if err := os.Chtimes(filepath.Join(d.Path, "records", "b.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLifeCycle(ctx, "records", &core.LifecycleConfig{Days: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := d.ApplyLifecycle(ctx); err != nil || len(removed) != 0 {
+		t.Errorf("ApplyLifecycle() = %+v, %v", removed, err)
+	}
+}
+
+func TestDisk_RemoveBucket(t *testing.T) {
+	d := NewEngine("", t.TempDir())
+	ctx := context.Background()
+	if err := bind(t, d, core.Options{ObjectLock: true}).CreateBucket(ctx, "bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnableVersioning(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"v1", "v2"} {
+		if err := d.UploadFile(ctx, "bucket", "a.txt", []byte(content), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.RemoveBucket(ctx, "bucket"); err == nil {
+		t.Fatal("RemoveBucket should fail while the bucket holds objects")
+	}
+
+	versions, err := d.ListObjectVersions(ctx, "bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range versions {
+		version := atVersion(t, d, v.VersionID)
+		if err := version.DeleteFile(ctx, "bucket", "a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the config files and empty version directories are left.
+	if err := d.RemoveBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.BucketExists(ctx, "bucket"); err != nil || ok {
+		t.Fatalf("BucketExists() = %v, %v", ok, err)
+	}
+}
+
+// bind returns d bound to opts.
+func bind(t *testing.T, d *Disk, opts core.Options) *Disk {
+	t.Helper()
+	bound, err := d.With(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bound.(*Disk)
+}
+
+// atVersion returns d bound to the given object version.
+func atVersion(t *testing.T, d *Disk, versionID string) *Disk {
+	t.Helper()
+	return bind(t, d, core.Options{VersionID: versionID})
+}
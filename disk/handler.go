@@ -0,0 +1,156 @@
+package disk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signedParams are the query parameters Handler only accepts when signed:
+// they change the response headers or reach noncurrent versions.
+var signedParams = []string{
+	"versionId",
+	"response-content-type",
+	"response-cache-control",
+	"response-content-disposition",
+}
+
+// Handler serves objects at /{bucket}/{key} with the attributes stored at
+// upload: Content-Type, Cache-Control, Content-Encoding, ETag and
+// Last-Modified. Range and
+// conditional requests are supported, as are the response-* and versionId
+// parameters added by SignedURL when they carry a valid SigningKey
+// signature; otherwise they are refused with 403. Mount it where GetFileURL
+// points, e.g. for Path "files":
+//
+//	http.Handle("/files/", http.StripPrefix("/files", d.Handler()))
+func (d *Disk) Handler() http.Handler {
+	return http.HandlerFunc(d.serve)
+}
+
+func (d *Disk) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httpError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	bucketName, fileName, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	root, err := d.root()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer root.Close()
+	query := r.URL.Query()
+	if !d.verify(bucketName, fileName, query) {
+		httpError(w, http.StatusForbidden)
+		return
+	}
+	name, err := resolve(root, bucketName, fileName, query.Get("versionId"))
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	f, err := root.Open(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	if meta != nil {
+		setHeader(header, "Content-Type", meta.ContentType)
+		setHeader(header, "Cache-Control", meta.CacheControl)
+		setHeader(header, "Content-Encoding", meta.ContentEncoding)
+		if meta.ETag != "" {
+			header.Set("ETag", `"`+meta.ETag+`"`)
+		}
+	}
+	setHeader(header, "Content-Type", query.Get("response-content-type"))
+	setHeader(header, "Cache-Control", query.Get("response-cache-control"))
+	setHeader(header, "Content-Disposition", query.Get("response-content-disposition"))
+	http.ServeContent(w, r, st.Name(), st.ModTime(), f)
+}
+
+// sign returns the hex HMAC-SHA256 of the object and its query parameters,
+// minus any signature, under d.SigningKey.
+func (d *Disk) sign(bucketName, fileName string, params url.Values) string {
+	unsigned := url.Values{}
+	for k, v := range params {
+		if k != "signature" {
+			unsigned[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, d.SigningKey)
+	mac.Write([]byte(bucketName + "/" + fileName + "?" + unsigned.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify reports whether the request may use its query parameters: either
+// it has none that need a signature, or it carries a valid, unexpired one.
+func (d *Disk) verify(bucketName, fileName string, query url.Values) bool {
+	if !query.Has("signature") {
+		for _, k := range signedParams {
+			if query.Has(k) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(d.SigningKey) == 0 {
+		return false
+	}
+	if v := query.Get("expires"); v != "" {
+		expires, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			return false
+		}
+	}
+	want := d.sign(bucketName, fileName, query)
+	return hmac.Equal([]byte(query.Get("signature")), []byte(want))
+}
+
+func setHeader(header http.Header, key, value string) {
+	if value != "" {
+		header.Set(key, value)
+	}
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	// No object has an invalid version ID.
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		httpError(w, http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		httpError(w, http.StatusForbidden)
+	default:
+		httpError(w, http.StatusInternalServerError)
+	}
+}
+
+func httpError(w http.ResponseWriter, code int) {
+	http.Error(w, http.StatusText(code), code)
+}
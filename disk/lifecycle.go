@@ -0,0 +1,432 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// lifecycleFile holds a bucket's lifecycle rules. It ends in metaSuffix, so
+// listings skip it and no object can take its name.
+const lifecycleFile = ".lifecycle" + metaSuffix
+
+// DefaultJanitorInterval between runs of a Janitor.
+const DefaultJanitorInterval = time.Hour
+
+// lifecycle is the JSON stored in lifecycleFile.
+type lifecycle struct {
+	Rules []core.LifecycleRule `json:"rules"`
+}
+
+// SetLifeCycle merges the rules into the bucket lifecycle by ID. Rules only
+// take effect through ApplyLifecycle or a Janitor. Objects on disk have no
+// tags or storage classes, so rules using them are rejected.
+func (d *Disk) SetLifeCycle(
+	_ context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	rules, err := opts.LifecycleRules(bucketName)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		switch {
+		case len(r.Tags) > 0:
+			return fmt.Errorf("go-storage: disk lifecycle rule %q cannot filter by tags", r.ID)
+		case r.Transition != nil:
+			return fmt.Errorf("go-storage: disk lifecycle rule %q cannot transition", r.ID)
+		}
+	}
+	return d.updateLifecycle(bucketName, func(current []core.LifecycleRule) []core.LifecycleRule {
+		return core.MergeLifecycleRules(current, rules)
+	})
+}
+
+// GetLifeCycle returns the bucket lifecycle rules.
+func (d *Disk) GetLifeCycle(_ context.Context, bucketName string) (*core.LifecycleConfig, error) {
+	if err := checkBucket(bucketName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	if _, err := root.Stat(bucketName); err != nil {
+		return nil, err
+	}
+	cfg, err := readLifecycle(root, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return &core.LifecycleConfig{Rules: cfg.Rules}, nil
+}
+
+// DeleteLifeCycle removes the rules with the given IDs, or every rule when
+// no ID is given.
+func (d *Disk) DeleteLifeCycle(_ context.Context, bucketName string, ids ...string) error {
+	return d.updateLifecycle(bucketName, func(current []core.LifecycleRule) []core.LifecycleRule {
+		return core.RemoveLifecycleRules(current, ids...)
+	})
+}
+
+// updateLifecycle rewrites the lifecycle file of a bucket, removing it when
+// no rule is left.
+func (d *Disk) updateLifecycle(
+	bucketName string,
+	update func([]core.LifecycleRule) []core.LifecycleRule,
+) error {
+	if err := checkBucket(bucketName); err != nil {
+		return err
+	}
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	if _, err := root.Stat(bucketName); err != nil {
+		return err
+	}
+
+	cfg, err := readLifecycle(root, bucketName)
+	if err != nil {
+		return err
+	}
+	cfg.Rules = update(cfg.Rules)
+	name := filepath.Join(bucketName, lifecycleFile)
+	if len(cfg.Rules) == 0 {
+		if err := root.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	content, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return writeFile(root, name, bytes.NewReader(content), nil)
+}
+
+// readLifecycle loads the rules of a bucket; none is not an error.
+func readLifecycle(root *os.Root, bucketName string) (*lifecycle, error) {
+	cfg := &lifecycle{}
+	content, err := root.ReadFile(filepath.Join(bucketName, lifecycleFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ApplyLifecycle deletes the objects of every bucket that are older than
+// the ExpirationDays of an enabled rule whose Prefix they match, counting
+// from their last modification, and prunes the directories left empty. In
+// a versioned bucket they become noncurrent versions instead. Noncurrent
+// versions expire after NoncurrentExpirationDays, and unfinished
+// uploads older than AbortIncompleteUploadDays are removed too, but not
+// reported. Objects under retention or legal hold are kept. It returns the
+// objects removed, including those removed before an error, and is meant
+// for cron jobs; see Janitor to run it in the background.
+func (d *Disk) ApplyLifecycle(ctx context.Context) ([]core.ObjectInfo, error) {
+	root, err := d.root()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	entries, err := fs.ReadDir(root.FS(), ".")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		removed []core.ObjectInfo
+		errs    []error
+	)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if !entry.IsDir() || checkBucket(entry.Name()) != nil {
+			continue
+		}
+		objects, err := expire(ctx, root, entry.Name(), time.Now())
+		removed = append(removed, objects...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// expire applies the rules of one bucket.
+func expire(
+	ctx context.Context,
+	root *os.Root,
+	bucketName string,
+	now time.Time,
+) ([]core.ObjectInfo, error) {
+	cfg, err := readLifecycle(root, bucketName)
+	if err != nil || len(cfg.Rules) == 0 {
+		return nil, err
+	}
+
+	var expired []core.ObjectInfo
+	err = fs.WalkDir(root.FS(), bucketName, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() && strings.HasSuffix(name, metaSuffix) {
+			return fs.SkipDir
+		}
+		if entry.IsDir() || strings.HasSuffix(name, metaSuffix) {
+			return nil
+		}
+		st, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key := strings.TrimPrefix(name, bucketName+"/")
+		part := strings.HasSuffix(key, partSuffix)
+		for _, r := range cfg.Rules {
+			days := r.ExpirationDays
+			if part {
+				days = r.AbortIncompleteUploadDays
+			}
+			if r.Disabled || days == 0 || !strings.HasPrefix(key, r.Prefix) {
+				continue
+			}
+			if now.Before(st.ModTime().Add(time.Duration(days) * 24 * time.Hour)) {
+				continue
+			}
+			// Locked objects outlive their rules.
+			err := checkLock(root, filepath.FromSlash(name), false)
+			if errors.Is(err, core.ErrObjectLocked) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			expired = append(expired, core.ObjectInfo{
+				Bucket:       bucketName,
+				Name:         key,
+				Size:         st.Size(),
+				LastModified: st.ModTime(),
+			})
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := readVersioning(root, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]core.ObjectInfo, 0, len(expired))
+	for _, o := range expired {
+		name := filepath.Join(bucketName, filepath.FromSlash(o.Name))
+		part := strings.HasSuffix(o.Name, partSuffix)
+		// As with DeleteFile, a versioned bucket keeps the expired object
+		// as a noncurrent version.
+		if !part && status != core.VersioningOff {
+			archived, err := archive(root, bucketName, o.Name, name,
+				status == core.VersioningSuspended)
+			if err != nil {
+				return removed, err
+			}
+			if archived != "" {
+				removed = append(removed, o)
+				pruneDirs(root, bucketName, path.Dir(o.Name))
+				continue
+			}
+		}
+		if err := root.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		if err := removeSidecar(root, name); err != nil {
+			return removed, err
+		}
+		if !part {
+			removed = append(removed, o)
+		}
+		pruneDirs(root, bucketName, path.Dir(o.Name))
+	}
+	noncurrent, err := expireNoncurrent(ctx, root, bucketName, cfg.Rules, now)
+	return append(removed, noncurrent...), err
+}
+
+// expireNoncurrent deletes the noncurrent versions older than the
+// NoncurrentExpirationDays of an enabled rule whose Prefix they match,
+// counting from when they became noncurrent.
+func expireNoncurrent(
+	ctx context.Context,
+	root *os.Root,
+	bucketName string,
+	rules []core.LifecycleRule,
+	now time.Time,
+) ([]core.ObjectInfo, error) {
+	var expired []core.ObjectInfo
+	err := walkVersions(root, bucketName, func(name, key, versionID string, st fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		meta, err := readSidecar(root, name)
+		if err != nil {
+			return err
+		}
+		if meta.checkLock(false) != nil {
+			return nil
+		}
+		since := st.ModTime()
+		if meta != nil && !meta.NoncurrentAt.IsZero() {
+			since = meta.NoncurrentAt
+		}
+		for _, r := range rules {
+			days := r.NoncurrentExpirationDays
+			if r.Disabled || days == 0 || !strings.HasPrefix(key, r.Prefix) {
+				continue
+			}
+			if !now.Before(since.Add(time.Duration(days) * 24 * time.Hour)) {
+				expired = append(expired, core.ObjectInfo{
+					Bucket:       bucketName,
+					Name:         key,
+					Size:         st.Size(),
+					LastModified: st.ModTime(),
+					VersionID:    versionID,
+				})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]core.ObjectInfo, 0, len(expired))
+	for _, o := range expired {
+		err := removeVersion(root, bucketName, o.Name, o.VersionID)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed = append(removed, o)
+	}
+	return removed, nil
+}
+
+// pruneDirs removes dir and its parents inside the bucket while they are
+// empty.
+func pruneDirs(root *os.Root, bucketName, dir string) {
+	for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		name := filepath.Join(bucketName, filepath.FromSlash(dir))
+		entries, err := fs.ReadDir(root.FS(), filepath.ToSlash(name))
+		if err != nil || len(entries) > 0 || root.Remove(name) != nil {
+			return
+		}
+	}
+}
+
+// JanitorConfig for NewJanitor
+type JanitorConfig struct {
+	// Interval between runs. Defaults to DefaultJanitorInterval.
+	Interval time.Duration
+	// OnRun is called after every run with the objects removed.
+	OnRun func(removed []core.ObjectInfo, err error)
+}
+
+// Janitor runs ApplyLifecycle in the background, so expiry rules behave as
+// they do on S3 and GCS.
+type Janitor struct {
+	disk     *Disk
+	interval time.Duration
+	onRun    func([]core.ObjectInfo, error)
+
+	runMu sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewJanitor struct
+func NewJanitor(d *Disk, cfg JanitorConfig) *Janitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultJanitorInterval
+	}
+	return &Janitor{disk: d, interval: cfg.Interval, onRun: cfg.OnRun}
+}
+
+// Start applies the lifecycle rules now and then every Interval, until Stop.
+func (j *Janitor) Start() {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+	if j.stop != nil {
+		return
+	}
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	go j.run(j.stop, j.done)
+}
+
+func (j *Janitor) run(stop, done chan struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		removed, err := j.disk.ApplyLifecycle(ctx)
+		if j.onRun != nil && ctx.Err() == nil {
+			j.onRun(removed, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the background runs, interrupting one in progress, and waits
+// for it to return.
+func (j *Janitor) Stop() {
+	j.runMu.Lock()
+	stop, done := j.stop, j.done
+	j.stop, j.done = nil, nil
+	j.runMu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,148 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5" //nolint:gosec // ETags are MD5, as on S3.
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// metaSuffix marks the sidecar file holding an object's attributes.
+const metaSuffix = ".meta.disk"
+
+// sidecar is the JSON stored next to each object, so the disk driver keeps
+// the attributes S3 and GCS keep.
+type sidecar struct {
+	ContentType  string `json:"content_type,omitempty"`
+	CacheControl string `json:"cache_control,omitempty"`
+	// ContentEncoding is served as the Content-Encoding header.
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	ETag            string            `json:"etag,omitempty"`
+	UploadedAt      time.Time         `json:"uploaded_at"`
+	VersionID       string            `json:"version_id,omitempty"`
+	// NoncurrentAt is when a version stopped being the current object.
+	NoncurrentAt time.Time `json:"noncurrent_at,omitzero"`
+	// Retention and LegalHold lock the object, on buckets with object lock.
+	Retention *core.ObjectRetention `json:"retention,omitempty"`
+	LegalHold bool                  `json:"legal_hold,omitempty"`
+}
+
+// newSidecar collects the upload attributes, with opts from the engine's
+// bound Options.
+func newSidecar(
+	opts *core.UploadOptions,
+	contentType string,
+	sum hash.Hash,
+	versionID string,
+) *sidecar {
+	meta := &sidecar{
+		ContentType: contentType,
+		ETag:        hex.EncodeToString(sum.Sum(nil)),
+		UploadedAt:  time.Now().UTC(),
+		VersionID:   versionID,
+	}
+	if opts != nil {
+		meta.Metadata = core.LowerKeys(opts.Metadata)
+		meta.CacheControl = opts.CacheControl
+		meta.ContentEncoding = opts.ContentEncoding
+	}
+	return meta
+}
+
+// apply copies the sidecar attributes into info.
+func (m *sidecar) apply(info *core.ObjectInfo) {
+	if m == nil {
+		return
+	}
+	info.ContentType = m.ContentType
+	info.CacheControl = m.CacheControl
+	info.ContentEncoding = m.ContentEncoding
+	info.ETag = m.ETag
+	info.Metadata = m.Metadata
+	info.VersionID = m.VersionID
+}
+
+// checkLock returns a wrapped core.ErrObjectLocked when the object may not
+// be deleted or overwritten.
+func (m *sidecar) checkLock(bypass bool) error {
+	if m == nil {
+		return nil
+	}
+	return core.CheckObjectLock(m.Retention, m.LegalHold, bypass)
+}
+
+// writeSidecar stores meta for the object at name.
+func writeSidecar(root *os.Root, name string, meta *sidecar) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFile(root, name+metaSuffix, bytes.NewReader(content), nil)
+}
+
+// readSidecar loads the attributes of the object at name. Objects written
+// before sidecars existed have none; that is not an error.
+func readSidecar(root *os.Root, name string) (*sidecar, error) {
+	content, err := root.ReadFile(name + metaSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := &sidecar{}
+	if err := json.Unmarshal(content, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// removeSidecar deletes the sidecar of the object at name, if any.
+func removeSidecar(root *os.Root, name string) error {
+	if err := root.Remove(name + metaSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// sniff returns a reader equivalent to reader and the content type detected
+// from its first bytes.
+func sniff(reader io.Reader) (io.Reader, string) {
+	buffered := bufio.NewReaderSize(reader, 512)
+	head, _ := buffered.Peek(512)
+	return buffered, core.DetectContentType(head)
+}
+
+func newHash() hash.Hash {
+	return md5.New() //nolint:gosec
+}
+
+// checked fails the last read of an object whose content does not match the
+// ETag of its sidecar. The object and its sidecar are replaced one after the
+// other, so a reader can open one upload and read the other's attributes.
+type checked struct {
+	io.ReadCloser
+	sum  hash.Hash
+	etag string
+	name string
+}
+
+func (c *checked) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.sum.Write(p[:n])
+	if errors.Is(err, io.EOF) && hex.EncodeToString(c.sum.Sum(nil)) != c.etag {
+		return n, fmt.Errorf("go-storage: %s changed while it was read", c.name)
+	}
+	return n, err
+}
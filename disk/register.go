@@ -0,0 +1,18 @@
+package disk
+
+import (
+	"context"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+)
+
+func init() {
+	storage.Register("disk", func(_ context.Context, cfg storage.Config) (core.Storage, error) {
+		d := NewEngine(cfg.Addr, cfg.Path)
+		if cfg.SecretKey != "" {
+			d.SigningKey = []byte(cfg.SecretKey)
+		}
+		return d, nil
+	})
+}
@@ -0,0 +1,252 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// objectLockFile marks a bucket created with core.Options.ObjectLock and holds
+// its default retention.
+const objectLockFile = ".objectlock" + metaSuffix
+
+// objectLock is the JSON stored in objectLockFile.
+type objectLock struct {
+	Retention *core.BucketRetention `json:"retention,omitempty"`
+}
+
+// readObjectLock loads the object lock of a bucket, or nil when it was not
+// created with one.
+func readObjectLock(root *os.Root, bucketName string) (*objectLock, error) {
+	content, err := root.ReadFile(filepath.Join(bucketName, objectLockFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lock := &objectLock{}
+	if err := json.Unmarshal(content, lock); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func writeObjectLock(root *os.Root, bucketName string, lock *objectLock) error {
+	content, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(bucketName, objectLockFile)
+	return writeFile(root, name, bytes.NewReader(content), nil)
+}
+
+// lockedBucket opens the root and loads the object lock of a bucket, failing
+// when the bucket has none. The caller closes the root.
+func (d *Disk) lockedBucket(bucketName string) (*os.Root, *objectLock, error) {
+	if err := checkBucket(bucketName); err != nil {
+		return nil, nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := root.Stat(bucketName); err != nil {
+		root.Close()
+		return nil, nil, err
+	}
+	lock, err := readObjectLock(root, bucketName)
+	if err == nil && lock == nil {
+		err = fmt.Errorf("go-storage: bucket %q has no object lock", bucketName)
+	}
+	if err != nil {
+		root.Close()
+		return nil, nil, err
+	}
+	return root, lock, nil
+}
+
+// SetBucketRetention sets the default retention of objects written to the
+// bucket from now on. The bucket must have been created with
+// core.Options.ObjectLock.
+func (d *Disk) SetBucketRetention(
+	_ context.Context,
+	bucketName string,
+	retention *core.BucketRetention,
+) error {
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+	}
+	root, lock, err := d.lockedBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	lock.Retention = retention
+	return writeObjectLock(root, bucketName, lock)
+}
+
+// GetBucketRetention returns the default retention, or nil when there is
+// none.
+func (d *Disk) GetBucketRetention(
+	_ context.Context,
+	bucketName string,
+) (*core.BucketRetention, error) {
+	if err := checkBucket(bucketName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	if _, err := root.Stat(bucketName); err != nil {
+		return nil, err
+	}
+	lock, err := readObjectLock(root, bucketName)
+	if err != nil || lock == nil {
+		return nil, err
+	}
+	return lock.Retention, nil
+}
+
+// SetObjectRetention locks an object version until a date. Active retention
+// can only be extended, unless it is governance retention and the engine
+// is bound with core.Options.GovernanceBypass.
+func (d *Disk) SetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+	retention *core.ObjectRetention,
+) error {
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+	}
+	return d.updateLock(ctx, bucketName, fileName, func(meta *sidecar) error {
+		bypass := d.opts.GovernanceBypass
+		if err := core.CheckRetentionChange(meta.Retention, retention, bypass); err != nil {
+			return err
+		}
+		meta.Retention = retention
+		return nil
+	})
+}
+
+// GetObjectRetention returns the object retention, or nil when there is
+// none.
+func (d *Disk) GetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectRetention, error) {
+	meta, err := d.lockMeta(ctx, bucketName, fileName)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	return meta.Retention, nil
+}
+
+// SetLegalHold places or releases a legal hold.
+func (d *Disk) SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error {
+	return d.updateLock(ctx, bucketName, fileName, func(meta *sidecar) error {
+		meta.LegalHold = hold
+		return nil
+	})
+}
+
+// GetLegalHold reports whether an object version is under legal hold.
+func (d *Disk) GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error) {
+	meta, err := d.lockMeta(ctx, bucketName, fileName)
+	if err != nil || meta == nil {
+		return false, err
+	}
+	return meta.LegalHold, nil
+}
+
+// updateLock rewrites the sidecar of an object version in a bucket with
+// object lock.
+func (d *Disk) updateLock(
+	ctx context.Context,
+	bucketName, fileName string,
+	update func(meta *sidecar) error,
+) error {
+	root, _, err := d.lockedBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return err
+	}
+	if _, err := root.Stat(name); err != nil {
+		return err
+	}
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		meta = &sidecar{}
+	}
+	if err := update(meta); err != nil {
+		return err
+	}
+	return writeSidecar(root, name, meta)
+}
+
+// lockMeta loads the sidecar of an object version, which may be nil.
+func (d *Disk) lockMeta(ctx context.Context, bucketName, fileName string) (*sidecar, error) {
+	if _, err := objectPath(bucketName, fileName); err != nil {
+		return nil, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	name, err := resolve(root, bucketName, fileName, d.opts.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := root.Stat(name); err != nil {
+		return nil, err
+	}
+	return readSidecar(root, name)
+}
+
+// checkLock returns a wrapped core.ErrObjectLocked when the object at name
+// may not be deleted or overwritten.
+func checkLock(root *os.Root, name string, bypass bool) error {
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		return err
+	}
+	return meta.checkLock(bypass)
+}
+
+// retain gives the object at name the default retention of its bucket.
+func retain(root *os.Root, name string, retention *core.BucketRetention) error {
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		meta = &sidecar{}
+	}
+	meta.Retention = &core.ObjectRetention{
+		Mode:        retention.Mode,
+		RetainUntil: retention.RetainUntil(time.Now()),
+	}
+	return writeSidecar(root, name, meta)
+}
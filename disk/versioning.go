@@ -0,0 +1,443 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// versioningFile holds a bucket's versioning status.
+const versioningFile = ".versioning" + metaSuffix
+
+// versionsDir holds the noncurrent versions of a bucket's objects, at
+// <key>.meta.disk/<version ID>, each with its sidecar. Object names cannot
+// contain a segment ending in metaSuffix, so it never clashes with a key.
+const versionsDir = ".versions" + metaSuffix
+
+// nullVersion is the ID of an object written while versioning was off or
+// suspended, as on S3.
+const nullVersion = "null"
+
+// EnableVersioning keeps the object replaced by every upload, copy or delete
+// as a noncurrent version.
+func (d *Disk) EnableVersioning(_ context.Context, bucketName string) error {
+	return d.setVersioning(bucketName, core.VersioningEnabled)
+}
+
+// SuspendVersioning stops keeping new versions. Noncurrent versions are kept;
+// new objects get the null version ID and replace each other.
+func (d *Disk) SuspendVersioning(_ context.Context, bucketName string) error {
+	return d.setVersioning(bucketName, core.VersioningSuspended)
+}
+
+func (d *Disk) setVersioning(bucketName string, status core.VersioningStatus) error {
+	if err := checkBucket(bucketName); err != nil {
+		return err
+	}
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	if _, err := root.Stat(bucketName); err != nil {
+		return err
+	}
+	name := filepath.Join(bucketName, versioningFile)
+	return writeFile(root, name, strings.NewReader(string(status)), nil)
+}
+
+// GetVersioning returns the bucket versioning status.
+func (d *Disk) GetVersioning(_ context.Context, bucketName string) (core.VersioningStatus, error) {
+	if err := checkBucket(bucketName); err != nil {
+		return core.VersioningOff, err
+	}
+	root, err := d.root()
+	if err != nil {
+		return core.VersioningOff, err
+	}
+	defer root.Close()
+	if _, err := root.Stat(bucketName); err != nil {
+		return core.VersioningOff, err
+	}
+	return readVersioning(root, bucketName)
+}
+
+// readVersioning loads the status of a bucket; none is VersioningOff.
+func readVersioning(root *os.Root, bucketName string) (core.VersioningStatus, error) {
+	content, err := root.ReadFile(filepath.Join(bucketName, versioningFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return core.VersioningOff, nil
+	}
+	if err != nil {
+		return core.VersioningOff, err
+	}
+	return core.VersioningStatus(content), nil
+}
+
+// ListObjectVersions returns the current objects whose name starts with
+// prefix and their noncurrent versions. Deletes leave no delete marker: the
+// deleted object simply becomes noncurrent.
+func (d *Disk) ListObjectVersions(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectVersion, error) {
+	objects, err := d.ListObjects(ctx, bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]core.ObjectVersion, 0, len(objects))
+	for _, o := range objects {
+		if o.VersionID == "" {
+			o.VersionID = nullVersion
+		}
+		versions = append(versions, core.ObjectVersion{ObjectInfo: o, IsLatest: true})
+	}
+
+	root, err := d.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	err = walkVersions(root, bucketName, func(name, key, versionID string, st fs.FileInfo) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info := core.ObjectInfo{
+			Bucket:       bucketName,
+			Name:         key,
+			Size:         st.Size(),
+			LastModified: st.ModTime(),
+		}
+		meta, err := readSidecar(root, name)
+		if err != nil {
+			return err
+		}
+		meta.apply(&info)
+		info.VersionID = versionID
+		versions = append(versions, core.ObjectVersion{ObjectInfo: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, b := versions[i], versions[j]
+		switch {
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.IsLatest != b.IsLatest:
+			return a.IsLatest
+		}
+		return a.LastModified.After(b.LastModified)
+	})
+	return versions, nil
+}
+
+// walkVersions calls fn for every noncurrent version of a bucket, with its
+// path inside the root, object name and version ID.
+func walkVersions(
+	root *os.Root,
+	bucketName string,
+	fn func(name, key, versionID string, st fs.FileInfo) error,
+) error {
+	dir := path.Join(bucketName, versionsDir)
+	return fs.WalkDir(root.FS(), dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && name == dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(name, metaSuffix) ||
+			strings.HasSuffix(name, partSuffix) {
+			return nil
+		}
+		keyDir, versionID := path.Split(strings.TrimPrefix(name, dir+"/"))
+		key := strings.TrimSuffix(strings.TrimSuffix(keyDir, "/"), metaSuffix)
+		st, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(filepath.FromSlash(name), key, versionID, st)
+	})
+}
+
+var (
+	versionMu   sync.Mutex
+	lastVersion int64
+)
+
+// newVersionID returns a unique ID that sorts after every earlier one.
+func newVersionID() string {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	id := time.Now().UnixNano()
+	if id <= lastVersion {
+		id = lastVersion + 1
+	}
+	lastVersion = id
+	return fmt.Sprintf("%020d", id)
+}
+
+func checkVersion(versionID string) error {
+	switch {
+	case versionID == "":
+		return &InvalidNameError{Kind: "version", Name: versionID, Reason: "empty"}
+	case strings.ContainsAny(versionID, `/\`) || !filepath.IsLocal(versionID):
+		return &InvalidNameError{Kind: "version", Name: versionID, Reason: "not a single segment"}
+	case strings.HasSuffix(versionID, metaSuffix) || strings.HasSuffix(versionID, partSuffix):
+		return &InvalidNameError{Kind: "version", Name: versionID, Reason: "reserved suffix"}
+	}
+	return nil
+}
+
+// versionPath returns the path of a noncurrent version inside the root.
+func versionPath(bucketName, fileName, versionID string) string {
+	key := filepath.FromSlash(fileName) + metaSuffix
+	return filepath.Join(bucketName, versionsDir, key, versionID)
+}
+
+// currentVersion returns the version ID of the object at name, or "" when
+// there is none.
+func currentVersion(root *os.Root, name string) (string, error) {
+	if _, err := root.Stat(name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil || meta.VersionID == "" {
+		return nullVersion, nil
+	}
+	return meta.VersionID, nil
+}
+
+// resolve returns the path inside the root of the given object version, or
+// of the current object when versionID is empty.
+func resolve(root *os.Root, bucketName, fileName, versionID string) (string, error) {
+	name, err := objectPath(bucketName, fileName)
+	if err != nil {
+		return "", err
+	}
+	if versionID == "" {
+		return name, nil
+	}
+	if err := checkVersion(versionID); err != nil {
+		return "", err
+	}
+	current, err := currentVersion(root, name)
+	if err != nil || current == versionID {
+		return name, err
+	}
+	return versionPath(bucketName, fileName, versionID), nil
+}
+
+// replace stores a new object at name through write, which is given the
+// version ID to record in the sidecar. When versioning is on, the object
+// replaced is kept as a noncurrent version, unless both are null versions.
+// A locked object is never replaced, and the new one gets the default
+// retention of the bucket.
+func replace(
+	root *os.Root,
+	bucketName, fileName, name string,
+	bypass bool,
+	write func(versionID string) error,
+) error {
+	if err := checkLock(root, name, bypass); err != nil {
+		return err
+	}
+	lock, err := readObjectLock(root, bucketName)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.Retention != nil {
+		store := write
+		write = func(versionID string) error {
+			if err := store(versionID); err != nil {
+				return err
+			}
+			return retain(root, name, lock.Retention)
+		}
+	}
+	status, err := readVersioning(root, bucketName)
+	if err != nil {
+		return err
+	}
+	if status == core.VersioningOff {
+		return write("")
+	}
+	versionID := nullVersion
+	if status == core.VersioningEnabled {
+		versionID = newVersionID()
+	}
+	archived, err := archive(root, bucketName, fileName, name, versionID == nullVersion)
+	if err != nil {
+		return err
+	}
+	if err := write(versionID); err != nil {
+		if archived != "" {
+			_ = promote(root, archived, name)
+		}
+		return err
+	}
+	if versionID != nullVersion {
+		return nil
+	}
+	// The new null version replaces a noncurrent one.
+	err = removeVersion(root, bucketName, fileName, nullVersion)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// archive moves the object at name to its noncurrent versions and returns
+// the path it was moved to. It returns "" when there is no object, or when
+// dropNull is set and the object is a null version.
+func archive(root *os.Root, bucketName, fileName, name string, dropNull bool) (string, error) {
+	versionID, err := currentVersion(root, name)
+	if err != nil || versionID == "" || (dropNull && versionID == nullVersion) {
+		return "", err
+	}
+	meta, err := readSidecar(root, name)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		meta = &sidecar{}
+	}
+	meta.VersionID = versionID
+	meta.NoncurrentAt = time.Now().UTC()
+
+	dest := versionPath(bucketName, fileName, versionID)
+	if err := root.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := root.Rename(name, dest); err != nil {
+		return "", err
+	}
+	if err := removeSidecar(root, name); err != nil {
+		return dest, err
+	}
+	return dest, writeSidecar(root, dest, meta)
+}
+
+// promote makes the noncurrent version at src the current object at name.
+func promote(root *os.Root, src, name string) error {
+	meta, err := readSidecar(root, src)
+	if err != nil {
+		return err
+	}
+	if err := root.Rename(src, name); err != nil {
+		return err
+	}
+	if err := removeSidecar(root, src); err != nil || meta == nil {
+		return err
+	}
+	meta.NoncurrentAt = time.Time{}
+	return writeSidecar(root, name, meta)
+}
+
+// removeVersion deletes a noncurrent version and the directories it leaves
+// empty.
+func removeVersion(root *os.Root, bucketName, fileName, versionID string) error {
+	name := versionPath(bucketName, fileName, versionID)
+	if err := root.Remove(name); err != nil {
+		return err
+	}
+	if err := removeSidecar(root, name); err != nil {
+		return err
+	}
+	pruneDirs(root, bucketName, path.Join(versionsDir, fileName+metaSuffix))
+	return nil
+}
+
+// deleteVersion removes one version of an object for good, unless it is
+// locked. Removing the current version makes the latest noncurrent one
+// current.
+func deleteVersion(
+	root *os.Root,
+	bucketName, fileName, name, versionID string,
+	bypass bool,
+) error {
+	if err := checkVersion(versionID); err != nil {
+		return err
+	}
+	current, err := currentVersion(root, name)
+	if err != nil {
+		return err
+	}
+	if current != versionID {
+		err := checkLock(root, versionPath(bucketName, fileName, versionID), bypass)
+		if err != nil {
+			return err
+		}
+		return removeVersion(root, bucketName, fileName, versionID)
+	}
+	if err := checkLock(root, name, bypass); err != nil {
+		return err
+	}
+	if err := root.Remove(name); err != nil {
+		return err
+	}
+	if err := removeSidecar(root, name); err != nil {
+		return err
+	}
+
+	dir := versionPath(bucketName, fileName, "")
+	entries, err := fs.ReadDir(root.FS(), filepath.ToSlash(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var (
+		latest string
+		at     time.Time
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), metaSuffix) ||
+			strings.HasSuffix(entry.Name(), partSuffix) {
+			continue
+		}
+		src := filepath.Join(dir, entry.Name())
+		st, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		meta, err := readSidecar(root, src)
+		if err != nil {
+			return err
+		}
+		noncurrent := st.ModTime()
+		if meta != nil && !meta.NoncurrentAt.IsZero() {
+			noncurrent = meta.NoncurrentAt
+		}
+		if latest == "" || noncurrent.After(at) {
+			latest, at = src, noncurrent
+		}
+	}
+	if latest == "" {
+		return nil
+	}
+	if err := promote(root, latest, name); err != nil {
+		return err
+	}
+	pruneDirs(root, bucketName, path.Join(versionsDir, fileName+metaSuffix))
+	return nil
+}
@@ -3,33 +3,138 @@ package gcs
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/appleboy/go-storage/core"
 
 	"cloud.google.com/go/storage"
 	"github.com/cheggaaa/pb/v3"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
-var _ core.Storage = (*GCS)(nil)
+var (
+	_ core.Storage          = (*GCS)(nil)
+	_ core.Stater           = (*GCS)(nil)
+	_ core.Lister           = (*GCS)(nil)
+	_ core.Versioner        = (*GCS)(nil)
+	_ core.LifecycleManager = (*GCS)(nil)
+	_ core.Locker           = (*GCS)(nil)
+	_ core.ReaderBody       = (*GCS)(nil)
+	_ core.ObjectReader     = (*GCS)(nil)
+	_ core.Binder           = (*GCS)(nil)
+)
 
 // Google Cloud Storage client
 type GCS struct {
-	projectID  string
-	accessID   string
-	privateKey []byte
-	client     *storage.Client
+	projectID   string
+	accessID    string
+	privateKey  []byte
+	userProject string
+	host        string
+	iamOptions  []option.ClientOption
+	client      *storage.Client
+	encryption  *core.Encryption
+	opts        core.Options
+}
+
+// bucket returns the handle for bucketName, billed to the user project when
+// one is set.
+func (g *GCS) bucket(bucketName string) *storage.BucketHandle {
+	b := g.client.Bucket(bucketName)
+	if g.userProject != "" {
+		b = b.UserProject(g.userProject)
+	}
+	return b
+}
+
+// SetEncryption sets the default encryption for every call that does not
+// override it with core.Options. Call it before the engine is shared
+// between goroutines. SSE-S3 maps to Google-managed keys, the GCS default.
+func (g *GCS) SetEncryption(enc *core.Encryption) error {
+	if err := enc.Validate(); err != nil {
+		return err
+	}
+	g.encryption = enc
+	return nil
+}
+
+// With returns a copy of g that applies opts to every call.
+func (g *GCS) With(opts core.Options) (core.Storage, error) {
+	c := *g
+	c.opts = c.opts.Merge(opts)
+	return &c, nil
+}
+
+// object returns the handle for bucket/object, carrying the customer-supplied
+// key when SSE-C is in effect so reads, writes and copies can use it.
+func (g *GCS) object(bucketName, objectName string) (*storage.ObjectHandle, error) {
+	enc := g.opts.EncryptionOr(g.encryption)
+	if err := enc.Validate(); err != nil {
+		return nil, err
+	}
+	obj := g.bucket(bucketName).Object(objectName)
+	if enc != nil && enc.Type == core.EncryptionCustomer {
+		obj = obj.Key(enc.CustomerKey)
+	}
+	return obj, nil
+}
+
+// reader returns the object handle for reads, pinned to the bound version.
+func (g *GCS) reader(bucketName, objectName string) (*storage.ObjectHandle, error) {
+	obj, err := g.object(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	return g.version(obj)
+}
+
+// version returns obj pinned to the generation bound with
+// core.Options.VersionID, or obj itself when there is none.
+func (g *GCS) version(obj *storage.ObjectHandle) (*storage.ObjectHandle, error) {
+	id := g.opts.VersionID
+	if id == "" {
+		return obj, nil
+	}
+	generation, err := parseGeneration(id)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Generation(generation), nil
+}
+
+// parseGeneration reads a version ID, which on GCS is the object generation.
+func parseGeneration(versionID string) (int64, error) {
+	generation, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("go-storage: version %q is not a GCS generation", versionID)
+	}
+	return generation, nil
+}
+
+// kmsKeyName returns the CMEK resource name when SSE-KMS is in effect.
+func (g *GCS) kmsKeyName() string {
+	enc := g.opts.EncryptionOr(g.encryption)
+	if enc != nil && enc.Type == core.EncryptionKMS {
+		return enc.KMSKeyID
+	}
+	return ""
 }
 
 func downloadFile(
 	ctx context.Context,
-	client *storage.Client,
-	bucketName, fileName, filePath string,
+	obj *storage.ObjectHandle,
+	filePath string,
 ) error {
 	// Verify if destination already exists.
 	st, err := os.Stat(filePath)
@@ -56,7 +161,6 @@ func downloadFile(
 		}
 	}
 
-	obj := client.Bucket(bucketName).Object(fileName)
 	attrs, err := obj.Attrs(ctx)
 	if err != nil {
 		return err
@@ -115,19 +219,28 @@ func downloadFile(
 	return os.Rename(filePartPath, filePath)
 }
 
-// NewEngine struct
+// NewEngine struct. URLs are signed as googleAccessID with the PEM
+// privateKey.
 func NewEngine(projectID, googleAccessID string, privateKey []byte) (*GCS, error) {
-	client, err := storage.NewClient(context.Background())
-	if err != nil {
-		return nil, err
-	}
+	return NewEngineWithOptions(
+		context.Background(),
+		projectID,
+		WithSigner(googleAccessID, privateKey),
+	)
+}
+
+// Close releases the underlying client.
+func (g *GCS) Close() error {
+	return g.client.Close()
+}
 
-	return &GCS{
-		client:     client,
-		projectID:  projectID,
-		accessID:   googleAccessID,
-		privateKey: privateKey,
-	}, nil
+// NewEngineFromCredentials builds the engine from a service account key or
+// authorized user credentials file. See NewEngineWithOptions.
+func NewEngineFromCredentials(
+	ctx context.Context,
+	projectID, credentialsPath string,
+) (*GCS, error) {
+	return NewEngineWithOptions(ctx, projectID, WithCredentialsFile(credentialsPath))
 }
 
 // UploadFile to cloud storage
@@ -137,8 +250,18 @@ func (g *GCS) UploadFile(
 	content []byte,
 	reader io.Reader,
 ) error {
-	w := g.client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
+	obj, err := g.object(bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	w := obj.NewWriter(ctx)
 	w.ContentType = core.DetectContentType(content)
+	w.KMSKeyName = g.kmsKeyName()
+	if uploadOpts := g.opts.Upload; uploadOpts != nil {
+		w.Metadata = uploadOpts.Metadata
+		w.CacheControl = uploadOpts.CacheControl
+		w.ContentEncoding = uploadOpts.ContentEncoding
+	}
 	// Fall back to the in-memory content when no reader is supplied, matching
 	// the disk and minio drivers and avoiding a nil-reader panic in io.Copy.
 	if reader == nil {
@@ -151,6 +274,12 @@ func (g *GCS) UploadFile(
 	return w.Close()
 }
 
+// ReaderIsBody reports that UploadFile uploads a non-nil reader instead of
+// content.
+func (g *GCS) ReaderIsBody() bool {
+	return true
+}
+
 // UploadFileByReader to cloud
 func (g *GCS) UploadFileByReader(
 	ctx context.Context,
@@ -158,8 +287,18 @@ func (g *GCS) UploadFileByReader(
 	reader io.Reader, contentType string,
 	length int64,
 ) error {
-	w := g.client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
+	obj, err := g.object(bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	w := obj.NewWriter(ctx)
 	w.ContentType = contentType
+	w.KMSKeyName = g.kmsKeyName()
+	if uploadOpts := g.opts.Upload; uploadOpts != nil {
+		w.Metadata = uploadOpts.Metadata
+		w.CacheControl = uploadOpts.CacheControl
+		w.ContentEncoding = uploadOpts.ContentEncoding
+	}
 	if _, err := io.Copy(w, reader); err != nil {
 		_ = w.Close()
 		return err
@@ -169,7 +308,11 @@ func (g *GCS) UploadFileByReader(
 
 // CreateBucket create bucket
 func (g *GCS) CreateBucket(ctx context.Context, bucketName, region string) error {
-	return g.client.Bucket(bucketName).Create(ctx, g.projectID, nil)
+	bucket := g.bucket(bucketName)
+	if g.opts.ObjectLock {
+		bucket = bucket.SetObjectRetention(true)
+	}
+	return bucket.Create(ctx, g.projectID, nil)
 }
 
 // FilePath for store path + file name
@@ -177,16 +320,21 @@ func (g *GCS) FilePath(bucketName, fileName string) string {
 	return g.GetFileURL(bucketName, fileName)
 }
 
-// DeleteFile delete file
+// DeleteFile delete file. On a versioned bucket the object becomes
+// noncurrent, unless a version is given, which is deleted for good.
 func (g *GCS) DeleteFile(ctx context.Context, bucketName, fileName string) error {
-	return g.client.Bucket(bucketName).Object(fileName).Delete(ctx)
+	obj, err := g.version(g.bucket(bucketName).Object(fileName))
+	if err != nil {
+		return err
+	}
+	return notExist(obj.Delete(ctx))
 }
 
 // GetFileURL for storage host + bucket + filename
 func (g *GCS) GetFileURL(bucketName, fileName string) string {
 	// path.Join must not see the scheme, or it collapses "https://" into
 	// "https:/"; only join the bucket/object portion of the path.
-	return "https://storage.googleapis.com/" + path.Join(bucketName, fileName)
+	return g.host + "/" + path.Join(bucketName, fileName)
 }
 
 // DownloadFile downloads and saves the object as a file in the local filesystem.
@@ -194,7 +342,11 @@ func (g *GCS) DownloadFile(
 	ctx context.Context,
 	bucketName, objectName, filePath string,
 ) error {
-	return downloadFile(ctx, g.client, bucketName, objectName, filePath)
+	obj, err := g.reader(bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	return notExist(downloadFile(ctx, obj, filePath))
 }
 
 // DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
@@ -203,15 +355,23 @@ func (g *GCS) DownloadFileByProgress(
 	bucketName, objectName, filePath string,
 	_ *pb.ProgressBar,
 ) error {
-	return downloadFile(ctx, g.client, bucketName, objectName, filePath)
+	obj, err := g.reader(bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	return notExist(downloadFile(ctx, obj, filePath))
 }
 
 // GetContent for storage bucket + filename
 func (g *GCS) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
-	r, err := g.client.Bucket(bucketName).Object(fileName).NewReader(ctx)
+	obj, err := g.reader(bucketName, fileName)
 	if err != nil {
 		return nil, err
 	}
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, notExist(err)
+	}
 	defer r.Close()
 
 	return io.ReadAll(r)
@@ -219,22 +379,137 @@ func (g *GCS) GetContent(ctx context.Context, bucketName, fileName string) ([]by
 
 // CopyFile copy src to dest
 func (g *GCS) CopyFile(ctx context.Context, srcBucket, srcPath, destBucket, destPath string) error {
-	src := g.client.Bucket(srcBucket).Object(srcPath)
-	dst := g.client.Bucket(destBucket).Object(destPath)
-	_, err := dst.CopierFrom(src).Run(ctx)
-	return err
+	// The same settings decrypt a CSEK source and encrypt the destination.
+	src, err := g.reader(srcBucket, srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := g.object(destBucket, destPath)
+	if err != nil {
+		return err
+	}
+	copier := dst.CopierFrom(src)
+	copier.DestinationKMSKeyName = g.kmsKeyName()
+	_, err = copier.Run(ctx)
+	return notExist(err)
 }
 
 // FileExist check object exist. bucket + filename
 func (g *GCS) FileExist(ctx context.Context, bucketName, fileName string) bool {
+	obj, err := g.reader(bucketName, fileName)
+	if err != nil {
+		return false
+	}
 	// Check if file exists
-	_, err := g.client.Bucket(bucketName).Object(fileName).Attrs(ctx)
+	_, err = obj.Attrs(ctx)
 	return err == nil
 }
 
+// StatFile returns the object attributes. bucket + filename
+func (g *GCS) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	obj, err := g.reader(bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, notExist(err)
+	}
+	return objectInfo(bucketName, attrs), nil
+}
+
+// NewReader streams the stored bytes of the generation that was stated, so
+// the attributes describe the content even when the object is overwritten.
+// Objects with a Content-Encoding are not transcoded.
+func (g *GCS) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	obj, err := g.reader(bucketName, fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	r, err := obj.Generation(attrs.Generation).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	return r, objectInfo(bucketName, attrs), nil
+}
+
+func objectInfo(bucketName string, attrs *storage.ObjectAttrs) *core.ObjectInfo {
+	return &core.ObjectInfo{
+		Bucket:          bucketName,
+		Name:            attrs.Name,
+		Size:            attrs.Size,
+		ContentType:     attrs.ContentType,
+		CacheControl:    attrs.CacheControl,
+		ETag:            attrs.Etag,
+		LastModified:    attrs.Updated,
+		Metadata:        core.LowerKeys(attrs.Metadata),
+		VersionID:       strconv.FormatInt(attrs.Generation, 10),
+		ContentEncoding: attrs.ContentEncoding,
+		Encryption:      encryptionOf(attrs),
+	}
+}
+
+// notExist marks the errors of missing objects and buckets for
+// core.IsNotExist.
+func notExist(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return core.NotExist(err)
+	}
+	return err
+}
+
+// encryptionOf reports customer-supplied and KMS keys; other objects use
+// the Google-managed default.
+func encryptionOf(attrs *storage.ObjectAttrs) core.EncryptionType {
+	switch {
+	case attrs.CustomerKeySHA256 != "":
+		return core.EncryptionCustomer
+	case attrs.KMSKeyName != "":
+		return core.EncryptionKMS
+	}
+	return core.EncryptionNone
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (g *GCS) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	var objects []core.ObjectInfo
+	it := g.bucket(bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, notExist(err)
+		}
+		objects = append(objects, core.ObjectInfo{
+			Bucket:       bucketName,
+			Name:         attrs.Name,
+			Size:         attrs.Size,
+			ContentType:  attrs.ContentType,
+			ETag:         attrs.Etag,
+			LastModified: attrs.Updated,
+			Metadata:     core.LowerKeys(attrs.Metadata),
+		})
+	}
+}
+
 // BucketExists Checks if a bucket exists.
 func (g *GCS) BucketExists(ctx context.Context, bucketName string) (found bool, err error) {
-	_, err = g.client.Bucket(bucketName).Attrs(ctx)
+	_, err = g.bucket(bucketName).Attrs(ctx)
 	// A missing bucket is the normal "does not exist" case, not a failure.
 	if errors.Is(err, storage.ErrBucketNotExist) {
 		return false, nil
@@ -247,7 +522,9 @@ func (g *GCS) Client() interface{} {
 	return g.client
 }
 
-// SignedURL support signed URL
+// SignedURL returns a V4 signed download URL. It signs with the configured
+// private key, or through the IAM Credentials signBlob API as the access ID
+// when there is none, as on Workload Identity.
 func (g *GCS) SignedURL(
 	ctx context.Context,
 	bucketName, fileName string,
@@ -257,22 +534,60 @@ func (g *GCS) SignedURL(
 		return "", errors.New("go-storage: opts cannot be nil")
 	}
 
+	// A CSEK object can only be inspected with its key. The signed URL itself
+	// cannot carry the key: whoever fetches it must send the key headers.
+	obj, err := g.object(bucketName, fileName)
+	if err != nil {
+		return "", err
+	}
+	query := opts.ResponseParams()
+	if opts.VersionID != "" {
+		generation, err := parseGeneration(opts.VersionID)
+		if err != nil {
+			return "", err
+		}
+		obj = obj.Generation(generation)
+		query.Set("generation", opts.VersionID)
+	}
+
 	// Check if file exists
-	if _, err := g.client.Bucket(bucketName).Object(fileName).Attrs(ctx); err != nil {
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
 		return "", err
 	}
+	if opts.ContentType == "" && attrs.ContentType != "" {
+		query.Set("response-content-type", attrs.ContentType)
+	}
 
-	return storage.SignedURL(
-		bucketName,
-		fileName,
-		&storage.SignedURLOptions{
-			GoogleAccessID: g.accessID,
-			PrivateKey:     g.privateKey,
-			Method:         "GET",
-			Expires:        time.Now().UTC().Add(opts.Expiry),
-		})
+	signOpts := &storage.SignedURLOptions{
+		Scheme:          storage.SigningSchemeV4,
+		Method:          http.MethodGet,
+		Expires:         time.Now().UTC().Add(opts.Expiry),
+		GoogleAccessID:  g.accessID,
+		PrivateKey:      g.privateKey,
+		QueryParameters: query,
+	}
+	if len(g.privateKey) == 0 && g.accessID != "" {
+		signOpts.PrivateKey = nil
+		signOpts.SignBytes = g.signBlob(ctx)
+	}
+	return g.bucket(bucketName).SignedURL(fileName, signOpts)
 }
 
-func (g *GCS) SetLifeCycle(_ context.Context, _ string, _ *core.LifecycleConfig) error {
-	return nil
+// signBlob signs through the IAM Credentials API as g.accessID.
+func (g *GCS) signBlob(ctx context.Context) func([]byte) ([]byte, error) {
+	return func(payload []byte) ([]byte, error) {
+		svc, err := iamcredentials.NewService(ctx, g.iamOptions...)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := svc.Projects.ServiceAccounts.SignBlob(
+			"projects/-/serviceAccounts/"+g.accessID,
+			&iamcredentials.SignBlobRequest{Payload: base64.StdEncoding.EncodeToString(payload)},
+		).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("go-storage: signBlob as %s: %w", g.accessID, err)
+		}
+		return base64.StdEncoding.DecodeString(resp.SignedBlob)
+	}
 }
@@ -0,0 +1,138 @@
+package gcs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGCS serves object attributes like the JSON API and signs blobs like
+// the IAM Credentials API, with key.
+func fakeGCS(t *testing.T, key *rsa.PrivateKey, signed *[]byte) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	attrs := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"bucket":      "photos",
+			"name":        r.PathValue("name"),
+			"contentType": "image/jpeg",
+		})
+	}
+	signBlob := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "signer@project.iam.gserviceaccount.com:signBlob", r.PathValue("account"))
+		var req struct {
+			Payload string `json:"payload"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		payload, err := base64.StdEncoding.DecodeString(req.Payload)
+		assert.NoError(t, err)
+		*signed = payload
+		sum := sha256.Sum256(payload)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"keyId":      "k1",
+			"signedBlob": base64.StdEncoding.EncodeToString(sig),
+		})
+	}
+	mux.HandleFunc("GET /storage/v1/b/photos/o/{name...}", attrs)
+	mux.HandleFunc("POST /v1/projects/-/serviceAccounts/{account}", signBlob)
+	return httptest.NewServer(mux)
+}
+
+func TestSignedURLSignBlob(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	var signed []byte
+	srv := fakeGCS(t, key, &signed)
+	defer srv.Close()
+
+	g, err := NewEngineWithOptions(context.Background(), "project",
+		WithEndpoint(srv.URL+"/storage/v1/"),
+		WithIAMEndpoint(srv.URL+"/"),
+		WithHTTPClient(srv.Client()),
+		WithSigner("signer@project.iam.gserviceaccount.com", nil),
+	)
+	assert.NoError(t, err)
+	defer g.Close()
+
+	_, err = g.SignedURL(context.Background(), "photos", "a.jpg", nil)
+	assert.Error(t, err)
+
+	signedURL, err := g.SignedURL(context.Background(), "photos", "2024/a.jpg",
+		&core.SignedURLOptions{Expiry: 15 * time.Minute, DefaultFilename: "a.jpg"})
+	assert.NoError(t, err)
+	u, err := url.Parse(signedURL)
+	assert.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, "/photos/2024/a.jpg", u.Path)
+	assert.Equal(t, "GOOG4-RSA-SHA256", q.Get("X-Goog-Algorithm"))
+	assert.NotEmpty(t, q.Get("X-Goog-Expires"))
+	assert.True(t, strings.HasPrefix(q.Get("X-Goog-Credential"), "signer@project"))
+	assert.Equal(t, `attachment; filename="a.jpg"`, q.Get("response-content-disposition"))
+	assert.Equal(t, "image/jpeg", q.Get("response-content-type"))
+
+	signedURL, err = g.SignedURL(context.Background(), "photos", "2024/a.jpg",
+		&core.SignedURLOptions{
+			Expiry:          time.Minute,
+			DefaultFilename: "café.jpg",
+			Inline:          true,
+			ContentType:     "application/octet-stream",
+			VersionID:       "1700000000000000",
+		})
+	assert.NoError(t, err)
+	u, err = url.Parse(signedURL)
+	assert.NoError(t, err)
+	q = u.Query()
+	assert.Equal(t, `inline; filename="caf_.jpg"; filename*=UTF-8''caf%C3%A9.jpg`,
+		q.Get("response-content-disposition"))
+	assert.Equal(t, "application/octet-stream", q.Get("response-content-type"))
+	assert.Equal(t, "1700000000000000", q.Get("generation"))
+
+	_, err = g.SignedURL(context.Background(), "photos", "2024/a.jpg",
+		&core.SignedURLOptions{VersionID: "latest"})
+	assert.Error(t, err)
+
+	// The signature in the URL is the stand-in's signature of the V4
+	// string to sign.
+	assert.True(t, strings.HasPrefix(string(signed), "GOOG4-RSA-SHA256\n"))
+	sig, err := hex.DecodeString(q.Get("X-Goog-Signature"))
+	assert.NoError(t, err)
+	sum := sha256.Sum256(signed)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig))
+}
+
+func TestEncryptionOf(t *testing.T) {
+	assert.Equal(t, core.EncryptionNone, encryptionOf(&storage.ObjectAttrs{}))
+	assert.Equal(t, core.EncryptionKMS, encryptionOf(&storage.ObjectAttrs{KMSKeyName: "k"}))
+	assert.Equal(t, core.EncryptionCustomer,
+		encryptionOf(&storage.ObjectAttrs{CustomerKeySHA256: "sum"}))
+}
+
+func TestNotExist(t *testing.T) {
+	err := notExist(storage.ErrObjectNotExist)
+	assert.True(t, core.IsNotExist(err))
+	assert.ErrorIs(t, err, storage.ErrObjectNotExist)
+	assert.Equal(t, storage.ErrObjectNotExist.Error(), err.Error())
+	assert.True(t, core.IsNotExist(notExist(storage.ErrBucketNotExist)))
+	assert.False(t, core.IsNotExist(notExist(context.Canceled)))
+	assert.NoError(t, notExist(nil))
+}
@@ -0,0 +1,207 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/appleboy/go-storage/core"
+
+	"cloud.google.com/go/storage"
+)
+
+// SetLifeCycle merges the rules into the bucket lifecycle. GCS rules have no
+// IDs and one action each, so every core.LifecycleRule is stored as one GCS
+// rule per action and rules are matched by prefix instead: the rules set
+// replace the existing ones with the same prefix. Tag filters and disabled
+// rules are not supported.
+func (g *GCS) SetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	rules, err := opts.LifecycleRules(bucketName)
+	if err != nil {
+		return err
+	}
+	prefixes := map[string]bool{}
+	var added []storage.LifecycleRule
+	for _, r := range rules {
+		switch {
+		case len(r.Tags) > 0:
+			return fmt.Errorf("go-storage: gcs lifecycle rule %q cannot filter by tags", r.ID)
+		case r.Disabled:
+			return fmt.Errorf("go-storage: gcs lifecycle rule %q cannot be disabled", r.ID)
+		case prefixes[r.Prefix]:
+			return fmt.Errorf("go-storage: gcs lifecycle rules are matched by prefix; "+
+				"prefix %q is used twice", r.Prefix)
+		}
+		prefixes[r.Prefix] = true
+		added = append(added, toRules(r)...)
+	}
+	return g.updateLifecycle(ctx, bucketName,
+		func(current []storage.LifecycleRule) []storage.LifecycleRule {
+			kept := slices.DeleteFunc(current, func(r storage.LifecycleRule) bool {
+				part, ok := fromRule(r)
+				return ok && prefixes[part.Prefix]
+			})
+			return append(kept, added...)
+		})
+}
+
+// GetLifeCycle returns the bucket lifecycle, one rule per prefix with the
+// prefix as its ID. GCS rules with other conditions are left out.
+func (g *GCS) GetLifeCycle(ctx context.Context, bucketName string) (*core.LifecycleConfig, error) {
+	attrs, err := g.bucket(bucketName).Attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &core.LifecycleConfig{}
+	index := map[string]int{}
+	for _, r := range attrs.Lifecycle.Rules {
+		part, ok := fromRule(r)
+		if !ok {
+			continue
+		}
+		i, seen := index[part.Prefix]
+		if !seen {
+			i = len(cfg.Rules)
+			index[part.Prefix] = i
+			cfg.Rules = append(cfg.Rules, core.LifecycleRule{ID: part.Prefix, Prefix: part.Prefix})
+		}
+		merge(&cfg.Rules[i], part)
+	}
+	return cfg, nil
+}
+
+// DeleteLifeCycle removes the rules of the given prefixes, as reported as
+// IDs by GetLifeCycle, or every rule when no ID is given.
+func (g *GCS) DeleteLifeCycle(ctx context.Context, bucketName string, ids ...string) error {
+	return g.updateLifecycle(ctx, bucketName,
+		func(current []storage.LifecycleRule) []storage.LifecycleRule {
+			if len(ids) == 0 {
+				return nil
+			}
+			return slices.DeleteFunc(current, func(r storage.LifecycleRule) bool {
+				part, ok := fromRule(r)
+				return ok && slices.Contains(ids, part.Prefix)
+			})
+		})
+}
+
+// updateLifecycle rewrites the bucket lifecycle, failing rather than losing
+// a concurrent change.
+func (g *GCS) updateLifecycle(
+	ctx context.Context,
+	bucketName string,
+	update func([]storage.LifecycleRule) []storage.LifecycleRule,
+) error {
+	b := g.bucket(bucketName)
+	attrs, err := b.Attrs(ctx)
+	if err != nil {
+		return err
+	}
+	rules := update(attrs.Lifecycle.Rules)
+	_, err = b.If(storage.BucketConditions{MetagenerationMatch: attrs.MetaGeneration}).
+		Update(ctx, storage.BucketAttrsToUpdate{Lifecycle: &storage.Lifecycle{Rules: rules}})
+	return err
+}
+
+// toRules returns the GCS rules for the actions of r.
+func toRules(r core.LifecycleRule) []storage.LifecycleRule {
+	var prefix []string
+	if r.Prefix != "" {
+		prefix = []string{r.Prefix}
+	}
+	var rules []storage.LifecycleRule
+	if r.ExpirationDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action: storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{
+				AgeInDays:     int64(r.ExpirationDays),
+				MatchesPrefix: prefix,
+			},
+		})
+	}
+	if t := r.Transition; t != nil {
+		rules = append(rules, storage.LifecycleRule{
+			Action: storage.LifecycleAction{
+				Type:         storage.SetStorageClassAction,
+				StorageClass: t.StorageClass,
+			},
+			Condition: storage.LifecycleCondition{
+				AgeInDays:     int64(t.Days),
+				AllObjects:    t.Days == 0,
+				MatchesPrefix: prefix,
+			},
+		})
+	}
+	if r.NoncurrentExpirationDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action: storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{
+				DaysSinceNoncurrentTime: int64(r.NoncurrentExpirationDays),
+				MatchesPrefix:           prefix,
+			},
+		})
+	}
+	if r.AbortIncompleteUploadDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action: storage.LifecycleAction{Type: storage.AbortIncompleteMPUAction},
+			Condition: storage.LifecycleCondition{
+				AgeInDays:     int64(r.AbortIncompleteUploadDays),
+				MatchesPrefix: prefix,
+			},
+		})
+	}
+	return rules
+}
+
+// fromRule returns the core rule holding the action of a GCS rule, and
+// false for GCS rules that toRules does not produce.
+func fromRule(r storage.LifecycleRule) (core.LifecycleRule, bool) {
+	var part core.LifecycleRule
+	if n := len(r.Condition.MatchesPrefix); n > 1 {
+		return part, false
+	} else if n == 1 {
+		part.Prefix = r.Condition.MatchesPrefix[0]
+	}
+	days := int(r.Condition.AgeInDays)
+	switch r.Action.Type {
+	case storage.DeleteAction:
+		if r.Condition.DaysSinceNoncurrentTime > 0 {
+			part.NoncurrentExpirationDays = int(r.Condition.DaysSinceNoncurrentTime)
+		} else {
+			part.ExpirationDays = days
+		}
+	case storage.SetStorageClassAction:
+		part.Transition = &core.LifecycleTransition{Days: days, StorageClass: r.Action.StorageClass}
+	case storage.AbortIncompleteMPUAction:
+		part.AbortIncompleteUploadDays = days
+	default:
+		return part, false
+	}
+	// Any other condition makes it a rule set by someone else.
+	canonical := toRules(part)
+	if len(r.Condition.MatchesPrefix) == 0 {
+		r.Condition.MatchesPrefix = nil
+	}
+	return part, len(canonical) == 1 && reflect.DeepEqual(canonical[0], r)
+}
+
+// merge adds the action of part to rule.
+func merge(rule *core.LifecycleRule, part core.LifecycleRule) {
+	if part.ExpirationDays != 0 {
+		rule.ExpirationDays = part.ExpirationDays
+	}
+	if part.NoncurrentExpirationDays != 0 {
+		rule.NoncurrentExpirationDays = part.NoncurrentExpirationDays
+	}
+	if part.AbortIncompleteUploadDays != 0 {
+		rule.AbortIncompleteUploadDays = part.AbortIncompleteUploadDays
+	}
+	if rule.Transition == nil {
+		rule.Transition = part.Transition
+	}
+}
@@ -0,0 +1,101 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBucket serves one bucket's metadata like the JSON API, applying
+// patches to its lifecycle.
+func fakeBucket(t *testing.T, lifecycle string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	bucket := map[string]any{"name": "photos", "metageneration": "1"}
+	assert.NoError(t, json.Unmarshal([]byte(`{"lifecycle":`+lifecycle+`}`), &bucket))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/storage/v1/b/photos", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPatch {
+			assert.Equal(t, bucket["metageneration"], r.URL.Query().Get("ifMetagenerationMatch"))
+			var patch map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			bucket["lifecycle"] = patch["lifecycle"]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(bucket)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestLifecycle(t *testing.T) {
+	// A rule set elsewhere, with a condition core rules cannot express.
+	srv := fakeBucket(t,
+		`{"rule":[{"action":{"type":"Delete"},"condition":{"numNewerVersions":3}}]}`)
+	defer srv.Close()
+	g, err := NewEngineWithOptions(context.Background(), "project",
+		WithEndpoint(srv.URL+"/storage/v1/"),
+		WithHTTPClient(srv.Client()),
+	)
+	assert.NoError(t, err)
+	defer g.Close()
+	ctx := context.Background()
+
+	cfg, err := g.GetLifeCycle(ctx, "photos")
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Rules)
+
+	coldline := &core.LifecycleTransition{Days: 30, StorageClass: "COLDLINE"}
+	assert.NoError(t, g.SetLifeCycle(ctx, "photos", &core.LifecycleConfig{
+		Days:   30,
+		Prefix: "tmp/",
+		Rules: []core.LifecycleRule{{
+			ID:                        "logs",
+			Prefix:                    "logs/",
+			ExpirationDays:            365,
+			Transition:                coldline,
+			NoncurrentExpirationDays:  7,
+			AbortIncompleteUploadDays: 1,
+		}},
+	}))
+	// Setting the same prefix again replaces its rule.
+	assert.NoError(t, g.SetLifeCycle(ctx, "photos", &core.LifecycleConfig{Days: 1, Prefix: "tmp/"}))
+
+	cfg, err = g.GetLifeCycle(ctx, "photos")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.LifecycleRule{
+		{
+			ID:                        "logs/",
+			Prefix:                    "logs/",
+			ExpirationDays:            365,
+			Transition:                coldline,
+			NoncurrentExpirationDays:  7,
+			AbortIncompleteUploadDays: 1,
+		},
+		{ID: "tmp/", Prefix: "tmp/", ExpirationDays: 1},
+	}, cfg.Rules)
+
+	assert.NoError(t, g.DeleteLifeCycle(ctx, "photos", "logs/"))
+	attrs, err := g.bucket("photos").Attrs(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, attrs.Lifecycle.Rules, 2)
+	assert.Equal(t, int64(3), attrs.Lifecycle.Rules[0].Condition.NumNewerVersions)
+
+	err = g.SetLifeCycle(ctx, "photos", &core.LifecycleConfig{Rules: []core.LifecycleRule{
+		{ID: "tagged", Tags: map[string]string{"a": "b"}, ExpirationDays: 1},
+	}})
+	assert.Error(t, err)
+
+	assert.NoError(t, g.DeleteLifeCycle(ctx, "photos"))
+	attrs, err = g.bucket("photos").Attrs(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, attrs.Lifecycle.Rules)
+}
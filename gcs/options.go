@@ -0,0 +1,203 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// defaultHost serves public object URLs when no endpoint is configured.
+const defaultHost = "https://storage.googleapis.com"
+
+// Option configures the engine built by NewEngineWithOptions.
+type Option func(*options)
+
+type options struct {
+	credentialsJSON []byte
+	credentialsFile string
+	endpoint        string
+	httpClient      *http.Client
+	userProject     string
+	accessID        string
+	privateKey      []byte
+	iamEndpoint     string
+	clientOptions   []option.ClientOption
+}
+
+// WithCredentialsFile authenticates with a service account key or authorized
+// user credentials file. Without credentials the engine uses Application
+// Default Credentials.
+func WithCredentialsFile(path string) Option {
+	return func(o *options) {
+		o.credentialsFile = path
+	}
+}
+
+// WithCredentialsJSON is WithCredentialsFile for credentials already in
+// memory.
+func WithCredentialsJSON(content []byte) Option {
+	return func(o *options) {
+		o.credentialsJSON = content
+	}
+}
+
+// WithEndpoint points the engine at another JSON API endpoint, such as
+// fake-gcs-server at "http://localhost:4443/storage/v1/". GetFileURL uses
+// its host too. $STORAGE_EMULATOR_HOST is honored without it.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithHTTPClient sends every request through client. The client must
+// authenticate the requests itself.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithUserProject bills requests to project, for requester-pays buckets.
+func WithUserProject(project string) Option {
+	return func(o *options) {
+		o.userProject = project
+	}
+}
+
+// WithSigner signs URLs as accessID with the PEM private key, instead of the
+// key from a service account credentials file.
+func WithSigner(accessID string, privateKey []byte) Option {
+	return func(o *options) {
+		o.accessID = accessID
+		o.privateKey = privateKey
+	}
+}
+
+// WithIAMEndpoint overrides the IAM Credentials API endpoint used to sign
+// URLs without a private key.
+func WithIAMEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.iamEndpoint = endpoint
+	}
+}
+
+// WithClientOptions passes extra options to storage.NewClient.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *options) {
+		o.clientOptions = append(o.clientOptions, opts...)
+	}
+}
+
+// credentialsFile holds the fields of a Google credentials JSON file used
+// here.
+type credentialsFile struct {
+	Type        string `json:"type"`
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// NewEngineWithOptions struct. A service account key passed as credentials
+// also supplies the identity and private key that sign URLs, and the project
+// when projectID is empty.
+func NewEngineWithOptions(ctx context.Context, projectID string, opts ...Option) (*GCS, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	source := "credentials"
+	if o.credentialsFile != "" {
+		content, err := os.ReadFile(o.credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		o.credentialsJSON = content
+		source = o.credentialsFile
+	}
+
+	g := &GCS{
+		projectID:   projectID,
+		accessID:    o.accessID,
+		privateKey:  o.privateKey,
+		userProject: o.userProject,
+		host:        publicHost(o.endpoint),
+	}
+	// authOptions are shared by the storage client and signBlob.
+	authOptions := []option.ClientOption{}
+	if o.credentialsJSON != nil {
+		var creds credentialsFile
+		if err := json.Unmarshal(o.credentialsJSON, &creds); err != nil {
+			return nil, fmt.Errorf("go-storage: %s: %w", source, err)
+		}
+		var credType option.CredentialsType
+		switch creds.Type {
+		case "service_account":
+			credType = option.ServiceAccount
+		case "authorized_user":
+			credType = option.AuthorizedUser
+		default:
+			return nil, fmt.Errorf(
+				"go-storage: %s: unsupported credentials type %q", source, creds.Type,
+			)
+		}
+		authOptions = append(authOptions,
+			option.WithAuthCredentialsJSON(credType, o.credentialsJSON))
+		if g.projectID == "" {
+			g.projectID = creds.ProjectID
+		}
+		if g.accessID == "" && creds.PrivateKey != "" {
+			g.accessID = creds.ClientEmail
+			g.privateKey = []byte(creds.PrivateKey)
+		}
+	}
+	if o.httpClient != nil {
+		authOptions = append(authOptions, option.WithHTTPClient(o.httpClient))
+	}
+
+	g.iamOptions = slices.Clone(authOptions)
+	if o.iamEndpoint != "" {
+		g.iamOptions = append(g.iamOptions, option.WithEndpoint(o.iamEndpoint))
+	}
+
+	clientOptions := slices.Clone(authOptions)
+	if o.endpoint != "" {
+		clientOptions = append(clientOptions, option.WithEndpoint(o.endpoint))
+	}
+	clientOptions = append(clientOptions, o.clientOptions...)
+
+	client, err := storage.NewClient(ctx, clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	g.client = client
+	return g, nil
+}
+
+// publicHost returns the scheme and host for object URLs: the endpoint's,
+// the emulator's, or storage.googleapis.com.
+func publicHost(endpoint string) string {
+	if endpoint == "" {
+		endpoint = os.Getenv("STORAGE_EMULATOR_HOST")
+	}
+	if endpoint == "" {
+		return defaultHost
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return defaultHost
+	}
+	return u.Scheme + "://" + u.Host
+}
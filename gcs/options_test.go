@@ -0,0 +1,90 @@
+package gcs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointAndUserProject(t *testing.T) {
+	var gotPath, gotProject string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotProject = r.URL.Query().Get("userProject")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"photos"}`))
+	}))
+	defer srv.Close()
+
+	g, err := NewEngineWithOptions(context.Background(), "project",
+		WithEndpoint(srv.URL+"/storage/v1/"),
+		WithHTTPClient(srv.Client()),
+		WithUserProject("billing"),
+	)
+	assert.NoError(t, err)
+	defer g.Close()
+
+	found, err := g.BucketExists(context.Background(), "photos")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "/storage/v1/b/photos", gotPath)
+	assert.Equal(t, "billing", gotProject)
+	assert.Equal(t, srv.URL+"/photos/a/b.jpg", g.GetFileURL("photos", "a/b.jpg"))
+}
+
+func TestServiceAccountSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	content, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "from-key",
+		"client_email": "uploader@from-key.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    "https://oauth2.googleapis.com/token",
+	})
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(file, content, 0o600))
+
+	g, err := NewEngineWithOptions(context.Background(), "", WithCredentialsFile(file))
+	assert.NoError(t, err)
+	defer g.Close()
+	assert.Equal(t, "from-key", g.projectID)
+	assert.Equal(t, "uploader@from-key.iam.gserviceaccount.com", g.accessID)
+	assert.Equal(t, keyPEM, g.privateKey)
+	assert.Equal(t, "https://storage.googleapis.com/a/b", g.GetFileURL("a", "b"))
+
+	// An explicit signer wins over the key file.
+	g, err = NewEngineWithOptions(context.Background(), "other",
+		WithCredentialsJSON(content), WithSigner("signer@x", []byte("pem")))
+	assert.NoError(t, err)
+	defer g.Close()
+	assert.Equal(t, "other", g.projectID)
+	assert.Equal(t, "signer@x", g.accessID)
+
+	_, err = NewEngineWithOptions(context.Background(), "",
+		WithCredentialsJSON([]byte(`{"type":"external_account"}`)))
+	assert.ErrorContains(t, err, `unsupported credentials type "external_account"`)
+}
+
+func TestPublicHost(t *testing.T) {
+	t.Setenv("STORAGE_EMULATOR_HOST", "localhost:4443")
+	assert.Equal(t, "http://localhost:4443", publicHost(""))
+	assert.Equal(t, "https://gcs.example.com", publicHost("https://gcs.example.com/storage/v1/"))
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	assert.Equal(t, defaultHost, publicHost(""))
+}
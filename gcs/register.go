@@ -0,0 +1,41 @@
+package gcs
+
+import (
+	"context"
+
+	gostorage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+)
+
+func init() {
+	gostorage.Register("gcs", func(
+		ctx context.Context,
+		cfg gostorage.Config,
+	) (core.Storage, error) {
+		engine, err := NewEngineWithOptions(ctx, cfg.ProjectID, optionsFromConfig(cfg)...)
+		if err != nil {
+			return nil, err
+		}
+		if err := engine.SetEncryption(cfg.Encryption); err != nil {
+			return nil, err
+		}
+		return engine, nil
+	})
+}
+
+func optionsFromConfig(cfg gostorage.Config) []Option {
+	opts := []Option{
+		WithEndpoint(cfg.Endpoint),
+		WithUserProject(cfg.UserProject),
+	}
+	if cfg.AccessID != "" || cfg.SecretKey != "" {
+		opts = append(opts, WithSigner(cfg.AccessID, []byte(cfg.SecretKey)))
+	}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if cfg.CredentialsJSON != "" {
+		opts = append(opts, WithCredentialsJSON([]byte(cfg.CredentialsJSON)))
+	}
+	return opts
+}
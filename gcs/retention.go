@@ -0,0 +1,144 @@
+package gcs
+
+import (
+	"context"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCS object retention modes. Unlocked retention maps to governance mode:
+// it can be shortened or removed with core.Options.GovernanceBypass.
+const (
+	retentionUnlocked = "Unlocked"
+	retentionLocked   = "Locked"
+)
+
+// SetBucketRetention sets the bucket retention policy, which GCS applies to
+// every object, old and new. Compliance mode locks the policy, which can then
+// never be removed or shortened, nor the bucket deleted while it holds
+// objects.
+func (g *GCS) SetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+	retention *core.BucketRetention,
+) error {
+	// A zero retention period removes the policy.
+	policy := &storage.RetentionPolicy{}
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+		now := time.Now()
+		policy.RetentionPeriod = retention.RetainUntil(now).Sub(now)
+	}
+	attrs, err := g.bucket(bucketName).Update(ctx, storage.BucketAttrsToUpdate{
+		RetentionPolicy: policy,
+	})
+	if err != nil || retention == nil || retention.Mode != core.RetentionCompliance {
+		return err
+	}
+	return g.bucket(bucketName).
+		If(storage.BucketConditions{MetagenerationMatch: attrs.MetaGeneration}).
+		LockRetentionPolicy(ctx)
+}
+
+// GetBucketRetention returns the bucket retention policy, in days, or nil
+// when there is none. A locked policy reports compliance mode.
+func (g *GCS) GetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+) (*core.BucketRetention, error) {
+	attrs, err := g.bucket(bucketName).Attrs(ctx)
+	if err != nil || attrs.RetentionPolicy == nil {
+		return nil, err
+	}
+	retention := &core.BucketRetention{
+		Mode: core.RetentionGovernance,
+		Days: int(attrs.RetentionPolicy.RetentionPeriod / (24 * time.Hour)),
+	}
+	if attrs.RetentionPolicy.IsLocked {
+		retention.Mode = core.RetentionCompliance
+	}
+	return retention, nil
+}
+
+// SetObjectRetention sets the retention of an object generation. The bucket
+// must have been created with core.Options.ObjectLock.
+func (g *GCS) SetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+	retention *core.ObjectRetention,
+) error {
+	obj, err := g.version(g.bucket(bucketName).Object(fileName))
+	if err != nil {
+		return err
+	}
+	// An empty retention removes it.
+	update := &storage.ObjectRetention{}
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+		update.Mode, update.RetainUntil = retentionUnlocked, retention.RetainUntil
+		if retention.Mode == core.RetentionCompliance {
+			update.Mode = retentionLocked
+		}
+	}
+	if g.opts.GovernanceBypass {
+		obj = obj.OverrideUnlockedRetention(true)
+	}
+	_, err = obj.Update(ctx, storage.ObjectAttrsToUpdate{Retention: update})
+	return err
+}
+
+// GetObjectRetention returns the retention of an object generation, or nil
+// when there is none.
+func (g *GCS) GetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectRetention, error) {
+	obj, err := g.version(g.bucket(bucketName).Object(fileName))
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if err != nil || attrs.Retention == nil {
+		return nil, err
+	}
+	retention := &core.ObjectRetention{
+		Mode:        core.RetentionGovernance,
+		RetainUntil: attrs.Retention.RetainUntil,
+	}
+	if attrs.Retention.Mode == retentionLocked {
+		retention.Mode = core.RetentionCompliance
+	}
+	return retention, nil
+}
+
+// SetLegalHold places or releases a temporary hold, the GCS hold that, like
+// a legal hold, lasts until released. Event-based holds, which start the
+// bucket retention period when released, are left alone.
+func (g *GCS) SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error {
+	obj, err := g.version(g.bucket(bucketName).Object(fileName))
+	if err != nil {
+		return err
+	}
+	_, err = obj.Update(ctx, storage.ObjectAttrsToUpdate{TemporaryHold: hold})
+	return err
+}
+
+// GetLegalHold reports whether an object generation is under temporary hold.
+func (g *GCS) GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error) {
+	obj, err := g.version(g.bucket(bucketName).Object(fileName))
+	if err != nil {
+		return false, err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return false, err
+	}
+	return attrs.TemporaryHold, nil
+}
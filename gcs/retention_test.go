@@ -0,0 +1,100 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		override string
+	)
+	bucket := map[string]any{"name": "records", "metageneration": "3"}
+	object := map[string]any{"bucket": "records", "name": "a.txt", "generation": "7"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/storage/v1/b/records", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPatch {
+			var patch map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			policy := patch["retentionPolicy"].(map[string]any)
+			policy["effectiveTime"] = "2024-01-01T00:00:00Z"
+			bucket["retentionPolicy"] = policy
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(bucket)
+	})
+	mux.HandleFunc("/storage/v1/b/records/lockRetentionPolicy",
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, "3", r.URL.Query().Get("ifMetagenerationMatch"))
+			bucket["retentionPolicy"].(map[string]any)["isLocked"] = true
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(bucket)
+		})
+	mux.HandleFunc("/storage/v1/b/records/o/a.txt", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPatch {
+			override = r.URL.Query().Get("overrideUnlockedRetention")
+			var patch map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			for k, v := range patch {
+				object[k] = v
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(object)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	g, err := NewEngineWithOptions(context.Background(), "project",
+		WithEndpoint(srv.URL+"/storage/v1/"),
+		WithHTTPClient(srv.Client()),
+	)
+	assert.NoError(t, err)
+	defer g.Close()
+	ctx := context.Background()
+
+	retention, err := g.GetBucketRetention(ctx, "records")
+	assert.NoError(t, err)
+	assert.Nil(t, retention)
+	assert.NoError(t, g.SetBucketRetention(ctx, "records", &core.BucketRetention{
+		Mode: core.RetentionCompliance,
+		Days: 30,
+	}))
+	retention, err = g.GetBucketRetention(ctx, "records")
+	assert.NoError(t, err)
+	assert.Equal(t, &core.BucketRetention{Mode: core.RetentionCompliance, Days: 30}, retention)
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	bound, err := g.With(core.Options{GovernanceBypass: true})
+	assert.NoError(t, err)
+	bypass := bound.(*GCS)
+	assert.NoError(t, bypass.SetObjectRetention(ctx, "records", "a.txt",
+		&core.ObjectRetention{Mode: core.RetentionGovernance, RetainUntil: until}))
+	assert.Equal(t, "true", override)
+	objectRetention, err := g.GetObjectRetention(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, core.RetentionGovernance, objectRetention.Mode)
+	assert.True(t, until.Equal(objectRetention.RetainUntil))
+
+	// Legal holds are temporary holds.
+	assert.NoError(t, g.SetLegalHold(ctx, "records", "a.txt", true))
+	assert.Equal(t, true, object["temporaryHold"])
+	hold, err := g.GetLegalHold(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	assert.True(t, hold)
+}
@@ -0,0 +1,79 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersioning(t *testing.T) {
+	var mu sync.Mutex
+	bucket := map[string]any{"name": "photos"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/storage/v1/b/photos", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPatch {
+			var patch map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			bucket["versioning"] = patch["versioning"]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(bucket)
+	})
+	mux.HandleFunc("/storage/v1/b/photos/o", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("versions"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items":[
+			{"name":"a.jpg","generation":"1","size":"1","timeDeleted":"2024-01-02T00:00:00Z"},
+			{"name":"a.jpg","generation":"2","size":"2"},
+			{"name":"b.jpg","generation":"5","size":"5"}
+		]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	g, err := NewEngineWithOptions(context.Background(), "project",
+		WithEndpoint(srv.URL+"/storage/v1/"),
+		WithHTTPClient(srv.Client()),
+	)
+	assert.NoError(t, err)
+	defer g.Close()
+	ctx := context.Background()
+
+	status, err := g.GetVersioning(ctx, "photos")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningOff, status)
+	assert.NoError(t, g.EnableVersioning(ctx, "photos"))
+	status, err = g.GetVersioning(ctx, "photos")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningEnabled, status)
+	assert.NoError(t, g.SuspendVersioning(ctx, "photos"))
+	status, err = g.GetVersioning(ctx, "photos")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningOff, status)
+
+	versions, err := g.ListObjectVersions(ctx, "photos", "")
+	assert.NoError(t, err)
+	var got []string
+	for _, v := range versions {
+		latest := ""
+		if v.IsLatest {
+			latest = "*"
+		}
+		got = append(got, v.Name+"#"+v.VersionID+latest)
+	}
+	assert.Equal(t, []string{"a.jpg#2*", "a.jpg#1", "b.jpg#5*"}, got)
+
+	// Version IDs are generations.
+	v1, err := g.With(core.Options{VersionID: "v1"})
+	assert.NoError(t, err)
+	_, err = v1.GetContent(ctx, "photos", "a.jpg")
+	assert.ErrorContains(t, err, "not a GCS generation")
+}
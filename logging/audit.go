@@ -0,0 +1,352 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// Record one storage call
+type Record struct {
+	Time             time.Time     `json:"time"`
+	Identity         string        `json:"identity,omitempty"`
+	Operation        string        `json:"operation"`
+	Bucket           string        `json:"bucket"`
+	Key              string        `json:"key,omitempty"`
+	VersionID        string        `json:"version_id,omitempty"`
+	GovernanceBypass bool          `json:"governance_bypass,omitempty"`
+	SourceBucket     string        `json:"source_bucket,omitempty"`
+	SourceKey        string        `json:"source_key,omitempty"`
+	Size             int64         `json:"size"`
+	Expiry           time.Duration `json:"expiry_ns,omitempty"`
+	Duration         time.Duration `json:"duration_ns"`
+	Error            string        `json:"error,omitempty"`
+	// Retention set by SetObjectRetention or SetBucketRetention, such as
+	// "GOVERNANCE until 2030-01-01T00:00:00Z", or "none" when removed.
+	Retention string `json:"retention,omitempty"`
+	// LegalHold set by SetLegalHold.
+	LegalHold *bool `json:"legal_hold,omitempty"`
+}
+
+func (r *Record) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("operation", r.Operation),
+		slog.String("bucket", r.Bucket),
+	}
+	if r.Key != "" {
+		attrs = append(attrs, slog.String("key", r.Key))
+	}
+	if r.VersionID != "" {
+		attrs = append(attrs, slog.String("version_id", r.VersionID))
+	}
+	if r.GovernanceBypass {
+		attrs = append(attrs, slog.Bool("governance_bypass", true))
+	}
+	if r.SourceKey != "" {
+		attrs = append(attrs,
+			slog.String("source_bucket", r.SourceBucket),
+			slog.String("source_key", r.SourceKey),
+		)
+	}
+	if r.Size >= 0 {
+		attrs = append(attrs, slog.Int64("size", r.Size))
+	}
+	if r.Retention != "" {
+		attrs = append(attrs, slog.String("retention", r.Retention))
+	}
+	if r.LegalHold != nil {
+		attrs = append(attrs, slog.Bool("legal_hold", *r.LegalHold))
+	}
+	if r.Identity != "" {
+		attrs = append(attrs, slog.String("identity", r.Identity))
+	}
+	attrs = append(attrs, slog.Duration("duration", r.Duration))
+	if r.Error != "" {
+		attrs = append(attrs, slog.String("error", r.Error))
+	}
+	return attrs
+}
+
+// AuditSink receives audit records
+type AuditSink interface {
+	Write(ctx context.Context, record Record) error
+	Close() error
+}
+
+// hourLayout names one rotation period.
+const hourLayout = "2006010215"
+
+// FileSink appends JSON Lines records to one local file per hour, named
+// <prefix>-YYYYMMDDHH.jsonl inside dir.
+type FileSink struct {
+	dir    string
+	prefix string
+	now    func() time.Time
+
+	mu   sync.Mutex
+	hour string
+	file *os.File
+}
+
+var _ AuditSink = (*FileSink)(nil)
+
+// NewFileSink struct. The directory is created on first write.
+func NewFileSink(dir, prefix string) *FileSink {
+	if prefix == "" {
+		prefix = "audit"
+	}
+	return &FileSink{
+		dir:    dir,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+// Write appends record, rotating to a new file when the hour changes.
+func (f *FileSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hour := f.now().UTC().Format(hourLayout)
+	if f.file == nil || hour != f.hour {
+		if err := f.rotate(hour); err != nil {
+			return err
+		}
+	}
+	_, err = f.file.Write(line)
+	return err
+}
+
+func (f *FileSink) rotate(hour string) error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	if err := os.MkdirAll(f.dir, 0o750); err != nil {
+		return err
+	}
+	name := filepath.Join(f.dir, f.prefix+"-"+hour+".jsonl")
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.hour = hour
+	return nil
+}
+
+// Close the current file.
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Upload triggers of StorageSink.
+const (
+	// DefaultFlushInterval is how often StorageSink uploads new records.
+	DefaultFlushInterval = time.Minute
+	// DefaultFlushSize is how many bytes of new records make StorageSink
+	// upload them on the next Write.
+	DefaultFlushSize = 1 << 20
+)
+
+// StorageSink writes JSON Lines records to objects in a bucket, one object
+// per hour and sink: <prefix>/YYYY/MM/DD/HH-<id>.jsonl. Object stores cannot
+// append, so records are buffered and the hour's object is rewritten on every
+// Flush: every DefaultFlushInterval, once DefaultFlushSize bytes are new, and
+// one last time for the previous hour when the hour changes. An hour whose
+// last upload fails is kept and retried on the next Write or Flush. Uploads
+// use a fresh context, never that of the call being audited. The per-sink id
+// keeps several processes from overwriting each other.
+type StorageSink struct {
+	storage core.Storage
+	bucket  string
+	prefix  string
+	id      string
+	now     func() time.Time
+
+	mu   sync.Mutex
+	hour time.Time
+	buf  bytes.Buffer
+	// flushed is the length of buf at the last upload.
+	flushed int
+	// pending are earlier hours whose last upload failed.
+	pending []pendingHour
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// pendingHour is the content of an earlier hour still to be uploaded.
+type pendingHour struct {
+	hour    time.Time
+	content []byte
+}
+
+var _ AuditSink = (*StorageSink)(nil)
+
+// NewStorageSink struct
+func NewStorageSink(storage core.Storage, bucket, prefix string) *StorageSink {
+	if prefix == "" {
+		prefix = "audit"
+	}
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+	s := &StorageSink{
+		storage: storage,
+		bucket:  bucket,
+		prefix:  prefix,
+		id:      hex.EncodeToString(id),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run(DefaultFlushInterval)
+	return s
+}
+
+func (s *StorageSink) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// A failed upload keeps the records for the next tick.
+			_ = s.Flush(context.Background())
+		}
+	}
+}
+
+// Write buffers record, flushing the previous hour when it has passed. The
+// record is kept even when that upload fails.
+func (s *StorageSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hour := s.now().UTC().Truncate(time.Hour)
+	if !s.hour.IsZero() && !hour.Equal(s.hour) {
+		if s.buf.Len() > s.flushed {
+			s.pending = append(s.pending, pendingHour{
+				hour:    s.hour,
+				content: bytes.Clone(s.buf.Bytes()),
+			})
+		}
+		s.buf.Reset()
+		s.flushed = 0
+	}
+	s.hour = hour
+	s.buf.Write(line)
+	s.buf.WriteByte('\n')
+
+	if err := s.flushPending(context.Background()); err != nil {
+		return err
+	}
+	if s.buf.Len()-s.flushed >= DefaultFlushSize {
+		return s.flush(context.Background())
+	}
+	return nil
+}
+
+// ObjectName of the current hour.
+func (s *StorageSink) ObjectName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objectName()
+}
+
+func (s *StorageSink) objectName() string {
+	return s.hourName(s.hour)
+}
+
+func (s *StorageSink) hourName(hour time.Time) string {
+	return path.Join(s.prefix, hour.Format("2006/01/02/15")+"-"+s.id+".jsonl")
+}
+
+// Flush uploads the records of the current hour and of earlier hours whose
+// upload failed.
+func (s *StorageSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush(ctx)
+}
+
+func (s *StorageSink) flush(ctx context.Context) error {
+	if err := s.flushPending(ctx); err != nil {
+		return err
+	}
+	if s.buf.Len() == s.flushed {
+		return nil
+	}
+	content := s.buf.Bytes()
+	if err := s.upload(ctx, s.hour, content); err != nil {
+		return err
+	}
+	s.flushed = len(content)
+	return nil
+}
+
+// flushPending uploads the earlier hours, oldest first.
+func (s *StorageSink) flushPending(ctx context.Context) error {
+	for len(s.pending) > 0 {
+		p := s.pending[0]
+		if err := s.upload(ctx, p.hour, p.content); err != nil {
+			return err
+		}
+		s.pending = s.pending[1:]
+	}
+	return nil
+}
+
+func (s *StorageSink) upload(ctx context.Context, hour time.Time, content []byte) error {
+	return s.storage.UploadFileByReader(
+		ctx,
+		s.bucket,
+		s.hourName(hour),
+		bytes.NewReader(content),
+		"application/x-ndjson",
+		int64(len(content)),
+	)
+}
+
+// Close stops the periodic uploads and flushes the buffered records.
+func (s *StorageSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s.Flush(context.Background())
+}
@@ -0,0 +1,435 @@
+// Package logging wraps a core.Storage with log/slog records for every call
+// and an optional audit trail of uploads, copies, signed URLs, deletes, and
+// versioning and object lock changes.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+var (
+	_ core.Storage      = (*Storage)(nil)
+	_ core.Stater       = (*Storage)(nil)
+	_ core.Lister       = (*Storage)(nil)
+	_ core.Versioner    = (*Storage)(nil)
+	_ core.Locker       = (*Storage)(nil)
+	_ core.ObjectReader = (*Storage)(nil)
+	_ core.Binder       = (*Storage)(nil)
+)
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller identity (a user,
+// service account or request ID) recorded in logs and audit records.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity set by WithIdentity.
+func IdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
+
+// Config for logging
+type Config struct {
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+	// Level of successful calls. Failed calls always log at slog.LevelError.
+	// Defaults to slog.LevelInfo.
+	Level slog.Level
+	// Audit receives a Record for every mutating or signing call.
+	Audit AuditSink
+}
+
+// Storage logging wrapper
+type Storage struct {
+	core.Storage
+	logger *slog.Logger
+	level  slog.Level
+	audit  AuditSink
+	// opts are recorded with every call.
+	opts core.Options
+}
+
+// NewEngine struct
+func NewEngine(next core.Storage, cfg Config) (*Storage, error) {
+	if next == nil {
+		return nil, errors.New("go-storage: logging needs a storage to wrap")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	return &Storage{
+		Storage: next,
+		logger:  cfg.Logger,
+		level:   cfg.Level,
+		audit:   cfg.Audit,
+	}, nil
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() core.Storage {
+	return s.Storage
+}
+
+// With returns a copy of s over the wrapped storage bound to opts.
+func (s *Storage) With(opts core.Options) (core.Storage, error) {
+	next, err := core.With(s.Storage, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *s
+	c.Storage = next
+	c.opts = s.opts.Merge(opts)
+	return &c, nil
+}
+
+// call is one logged operation.
+type call struct {
+	record Record
+	start  time.Time
+	audit  bool
+}
+
+func begin(operation, bucketName, objectName string, audit bool) *call {
+	return &call{
+		record: Record{
+			Operation: operation,
+			Bucket:    bucketName,
+			Key:       objectName,
+			Size:      -1,
+		},
+		start: time.Now(),
+		audit: audit,
+	}
+}
+
+func (s *Storage) end(ctx context.Context, c *call, err error) {
+	c.record.Time = c.start.UTC()
+	c.record.Duration = time.Since(c.start)
+	c.record.Identity = IdentityFromContext(ctx)
+	c.record.VersionID = s.opts.VersionID
+	c.record.GovernanceBypass = s.opts.GovernanceBypass
+	if err != nil {
+		c.record.Error = err.Error()
+	}
+
+	level := s.level
+	if err != nil {
+		level = slog.LevelError
+	}
+	if s.logger.Enabled(ctx, level) {
+		s.logger.LogAttrs(ctx, level, "storage "+c.record.Operation, c.record.attrs()...)
+	}
+
+	if c.audit && s.audit != nil {
+		if auditErr := s.audit.Write(ctx, c.record); auditErr != nil {
+			s.logger.LogAttrs(ctx, slog.LevelError, "storage audit write failed",
+				slog.String("operation", c.record.Operation),
+				slog.String("error", auditErr.Error()),
+			)
+		}
+	}
+}
+
+// CreateBucket create bucket
+func (s *Storage) CreateBucket(ctx context.Context, bucketName, region string) error {
+	c := begin("CreateBucket", bucketName, "", true)
+	err := s.Storage.CreateBucket(ctx, bucketName, region)
+	s.end(ctx, c, err)
+	return err
+}
+
+// BucketExists Checks if a bucket exists.
+func (s *Storage) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	c := begin("BucketExists", bucketName, "", false)
+	found, err := s.Storage.BucketExists(ctx, bucketName)
+	s.end(ctx, c, err)
+	return found, err
+}
+
+// UploadFile to storage
+func (s *Storage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	c := begin("UploadFile", bucketName, objectName, true)
+	c.record.Size = int64(len(content))
+	err := s.Storage.UploadFile(ctx, bucketName, objectName, content, reader)
+	s.end(ctx, c, err)
+	return err
+}
+
+// ReaderIsBody reports whether the wrapped storage uploads the reader
+// passed to UploadFile.
+func (s *Storage) ReaderIsBody() bool {
+	return core.ReaderIsBody(s.Storage)
+}
+
+// UploadFileByReader to storage
+func (s *Storage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	c := begin("UploadFileByReader", bucketName, objectName, true)
+	c.record.Size = length
+	err := s.Storage.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+	s.end(ctx, c, err)
+	return err
+}
+
+// DeleteFile delete file
+func (s *Storage) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	c := begin("DeleteFile", bucketName, fileName, true)
+	err := s.Storage.DeleteFile(ctx, bucketName, fileName)
+	s.end(ctx, c, err)
+	return err
+}
+
+// DownloadFile downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFile(ctx context.Context, bucketName, objectName, filePath string) error {
+	c := begin("DownloadFile", bucketName, objectName, false)
+	err := s.Storage.DownloadFile(ctx, bucketName, objectName, filePath)
+	s.end(ctx, c, err)
+	return err
+}
+
+// DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFileByProgress(
+	ctx context.Context,
+	bucketName, objectName, filePath string,
+	bar *pb.ProgressBar,
+) error {
+	c := begin("DownloadFileByProgress", bucketName, objectName, false)
+	err := s.Storage.DownloadFileByProgress(ctx, bucketName, objectName, filePath, bar)
+	s.end(ctx, c, err)
+	return err
+}
+
+// FileExist check object exist. bucket + filename
+func (s *Storage) FileExist(ctx context.Context, bucketName, fileName string) bool {
+	c := begin("FileExist", bucketName, fileName, false)
+	found := s.Storage.FileExist(ctx, bucketName, fileName)
+	s.end(ctx, c, nil)
+	return found
+}
+
+// StatFile returns the object attributes. bucket + filename
+func (s *Storage) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	c := begin("StatFile", bucketName, fileName, false)
+	info, err := core.StatFile(ctx, s.Storage, bucketName, fileName)
+	if err == nil {
+		c.record.Size = info.Size
+	}
+	s.end(ctx, c, err)
+	return info, err
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (s *Storage) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	c := begin("ListObjects", bucketName, prefix, false)
+	objects, err := core.ListObjects(ctx, s.Storage, bucketName, prefix)
+	s.end(ctx, c, err)
+	return objects, err
+}
+
+// GetContent for storage bucket + filename
+func (s *Storage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	c := begin("GetContent", bucketName, fileName, false)
+	content, err := s.Storage.GetContent(ctx, bucketName, fileName)
+	if err == nil {
+		c.record.Size = int64(len(content))
+	}
+	s.end(ctx, c, err)
+	return content, err
+}
+
+// NewReader opens the object with its attributes.
+func (s *Storage) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	c := begin("NewReader", bucketName, fileName, false)
+	body, info, err := core.NewReader(ctx, s.Storage, bucketName, fileName)
+	if err == nil {
+		c.record.Size = info.Size
+	}
+	s.end(ctx, c, err)
+	return body, info, err
+}
+
+// CopyFile copy src to dest
+func (s *Storage) CopyFile(
+	ctx context.Context,
+	srcBucket, srcPath, destBucket, destPath string,
+) error {
+	c := begin("CopyFile", destBucket, destPath, true)
+	c.record.SourceBucket = srcBucket
+	c.record.SourceKey = srcPath
+	err := s.Storage.CopyFile(ctx, srcBucket, srcPath, destBucket, destPath)
+	s.end(ctx, c, err)
+	return err
+}
+
+// SignedURL get signed URL. The URL itself is never logged.
+func (s *Storage) SignedURL(
+	ctx context.Context,
+	bucketName, filePath string,
+	opts *core.SignedURLOptions,
+) (string, error) {
+	c := begin("SignedURL", bucketName, filePath, true)
+	if opts != nil {
+		c.record.Expiry = opts.Expiry
+	}
+	signed, err := s.Storage.SignedURL(ctx, bucketName, filePath, opts)
+	s.end(ctx, c, err)
+	return signed, err
+}
+
+// SetLifeCycle on bucket or an object prefix.
+func (s *Storage) SetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	c := begin("SetLifeCycle", bucketName, "", true)
+	err := s.Storage.SetLifeCycle(ctx, bucketName, opts)
+	s.end(ctx, c, err)
+	return err
+}
+
+// EnableVersioning on the wrapped storage's Versioner.
+func (s *Storage) EnableVersioning(ctx context.Context, bucketName string) error {
+	c := begin("EnableVersioning", bucketName, "", true)
+	err := core.VersionerOf(s.Storage).EnableVersioning(ctx, bucketName)
+	s.end(ctx, c, err)
+	return err
+}
+
+// SuspendVersioning on the wrapped storage's Versioner.
+func (s *Storage) SuspendVersioning(ctx context.Context, bucketName string) error {
+	c := begin("SuspendVersioning", bucketName, "", true)
+	err := core.VersionerOf(s.Storage).SuspendVersioning(ctx, bucketName)
+	s.end(ctx, c, err)
+	return err
+}
+
+// GetVersioning returns the bucket versioning status.
+func (s *Storage) GetVersioning(
+	ctx context.Context,
+	bucketName string,
+) (core.VersioningStatus, error) {
+	c := begin("GetVersioning", bucketName, "", false)
+	status, err := core.VersionerOf(s.Storage).GetVersioning(ctx, bucketName)
+	s.end(ctx, c, err)
+	return status, err
+}
+
+// ListObjectVersions lists the versions of the objects under prefix.
+func (s *Storage) ListObjectVersions(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectVersion, error) {
+	c := begin("ListObjectVersions", bucketName, prefix, false)
+	versions, err := core.VersionerOf(s.Storage).ListObjectVersions(ctx, bucketName, prefix)
+	s.end(ctx, c, err)
+	return versions, err
+}
+
+// SetBucketRetention on the wrapped storage's Locker.
+func (s *Storage) SetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+	retention *core.BucketRetention,
+) error {
+	c := begin("SetBucketRetention", bucketName, "", true)
+	c.record.Retention = "none"
+	if retention != nil {
+		period := fmt.Sprintf("%d days", retention.Days)
+		if retention.Years > 0 {
+			period = fmt.Sprintf("%d years", retention.Years)
+		}
+		c.record.Retention = fmt.Sprintf("%s for %s", retention.Mode, period)
+	}
+	err := core.LockerOf(s.Storage).SetBucketRetention(ctx, bucketName, retention)
+	s.end(ctx, c, err)
+	return err
+}
+
+// GetBucketRetention returns the default retention of the bucket.
+func (s *Storage) GetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+) (*core.BucketRetention, error) {
+	c := begin("GetBucketRetention", bucketName, "", false)
+	retention, err := core.LockerOf(s.Storage).GetBucketRetention(ctx, bucketName)
+	s.end(ctx, c, err)
+	return retention, err
+}
+
+// SetObjectRetention on the wrapped storage's Locker.
+func (s *Storage) SetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+	retention *core.ObjectRetention,
+) error {
+	c := begin("SetObjectRetention", bucketName, fileName, true)
+	c.record.Retention = "none"
+	if retention != nil {
+		c.record.Retention = fmt.Sprintf("%s until %s",
+			retention.Mode, retention.RetainUntil.UTC().Format(time.RFC3339))
+	}
+	err := core.LockerOf(s.Storage).SetObjectRetention(ctx, bucketName, fileName, retention)
+	s.end(ctx, c, err)
+	return err
+}
+
+// GetObjectRetention returns the object retention.
+func (s *Storage) GetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectRetention, error) {
+	c := begin("GetObjectRetention", bucketName, fileName, false)
+	retention, err := core.LockerOf(s.Storage).GetObjectRetention(ctx, bucketName, fileName)
+	s.end(ctx, c, err)
+	return retention, err
+}
+
+// SetLegalHold on the wrapped storage's Locker.
+func (s *Storage) SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error {
+	c := begin("SetLegalHold", bucketName, fileName, true)
+	c.record.LegalHold = &hold
+	err := core.LockerOf(s.Storage).SetLegalHold(ctx, bucketName, fileName, hold)
+	s.end(ctx, c, err)
+	return err
+}
+
+// GetLegalHold reports whether the object is under legal hold.
+func (s *Storage) GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error) {
+	c := begin("GetLegalHold", bucketName, fileName, false)
+	hold, err := core.LockerOf(s.Storage).GetLegalHold(ctx, bucketName, fileName)
+	s.end(ctx, c, err)
+	return hold, err
+}
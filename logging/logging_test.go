@@ -0,0 +1,263 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readRecords(t *testing.T, content []byte) []Record {
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		var r Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLogsEveryCall(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{Logger: logger})
+	assert.NoError(t, err)
+
+	ctx := WithIdentity(context.Background(), "alice")
+	assert.NoError(t, s.UploadFile(ctx, "b", "a.txt", []byte("hello"), nil))
+	_, err = s.GetContent(ctx, "b", "missing.txt")
+	assert.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var upload map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &upload))
+	assert.Equal(t, "INFO", upload["level"])
+	assert.Equal(t, "UploadFile", upload["operation"])
+	assert.Equal(t, "a.txt", upload["key"])
+	assert.Equal(t, "alice", upload["identity"])
+	assert.Equal(t, float64(5), upload["size"])
+
+	var get map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &get))
+	assert.Equal(t, "ERROR", get["level"])
+	assert.NotEmpty(t, get["error"])
+}
+
+func TestFileSinkRotatesHourly(t *testing.T) {
+	dir := t.TempDir()
+	sink := NewFileSink(dir, "")
+	now := time.Date(2026, 1, 2, 3, 59, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{
+		Logger: slog.New(slog.DiscardHandler),
+		Audit:  sink,
+	})
+	assert.NoError(t, err)
+	ctx := WithIdentity(context.Background(), "bob")
+
+	assert.NoError(t, s.UploadFile(ctx, "b", "a.txt", []byte("a"), nil))
+	// Reads are logged but not audited.
+	_, _ = s.GetContent(ctx, "b", "a.txt")
+	now = now.Add(time.Minute)
+	assert.NoError(t, s.CopyFile(ctx, "b", "a.txt", "b", "c.txt"))
+	assert.NoError(t, sink.Close())
+
+	first, err := os.ReadFile(filepath.Join(dir, "audit-2026010203.jsonl"))
+	assert.NoError(t, err)
+	records := readRecords(t, first)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "UploadFile", records[0].Operation)
+	assert.Equal(t, "bob", records[0].Identity)
+
+	second, err := os.ReadFile(filepath.Join(dir, "audit-2026010204.jsonl"))
+	assert.NoError(t, err)
+	records = readRecords(t, second)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "CopyFile", records[0].Operation)
+	assert.Equal(t, "a.txt", records[0].SourceKey)
+	assert.Equal(t, "c.txt", records[0].Key)
+}
+
+func TestStorageSink(t *testing.T) {
+	auditEngine := disk.NewEngine("", t.TempDir())
+	sink := NewStorageSink(auditEngine, "audit-logs", "")
+	now := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{
+		Logger: slog.New(slog.DiscardHandler),
+		Audit:  sink,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, s.UploadFile(ctx, "b", "a.txt", []byte("a"), nil))
+	assert.Error(t, s.DeleteFile(ctx, "b", "missing.txt"))
+	firstHour := sink.ObjectName()
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, s.DeleteFile(ctx, "b", "a.txt"))
+	assert.NoError(t, sink.Close())
+
+	content, err := auditEngine.GetContent(ctx, "audit-logs", firstHour)
+	assert.NoError(t, err)
+	records := readRecords(t, content)
+	assert.Len(t, records, 2)
+	assert.NotEmpty(t, records[1].Error)
+
+	content, err = auditEngine.GetContent(ctx, "audit-logs", sink.ObjectName())
+	assert.NoError(t, err)
+	assert.Len(t, readRecords(t, content), 1)
+	assert.True(t, strings.HasPrefix(sink.ObjectName(), "audit/2026/01/02/04-"))
+}
+
+func TestStorageSinkFlushSize(t *testing.T) {
+	auditEngine := disk.NewEngine("", t.TempDir())
+	sink := NewStorageSink(auditEngine, "audit-logs", "")
+	defer sink.Close()
+	ctx := context.Background()
+
+	record := Record{Operation: "UploadFile", Bucket: "b", Key: strings.Repeat("k", 1<<10)}
+	assert.NoError(t, sink.Write(ctx, record))
+	assert.False(t, auditEngine.FileExist(ctx, "audit-logs", sink.ObjectName()))
+
+	// Once enough is buffered, records are uploaded without waiting for
+	// the interval or Close.
+	for range DefaultFlushSize >> 10 {
+		assert.NoError(t, sink.Write(ctx, record))
+	}
+	content, err := auditEngine.GetContent(ctx, "audit-logs", sink.ObjectName())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, readRecords(t, content))
+}
+
+// flakyDisk fails uploads while down is set.
+type flakyDisk struct {
+	*disk.Disk
+	down bool
+}
+
+func (f *flakyDisk) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	if f.down {
+		return errors.New("bucket unavailable")
+	}
+	return f.Disk.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+}
+
+func TestStorageSinkRetriesPreviousHour(t *testing.T) {
+	auditEngine := &flakyDisk{Disk: disk.NewEngine("", t.TempDir())}
+	sink := NewStorageSink(auditEngine, "audit-logs", "")
+	now := time.Date(2026, 1, 2, 3, 59, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	assert.NoError(t, sink.Write(ctx, Record{Operation: "UploadFile", Bucket: "b", Key: "a"}))
+	firstHour := sink.ObjectName()
+
+	// The bucket is down at the top of the hour: the previous hour cannot
+	// be uploaded, but neither it nor the new record is lost.
+	now = now.Add(time.Minute)
+	auditEngine.down = true
+	assert.Error(t, sink.Write(ctx, Record{Operation: "DeleteFile", Bucket: "b", Key: "a"}))
+	auditEngine.down = false
+	assert.NoError(t, sink.Write(ctx, Record{Operation: "DeleteFile", Bucket: "b", Key: "b"}))
+	assert.NoError(t, sink.Close())
+
+	content, err := auditEngine.GetContent(ctx, "audit-logs", firstHour)
+	assert.NoError(t, err)
+	assert.Len(t, readRecords(t, content), 1)
+	content, err = auditEngine.GetContent(ctx, "audit-logs", sink.ObjectName())
+	assert.NoError(t, err)
+	assert.Len(t, readRecords(t, content), 2)
+}
+
+// recordSink keeps the audit records in memory.
+type recordSink struct {
+	records []Record
+}
+
+func (r *recordSink) Write(_ context.Context, record Record) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *recordSink) Close() error {
+	return nil
+}
+
+func TestAuditsVersioningAndObjectLock(t *testing.T) {
+	sink := &recordSink{}
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{
+		Logger: slog.New(slog.DiscardHandler),
+		Audit:  sink,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	locked, err := s.With(core.Options{ObjectLock: true})
+	assert.NoError(t, err)
+	assert.NoError(t, locked.CreateBucket(ctx, "b", ""))
+	assert.NoError(t, s.UploadFile(ctx, "b", "a.txt", []byte("a"), nil))
+	versions, err := core.VersionerOf(s).ListObjectVersions(ctx, "b", "a.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+	version := versions[0].VersionID
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	retention := &core.ObjectRetention{Mode: core.RetentionGovernance, RetainUntil: until}
+	assert.NoError(t, core.LockerOf(s).SetObjectRetention(ctx, "b", "a.txt", retention))
+	assert.NoError(t, core.LockerOf(s).SetLegalHold(ctx, "b", "a.txt", true))
+
+	// Shorten the retention of the version by bypassing governance.
+	bypass, err := s.With(core.Options{VersionID: version, GovernanceBypass: true})
+	assert.NoError(t, err)
+	assert.NoError(t, core.LockerOf(bypass).SetObjectRetention(ctx, "b", "a.txt", nil))
+	assert.NoError(t, core.LockerOf(bypass).SetLegalHold(ctx, "b", "a.txt", false))
+	assert.NoError(t, core.VersionerOf(s).SuspendVersioning(ctx, "b"))
+
+	var ops []string
+	for _, r := range sink.records {
+		ops = append(ops, r.Operation)
+	}
+	assert.Equal(t, []string{
+		"CreateBucket", "UploadFile",
+		"SetObjectRetention", "SetLegalHold",
+		"SetObjectRetention", "SetLegalHold",
+		"SuspendVersioning",
+	}, ops)
+
+	set := sink.records[2]
+	assert.Equal(t, "GOVERNANCE until "+until.Format(time.RFC3339), set.Retention)
+	assert.False(t, set.GovernanceBypass)
+	assert.True(t, *sink.records[3].LegalHold)
+
+	lifted := sink.records[4]
+	assert.Equal(t, "none", lifted.Retention)
+	assert.Equal(t, version, lifted.VersionID)
+	assert.True(t, lifted.GovernanceBypass)
+	assert.Equal(t, version, sink.records[5].VersionID)
+	assert.False(t, *sink.records[5].LegalHold)
+}
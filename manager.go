@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// healthBucket is probed by Check for engines without a configured bucket.
+// It need not exist: answering at all shows the backend is reachable.
+const healthBucket = "go-storage-health"
+
+// ManagerConfig for a Manager
+type ManagerConfig struct {
+	// Engines are built by name with NewEngine's driver registry.
+	Engines map[string]Config `json:"engines"`
+	// Default names the engine returned by Manager.Default. Optional.
+	Default string `json:"default,omitempty"`
+}
+
+// entry is a named engine and the bucket Check probes.
+type entry struct {
+	engine core.Storage
+	bucket string
+}
+
+// Manager holds named engines, for processes that talk to several buckets
+// or providers. It is safe for concurrent use.
+type Manager struct {
+	mu          sync.RWMutex
+	engines     map[string]entry
+	defaultName string
+}
+
+// NewManager builds every engine in cfg. If one fails, those already built
+// are closed.
+func NewManager(ctx context.Context, cfg ManagerConfig) (*Manager, error) {
+	if cfg.Default != "" {
+		if _, ok := cfg.Engines[cfg.Default]; !ok {
+			return nil, fmt.Errorf("go-storage: default engine %q is not configured", cfg.Default)
+		}
+	}
+
+	m := &Manager{engines: map[string]entry{}, defaultName: cfg.Default}
+	for _, name := range sortedNames(cfg.Engines) {
+		engine, err := build(ctx, cfg.Engines[name])
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("go-storage: engine %q: %w", name, err), m.Close())
+		}
+		m.engines[name] = entry{engine: engine, bucket: cfg.Engines[name].Bucket}
+	}
+	return m, nil
+}
+
+func sortedNames[T any](items map[string]T) []string {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add registers an engine built elsewhere under name.
+func (m *Manager) Add(name string, engine core.Storage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, dup := m.engines[name]; dup {
+		return fmt.Errorf("go-storage: engine %q already exists", name)
+	}
+	m.engines[name] = entry{engine: engine}
+	return nil
+}
+
+// Get returns the engine named name.
+func (m *Manager) Get(name string) (core.Storage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.engines[name]
+	if !ok {
+		return nil, fmt.Errorf("go-storage: no engine named %q", name)
+	}
+	return e.engine, nil
+}
+
+// Default returns the engine named by ManagerConfig.Default.
+func (m *Manager) Default() (core.Storage, error) {
+	if m.defaultName == "" {
+		return nil, errors.New("go-storage: no default engine configured")
+	}
+	return m.Get(m.defaultName)
+}
+
+// Names returns the sorted engine names.
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sortedNames(m.engines)
+}
+
+// Check probes every engine concurrently and returns one entry per engine,
+// nil when healthy. Engines with a configured bucket fail if it is missing.
+func (m *Manager) Check(ctx context.Context) map[string]error {
+	m.mu.RLock()
+	engines := make(map[string]entry, len(m.engines))
+	for name, e := range m.engines {
+		engines[name] = e
+	}
+	m.mu.RUnlock()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(engines))
+	)
+	for name, e := range engines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := e.check(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (e entry) check(ctx context.Context) error {
+	bucket := e.bucket
+	if bucket == "" {
+		bucket = healthBucket
+	}
+	found, err := e.engine.BucketExists(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if !found && e.bucket != "" {
+		return fmt.Errorf("go-storage: bucket %q does not exist", e.bucket)
+	}
+	return nil
+}
+
+// Close closes every engine that implements io.Closer and empties the
+// manager.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	engines := m.engines
+	m.engines = map[string]entry{}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, name := range sortedNames(engines) {
+		if c, ok := engines[name].engine.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("go-storage: close %q: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,93 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// closer counts Close calls on an in-memory engine.
+type closer struct {
+	*memory.Memory
+	closed int
+	err    error
+}
+
+func (c *closer) Close() error {
+	c.closed++
+	return c.err
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	m, err := storage.NewManager(ctx, storage.ManagerConfig{
+		Engines: map[string]storage.Config{
+			"uploads": {Driver: "mem", Addr: "https://uploads.example.com"},
+			"backups": {Driver: "disk", Path: t.TempDir(), Bucket: "nightly"},
+		},
+		Default: "uploads",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backups", "uploads"}, m.Names())
+
+	engine, err := m.Default()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://uploads.example.com/a/b", engine.GetFileURL("a", "b"))
+	_, err = m.Get("cdn")
+	assert.Error(t, err)
+
+	// Concurrent reads and writes must not race.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = m.Get("uploads")
+			_ = m.Names()
+		}()
+	}
+	extra := &closer{Memory: memory.NewEngine(""), err: errors.New("boom")}
+	assert.NoError(t, m.Add("cdn", extra))
+	wg.Wait()
+	assert.Error(t, m.Add("cdn", extra))
+
+	health := m.Check(ctx)
+	assert.Len(t, health, 3)
+	assert.NoError(t, health["uploads"])
+	assert.NoError(t, health["cdn"])
+	assert.ErrorContains(t, health["backups"], `bucket "nightly" does not exist`)
+
+	backups, err := m.Get("backups")
+	assert.NoError(t, err)
+	assert.NoError(t, backups.CreateBucket(ctx, "nightly", ""))
+	assert.NoError(t, m.Check(ctx)["backups"])
+
+	assert.ErrorContains(t, m.Close(), "boom")
+	assert.Equal(t, 1, extra.closed)
+	assert.Empty(t, m.Names())
+}
+
+func TestManagerErrors(t *testing.T) {
+	ctx := context.Background()
+	_, err := storage.NewManager(ctx, storage.ManagerConfig{
+		Engines: map[string]storage.Config{"a": {Driver: "mem"}},
+		Default: "b",
+	})
+	assert.Error(t, err)
+
+	_, err = storage.NewManager(ctx, storage.ManagerConfig{
+		Engines: map[string]storage.Config{"a": {Driver: "mem"}, "b": {Driver: "ftp"}},
+	})
+	assert.ErrorContains(t, err, `engine "b"`)
+
+	m, err := storage.NewManager(ctx, storage.ManagerConfig{})
+	assert.NoError(t, err)
+	_, err = m.Default()
+	assert.Error(t, err)
+}
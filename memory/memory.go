@@ -0,0 +1,476 @@
+// Package memory is an in-process core.Storage, for tests and for caching
+// data that need not outlive the process.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // ETags are MD5, as on S3.
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+var (
+	_ core.Storage          = (*Memory)(nil)
+	_ core.Stater           = (*Memory)(nil)
+	_ core.Lister           = (*Memory)(nil)
+	_ core.Versioner        = (*Memory)(nil)
+	_ core.LifecycleManager = (*Memory)(nil)
+	_ core.Locker           = (*Memory)(nil)
+	_ core.ObjectReader     = (*Memory)(nil)
+	_ core.Binder           = (*Memory)(nil)
+)
+
+// object stored in memory
+type object struct {
+	content      []byte
+	contentType  string
+	cacheControl string
+	encoding     string
+	etag         string
+	metadata     map[string]string
+	lastModified time.Time
+	versionID    string
+	retention    *core.ObjectRetention
+	legalHold    bool
+}
+
+func (o *object) info(bucketName, name string) core.ObjectInfo {
+	return core.ObjectInfo{
+		Bucket:          bucketName,
+		Name:            name,
+		Size:            int64(len(o.content)),
+		ContentType:     o.contentType,
+		CacheControl:    o.cacheControl,
+		ETag:            o.etag,
+		LastModified:    o.lastModified,
+		Metadata:        maps.Clone(o.metadata),
+		VersionID:       o.versionID,
+		ContentEncoding: o.encoding,
+	}
+}
+
+// bucket of objects
+type bucket struct {
+	objects   map[string]*object
+	lifecycle []core.LifecycleRule
+
+	versioning core.VersioningStatus
+	// versions holds the noncurrent versions of each object, newest first.
+	versions    map[string][]*object
+	lastVersion uint64
+
+	// objectLock is set on buckets created with core.Options.ObjectLock.
+	objectLock bool
+	retention  *core.BucketRetention
+}
+
+func newBucket() *bucket {
+	return &bucket{objects: map[string]*object{}, versions: map[string][]*object{}}
+}
+
+// Memory client
+type Memory struct {
+	Host string
+	*objects
+	opts core.Options
+}
+
+// objects holds the buckets shared by the copies With returns.
+type objects struct {
+	mu      sync.RWMutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewEngine struct. Host prefixes the URLs from GetFileURL and SignedURL.
+func NewEngine(host string) *Memory {
+	return &Memory{
+		Host: host,
+		objects: &objects{
+			buckets: map[string]*bucket{},
+			now:     time.Now,
+		},
+	}
+}
+
+// With returns a copy of m applying opts, over the same objects. Memory has
+// no server-side encryption, so opts.Encryption is ignored.
+func (m *Memory) With(opts core.Options) (core.Storage, error) {
+	c := *m
+	c.opts = c.opts.Merge(opts)
+	return &c, nil
+}
+
+func notExist(op, bucketName, name string) error {
+	return &fs.PathError{Op: op, Path: path.Join(bucketName, name), Err: fs.ErrNotExist}
+}
+
+// lookup returns the object, or the version bound with
+// core.Options.VersionID, or a not-exist error. The caller holds m.mu.
+func (m *Memory) lookup(op, bucketName, name string) (*object, error) {
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, notExist(op, bucketName, "")
+	}
+	obj, ok := b.objects[name]
+	if versionID := m.opts.VersionID; versionID != "" {
+		if ok && currentVersion(obj) == versionID {
+			return obj, nil
+		}
+		if i := b.findVersion(name, versionID); i >= 0 {
+			return b.versions[name][i], nil
+		}
+		return nil, notExist(op, bucketName, name)
+	}
+	if !ok {
+		return nil, notExist(op, bucketName, name)
+	}
+	return obj, nil
+}
+
+// put stores content. Buckets are created on demand, as on the disk driver.
+func (m *Memory) put(
+	ctx context.Context,
+	bucketName, name string,
+	content []byte,
+	contentType string,
+) error {
+	sum := md5.Sum(content) //nolint:gosec
+	obj := &object{
+		content:      content,
+		contentType:  contentType,
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: m.now(),
+	}
+	if opts := m.opts.Upload; opts != nil {
+		obj.metadata = core.LowerKeys(opts.Metadata)
+		obj.cacheControl = opts.CacheControl
+		obj.encoding = opts.ContentEncoding
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		b = newBucket()
+		m.buckets[bucketName] = b
+	}
+	return b.store(name, obj, m.opts.GovernanceBypass)
+}
+
+// UploadFile to memory
+func (m *Memory) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	_ io.Reader,
+) error {
+	content = bytes.Clone(content)
+	if content == nil {
+		content = []byte{}
+	}
+	return m.put(ctx, bucketName, objectName, content, core.DetectContentType(content))
+}
+
+// UploadFileByReader to memory
+func (m *Memory) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	_ int64,
+) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = core.DetectContentType(content)
+	}
+	return m.put(ctx, bucketName, objectName, content, contentType)
+}
+
+// CreateBucket create bucket. With core.Options.ObjectLock, objects in the
+// bucket can be locked; that also turns it on for an existing bucket.
+func (m *Memory) CreateBucket(ctx context.Context, bucketName, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		b = newBucket()
+		m.buckets[bucketName] = b
+	}
+	if m.opts.ObjectLock {
+		b.objectLock = true
+	}
+	return nil
+}
+
+// BucketExists Checks if a bucket exists.
+func (m *Memory) BucketExists(_ context.Context, bucketName string) (found bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, found = m.buckets[bucketName]
+	return found, nil
+}
+
+// FilePath for bucket + file name
+func (m *Memory) FilePath(bucketName, fileName string) string {
+	return path.Join(bucketName, fileName)
+}
+
+// DeleteFile delete file. When versioning is on, the object becomes a
+// noncurrent version, as on the disk driver. A version bound with
+// core.Options.VersionID is removed for good. Locked objects are refused.
+func (m *Memory) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, err := m.lookup("remove", bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	if err := obj.checkLock(m.opts.GovernanceBypass); err != nil {
+		return err
+	}
+	b := m.buckets[bucketName]
+	if versionID := m.opts.VersionID; versionID != "" {
+		b.deleteVersion(fileName, versionID)
+		return nil
+	}
+	if b.versioning != core.VersioningOff {
+		b.archive(fileName, b.objects[fileName], b.versioning == core.VersioningSuspended)
+	}
+	delete(b.objects, fileName)
+	return nil
+}
+
+// GetFileURL for storage host + bucket + filename
+func (m *Memory) GetFileURL(bucketName, fileName string) string {
+	if m.Host != "" {
+		if u, err := url.Parse(m.Host); err == nil {
+			u.Path = path.Join(u.Path, bucketName, fileName)
+			return u.String()
+		}
+	}
+	return path.Join(bucketName, fileName)
+}
+
+// DownloadFile downloads and saves the object as a file in the local filesystem.
+func (m *Memory) DownloadFile(ctx context.Context, bucketName, fileName, target string) error {
+	return m.DownloadFileByProgress(ctx, bucketName, fileName, target, nil)
+}
+
+// DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
+func (m *Memory) DownloadFileByProgress(
+	ctx context.Context,
+	bucketName, fileName, target string,
+	bar *pb.ProgressBar,
+) error {
+	content, err := m.GetContent(ctx, bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+	if bar != nil {
+		bar.SetTotal(int64(len(content)))
+		bar.Add(len(content))
+	}
+	part := target + ".part.memory"
+	if err := os.WriteFile(part, content, 0o600); err != nil {
+		_ = os.Remove(part)
+		return err
+	}
+	return os.Rename(part, target)
+}
+
+// FileExist check object exist. bucket + filename
+func (m *Memory) FileExist(ctx context.Context, bucketName, fileName string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, err := m.lookup("stat", bucketName, fileName)
+	return err == nil
+}
+
+// StatFile returns the object attributes. bucket + filename
+func (m *Memory) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.lookup("stat", bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	info := obj.info(bucketName, fileName)
+	return &info, nil
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (m *Memory) ListObjects(
+	_ context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, notExist("list", bucketName, "")
+	}
+	var objects []core.ObjectInfo
+	for name, obj := range b.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, obj.info(bucketName, name))
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+	return objects, nil
+}
+
+// GetContent for storage bucket + filename
+func (m *Memory) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.lookup("open", bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(obj.content), nil
+}
+
+// NewReader opens a copy of the object with its attributes.
+func (m *Memory) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.lookup("open", bucketName, fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := obj.info(bucketName, fileName)
+	return io.NopCloser(bytes.NewReader(bytes.Clone(obj.content))), &info, nil
+}
+
+// CopyFile copy src to dest. The source can be a version bound with
+// core.Options.VersionID.
+func (m *Memory) CopyFile(
+	ctx context.Context,
+	srcBucket, srcPath, destBucket, destPath string,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	src, err := m.lookup("open", srcBucket, srcPath)
+	if err != nil {
+		return err
+	}
+	b, ok := m.buckets[destBucket]
+	if !ok {
+		b = newBucket()
+		m.buckets[destBucket] = b
+	}
+	dst := *src
+	dst.lastModified = m.now()
+	dst.retention, dst.legalHold = nil, false
+	return b.store(destPath, &dst, m.opts.GovernanceBypass)
+}
+
+// Client returns nil; there is no underlying client.
+func (m *Memory) Client() interface{} {
+	return nil
+}
+
+// SignedURL returns the object URL with an expiry and the response-*
+// parameters. Nothing checks it, so it only stands in for a real signed URL
+// in tests.
+func (m *Memory) SignedURL(
+	ctx context.Context,
+	bucketName, filePath string,
+	opts *core.SignedURLOptions,
+) (string, error) {
+	if opts == nil {
+		return "", errors.New("go-storage: opts cannot be nil")
+	}
+	var s core.Storage = m
+	if opts.VersionID != "" {
+		s, _ = m.With(core.Options{VersionID: opts.VersionID})
+	}
+	if !s.FileExist(ctx, bucketName, filePath) {
+		return "", notExist("sign", bucketName, filePath)
+	}
+	params := opts.ResponseParams()
+	if opts.VersionID != "" {
+		params.Set("versionId", opts.VersionID)
+	}
+	params.Set("expires", strconv.FormatInt(m.now().Add(opts.Expiry).Unix(), 10))
+	return m.GetFileURL(bucketName, filePath) + "?" + params.Encode(), nil
+}
+
+// SetLifeCycle merges the rules into the bucket lifecycle by ID. Objects
+// are not expired.
+func (m *Memory) SetLifeCycle(
+	_ context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	rules, err := opts.LifecycleRules(bucketName)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	b.lifecycle = core.MergeLifecycleRules(b.lifecycle, rules)
+	return nil
+}
+
+// GetLifeCycle returns the bucket lifecycle rules.
+func (m *Memory) GetLifeCycle(_ context.Context, bucketName string) (*core.LifecycleConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	return &core.LifecycleConfig{Rules: slices.Clone(b.lifecycle)}, nil
+}
+
+// DeleteLifeCycle removes the rules with the given IDs, or every rule when
+// no ID is given.
+func (m *Memory) DeleteLifeCycle(_ context.Context, bucketName string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	b.lifecycle = core.RemoveLifecycleRules(b.lifecycle, ids...)
+	return nil
+}
@@ -0,0 +1,222 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	m := NewEngine("https://cdn.example.com")
+	ctx := context.Background()
+	bound, err := m.With(core.Options{Upload: &core.UploadOptions{
+		Metadata: map[string]string{"Owner": "alice"},
+	}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, bound.UploadFileByReader(
+		ctx, "bucket", "docs/a.json", strings.NewReader(`{"a":1}`), "application/json", 7,
+	))
+	content, err := m.GetContent(ctx, "bucket", "docs/a.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(content))
+
+	info, err := m.StatFile(ctx, "bucket", "docs/a.json")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), info.Size)
+	assert.Equal(t, "application/json", info.ContentType)
+	assert.Equal(t, map[string]string{"owner": "alice"}, info.Metadata)
+	assert.Len(t, info.ETag, 32)
+
+	assert.Equal(t,
+		"https://cdn.example.com/bucket/docs/a.json",
+		m.GetFileURL("bucket", "docs/a.json"),
+	)
+
+	target := filepath.Join(t.TempDir(), "out", "a.json")
+	assert.NoError(t, m.DownloadFile(ctx, "bucket", "docs/a.json", target))
+	content, err = os.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(content))
+}
+
+func TestNotExist(t *testing.T) {
+	m := NewEngine("")
+	ctx := context.Background()
+
+	_, err := m.GetContent(ctx, "bucket", "missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = m.ListObjects(ctx, "bucket", "")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	found, err := m.BucketExists(ctx, "bucket")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, m.CreateBucket(ctx, "bucket", ""))
+	assert.ErrorIs(t, m.DeleteFile(ctx, "bucket", "missing"), os.ErrNotExist)
+	_, err = m.SignedURL(ctx, "bucket", "missing", &core.SignedURLOptions{})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestListAndCopy(t *testing.T) {
+	m := NewEngine("")
+	ctx := context.Background()
+	for _, name := range []string{"b/2.txt", "a.txt", "b/1.txt"} {
+		assert.NoError(t, m.UploadFile(ctx, "bucket", name, []byte(name), nil))
+	}
+	assert.NoError(t, m.CopyFile(ctx, "bucket", "a.txt", "other", "c.txt"))
+
+	objects, err := m.ListObjects(ctx, "bucket", "b/")
+	assert.NoError(t, err)
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	assert.Equal(t, []string{"b/1.txt", "b/2.txt"}, names)
+
+	content, err := m.GetContent(ctx, "other", "c.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "a.txt", string(content))
+}
+
+func TestLifecycle(t *testing.T) {
+	m := NewEngine("")
+	ctx := context.Background()
+	assert.Error(t, m.SetLifeCycle(ctx, "missing", &core.LifecycleConfig{Days: 1}))
+	assert.NoError(t, m.CreateBucket(ctx, "bucket", ""))
+
+	assert.NoError(t, m.SetLifeCycle(ctx, "bucket", &core.LifecycleConfig{Days: 7}))
+	// The shorthand rule is merged by its ID like any other.
+	update := &core.LifecycleConfig{Rules: []core.LifecycleRule{
+		{ID: "bucket-lifecycle-rule", ExpirationDays: 30},
+		{ID: "noncurrent", NoncurrentExpirationDays: 90},
+	}}
+	assert.NoError(t, m.SetLifeCycle(ctx, "bucket", update))
+	cfg, err := m.GetLifeCycle(ctx, "bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.LifecycleRule{
+		{ID: "bucket-lifecycle-rule", ExpirationDays: 30},
+		{ID: "noncurrent", NoncurrentExpirationDays: 90},
+	}, cfg.Rules)
+
+	// Incomplete or duplicate rules are rejected.
+	for _, cfg := range []*core.LifecycleConfig{
+		nil,
+		{},
+		{Rules: []core.LifecycleRule{{ExpirationDays: 1}}},
+		{Rules: []core.LifecycleRule{{ID: "none"}}},
+		{Rules: []core.LifecycleRule{{ID: "a", ExpirationDays: 1}, {ID: "a", ExpirationDays: 2}}},
+		{Rules: []core.LifecycleRule{{ID: "t", Transition: &core.LifecycleTransition{Days: 1}}}},
+	} {
+		assert.Error(t, m.SetLifeCycle(ctx, "bucket", cfg))
+	}
+
+	assert.NoError(t, m.DeleteLifeCycle(ctx, "bucket", "noncurrent"))
+	cfg, err = m.GetLifeCycle(ctx, "bucket")
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Rules, 1)
+	assert.NoError(t, m.DeleteLifeCycle(ctx, "bucket"))
+	cfg, err = m.GetLifeCycle(ctx, "bucket")
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Rules)
+}
+
+func TestVersioning(t *testing.T) {
+	m := NewEngine("")
+	ctx := context.Background()
+	assert.Error(t, m.EnableVersioning(ctx, "missing"))
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("v0"), nil))
+	assert.NoError(t, m.EnableVersioning(ctx, "bucket"))
+	status, err := m.GetVersioning(ctx, "bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningEnabled, status)
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("v1"), nil))
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("v2"), nil))
+
+	versions, err := m.ListObjectVersions(ctx, "bucket", "")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, "null", versions[2].VersionID)
+	v1, err := m.With(core.Options{VersionID: versions[1].VersionID})
+	assert.NoError(t, err)
+	got, err := v1.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(got))
+	url, err := m.SignedURL(ctx, "bucket", "a.txt", &core.SignedURLOptions{VersionID: "null"})
+	assert.NoError(t, err)
+	assert.Contains(t, url, "versionId=null")
+
+	// Restoring copies the version over the current object.
+	assert.NoError(t, v1.CopyFile(ctx, "bucket", "a.txt", "bucket", "a.txt"))
+	got, _ = m.GetContent(ctx, "bucket", "a.txt")
+	assert.Equal(t, "v1", string(got))
+
+	// A delete keeps the object as a noncurrent version; deleting a version
+	// is for good, and deleting the current one brings back the newest.
+	assert.NoError(t, m.DeleteFile(ctx, "bucket", "a.txt"))
+	assert.False(t, m.FileExist(ctx, "bucket", "a.txt"))
+	versions, _ = m.ListObjectVersions(ctx, "bucket", "")
+	assert.Len(t, versions, 4)
+	assert.NoError(t, v1.DeleteFile(ctx, "bucket", "a.txt"))
+	assert.False(t, v1.FileExist(ctx, "bucket", "a.txt"))
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("v3"), nil))
+	info, err := m.StatFile(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	version, err := m.With(core.Options{VersionID: info.VersionID})
+	assert.NoError(t, err)
+	assert.NoError(t, version.DeleteFile(ctx, "bucket", "a.txt"))
+	got, _ = m.GetContent(ctx, "bucket", "a.txt")
+	assert.Equal(t, "v1", string(got))
+
+	// Suspended, uploads replace the null version.
+	assert.NoError(t, m.SuspendVersioning(ctx, "bucket"))
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("s1"), nil))
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("s2"), nil))
+	versions, _ = m.ListObjectVersions(ctx, "bucket", "")
+	assert.Len(t, versions, 3)
+	assert.Equal(t, "null", versions[0].VersionID)
+}
+
+func TestObjectLock(t *testing.T) {
+	m := NewEngine("")
+	ctx := context.Background()
+	retention := &core.BucketRetention{Mode: core.RetentionCompliance, Years: 1}
+	assert.NoError(t, m.CreateBucket(ctx, "plain", ""))
+	assert.Error(t, m.SetBucketRetention(ctx, "plain", retention))
+	locking, err := m.With(core.Options{ObjectLock: true})
+	assert.NoError(t, err)
+	assert.NoError(t, locking.CreateBucket(ctx, "records", ""))
+	assert.NoError(t, m.SetBucketRetention(ctx, "records", retention))
+	got, err := m.GetBucketRetention(ctx, "records")
+	assert.NoError(t, err)
+	assert.Equal(t, retention, got)
+
+	assert.NoError(t, m.UploadFile(ctx, "records", "a.txt", []byte("a"), nil))
+	objectRetention, err := m.GetObjectRetention(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, core.RetentionCompliance, objectRetention.Mode)
+	bound, err := m.With(core.Options{GovernanceBypass: true})
+	assert.NoError(t, err)
+	bypass := bound.(*Memory)
+	assert.ErrorIs(t, bypass.DeleteFile(ctx, "records", "a.txt"), core.ErrObjectLocked)
+	assert.ErrorIs(t, m.UploadFile(ctx, "records", "a.txt", []byte("b"), nil), core.ErrObjectLocked)
+	assert.ErrorIs(t, bypass.SetObjectRetention(ctx, "records", "a.txt", nil), core.ErrObjectLocked)
+
+	// Without a default retention, only the legal hold locks.
+	assert.NoError(t, m.SetBucketRetention(ctx, "records", nil))
+	assert.NoError(t, m.UploadFile(ctx, "records", "b.txt", []byte("b"), nil))
+	assert.NoError(t, m.SetLegalHold(ctx, "records", "b.txt", true))
+	hold, err := m.GetLegalHold(ctx, "records", "b.txt")
+	assert.NoError(t, err)
+	assert.True(t, hold)
+	assert.ErrorIs(t, m.DeleteFile(ctx, "records", "b.txt"), core.ErrObjectLocked)
+	assert.NoError(t, m.SetLegalHold(ctx, "records", "b.txt", false))
+	assert.NoError(t, m.DeleteFile(ctx, "records", "b.txt"))
+}
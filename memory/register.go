@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"context"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+)
+
+func init() {
+	storage.Register("mem", func(_ context.Context, cfg storage.Config) (core.Storage, error) {
+		return NewEngine(cfg.Addr), nil
+	})
+}
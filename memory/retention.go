@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// checkLock returns a wrapped core.ErrObjectLocked when the object may not
+// be deleted or overwritten.
+func (o *object) checkLock(bypass bool) error {
+	return core.CheckObjectLock(o.retention, o.legalHold, bypass)
+}
+
+// lockedBucket returns a bucket created with object lock. The caller holds
+// m.mu.
+func (m *Memory) lockedBucket(bucketName string) (*bucket, error) {
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	if !b.objectLock {
+		return nil, fmt.Errorf("go-storage: bucket %q has no object lock", bucketName)
+	}
+	return b, nil
+}
+
+// SetBucketRetention sets the default retention of objects written to the
+// bucket from now on. The bucket must have been created with
+// core.Options.ObjectLock.
+func (m *Memory) SetBucketRetention(
+	_ context.Context,
+	bucketName string,
+	retention *core.BucketRetention,
+) error {
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+		copied := *retention
+		retention = &copied
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.lockedBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	b.retention = retention
+	return nil
+}
+
+// GetBucketRetention returns the default retention, or nil when there is
+// none.
+func (m *Memory) GetBucketRetention(
+	_ context.Context,
+	bucketName string,
+) (*core.BucketRetention, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	if b.retention == nil {
+		return nil, nil
+	}
+	retention := *b.retention
+	return &retention, nil
+}
+
+// SetObjectRetention locks an object version until a date. Active retention
+// can only be extended, unless it is governance retention and the engine
+// is bound with core.Options.GovernanceBypass.
+func (m *Memory) SetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+	retention *core.ObjectRetention,
+) error {
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+		copied := *retention
+		retention = &copied
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.lockedBucket(bucketName); err != nil {
+		return err
+	}
+	obj, err := m.lookup("retention", bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	bypass := m.opts.GovernanceBypass
+	if err := core.CheckRetentionChange(obj.retention, retention, bypass); err != nil {
+		return err
+	}
+	obj.retention = retention
+	return nil
+}
+
+// GetObjectRetention returns the object retention, or nil when there is
+// none.
+func (m *Memory) GetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectRetention, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.lookup("retention", bucketName, fileName)
+	if err != nil || obj.retention == nil {
+		return nil, err
+	}
+	retention := *obj.retention
+	return &retention, nil
+}
+
+// SetLegalHold places or releases a legal hold.
+func (m *Memory) SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.lockedBucket(bucketName); err != nil {
+		return err
+	}
+	obj, err := m.lookup("legal hold", bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	obj.legalHold = hold
+	return nil
+}
+
+// GetLegalHold reports whether an object version is under legal hold.
+func (m *Memory) GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.lookup("legal hold", bucketName, fileName)
+	if err != nil {
+		return false, err
+	}
+	return obj.legalHold, nil
+}
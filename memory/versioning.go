@@ -0,0 +1,170 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// nullVersion is the ID of an object written while versioning was off or
+// suspended, as on S3.
+const nullVersion = "null"
+
+func currentVersion(obj *object) string {
+	if obj.versionID == "" {
+		return nullVersion
+	}
+	return obj.versionID
+}
+
+// store makes obj the current object at name. When versioning is on, the
+// object it replaces is kept as a noncurrent version, unless both are null
+// versions. A locked object is never replaced, and obj gets the default
+// retention of the bucket. The caller holds m.mu.
+func (b *bucket) store(name string, obj *object, bypass bool) error {
+	if current, ok := b.objects[name]; ok {
+		if err := current.checkLock(bypass); err != nil {
+			return err
+		}
+	}
+	if b.retention != nil {
+		obj.retention = &core.ObjectRetention{
+			Mode:        b.retention.Mode,
+			RetainUntil: b.retention.RetainUntil(obj.lastModified),
+		}
+	}
+	obj.versionID = ""
+	switch b.versioning {
+	case core.VersioningEnabled:
+		b.lastVersion++
+		obj.versionID = fmt.Sprintf("%020d", b.lastVersion)
+	case core.VersioningSuspended:
+		obj.versionID = nullVersion
+	}
+	if current, ok := b.objects[name]; ok && b.versioning != core.VersioningOff {
+		b.archive(name, current, obj.versionID == nullVersion)
+	}
+	if obj.versionID == nullVersion {
+		if i := b.findVersion(name, nullVersion); i >= 0 {
+			b.versions[name] = slices.Delete(b.versions[name], i, i+1)
+		}
+	}
+	b.objects[name] = obj
+	return nil
+}
+
+// archive adds obj to the noncurrent versions of name, unless dropNull is set
+// and obj is a null version.
+func (b *bucket) archive(name string, obj *object, dropNull bool) {
+	versionID := currentVersion(obj)
+	if dropNull && versionID == nullVersion {
+		return
+	}
+	archived := *obj
+	archived.versionID = versionID
+	b.versions[name] = slices.Insert(b.versions[name], 0, &archived)
+}
+
+// findVersion returns the index of a noncurrent version, or -1.
+func (b *bucket) findVersion(name, versionID string) int {
+	return slices.IndexFunc(b.versions[name], func(obj *object) bool {
+		return obj.versionID == versionID
+	})
+}
+
+// deleteVersion removes one version of name. Removing the current version
+// makes the newest noncurrent one current.
+func (b *bucket) deleteVersion(name, versionID string) {
+	if current, ok := b.objects[name]; ok && currentVersion(current) == versionID {
+		delete(b.objects, name)
+		if versions := b.versions[name]; len(versions) > 0 {
+			b.objects[name] = versions[0]
+			b.versions[name] = versions[1:]
+		}
+	} else if i := b.findVersion(name, versionID); i >= 0 {
+		b.versions[name] = slices.Delete(b.versions[name], i, i+1)
+	}
+	if len(b.versions[name]) == 0 {
+		delete(b.versions, name)
+	}
+}
+
+// EnableVersioning keeps the object replaced by every upload, copy or delete
+// as a noncurrent version.
+func (m *Memory) EnableVersioning(_ context.Context, bucketName string) error {
+	return m.setVersioning(bucketName, core.VersioningEnabled)
+}
+
+// SuspendVersioning stops keeping new versions. Noncurrent versions are kept.
+func (m *Memory) SuspendVersioning(_ context.Context, bucketName string) error {
+	return m.setVersioning(bucketName, core.VersioningSuspended)
+}
+
+func (m *Memory) setVersioning(bucketName string, status core.VersioningStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	b.versioning = status
+	return nil
+}
+
+// GetVersioning returns the bucket versioning status.
+func (m *Memory) GetVersioning(
+	_ context.Context,
+	bucketName string,
+) (core.VersioningStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return core.VersioningOff, fmt.Errorf("go-storage: bucket %q does not exist", bucketName)
+	}
+	return b.versioning, nil
+}
+
+// ListObjectVersions returns the current objects whose name starts with
+// prefix and their noncurrent versions. Deletes leave no delete marker.
+func (m *Memory) ListObjectVersions(
+	_ context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, notExist("list", bucketName, "")
+	}
+	var versions []core.ObjectVersion
+	for name, obj := range b.objects {
+		if strings.HasPrefix(name, prefix) {
+			info := obj.info(bucketName, name)
+			info.VersionID = currentVersion(obj)
+			versions = append(versions, core.ObjectVersion{ObjectInfo: info, IsLatest: true})
+		}
+	}
+	for name, objects := range b.versions {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		for _, obj := range objects {
+			versions = append(versions, core.ObjectVersion{ObjectInfo: obj.info(bucketName, name)})
+		}
+	}
+	// Within a name, the current object comes first and the noncurrent
+	// versions keep their newest-first order.
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, b := versions[i], versions[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.IsLatest && !b.IsLatest
+	})
+	return versions, nil
+}
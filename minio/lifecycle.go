@@ -0,0 +1,165 @@
+package minio
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+// SetLifeCycle merges the rules into the bucket lifecycle by ID. Existing
+// rules with other IDs are kept as they are.
+func (m *Minio) SetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	rules, err := opts.LifecycleRules(bucketName)
+	if err != nil {
+		return errInvalidArgument(err.Error())
+	}
+	config, err := m.lifecycle(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		rule := toRule(r)
+		i := slices.IndexFunc(config.Rules, func(c lifecycle.Rule) bool { return c.ID == r.ID })
+		if i < 0 {
+			config.Rules = append(config.Rules, rule)
+			continue
+		}
+		config.Rules[i] = rule
+	}
+	return m.client.SetBucketLifecycle(ctx, bucketName, config)
+}
+
+// GetLifeCycle returns the bucket lifecycle rules. Settings without a
+// core.LifecycleRule counterpart, such as size filters, are left out.
+func (m *Minio) GetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+) (*core.LifecycleConfig, error) {
+	config, err := m.lifecycle(ctx, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &core.LifecycleConfig{}
+	for _, r := range config.Rules {
+		cfg.Rules = append(cfg.Rules, fromRule(r))
+	}
+	return cfg, nil
+}
+
+// DeleteLifeCycle removes the rules with the given IDs, or the whole bucket
+// lifecycle when no ID is given.
+func (m *Minio) DeleteLifeCycle(ctx context.Context, bucketName string, ids ...string) error {
+	config := lifecycle.NewConfiguration()
+	if len(ids) > 0 {
+		var err error
+		if config, err = m.lifecycle(ctx, bucketName); err != nil {
+			return err
+		}
+		config.Rules = slices.DeleteFunc(config.Rules, func(r lifecycle.Rule) bool {
+			return slices.Contains(ids, r.ID)
+		})
+	}
+	// An empty configuration removes the bucket lifecycle.
+	return m.client.SetBucketLifecycle(ctx, bucketName, config)
+}
+
+// lifecycle returns the bucket lifecycle, empty when none is set.
+func (m *Minio) lifecycle(
+	ctx context.Context,
+	bucketName string,
+) (*lifecycle.Configuration, error) {
+	config, err := m.client.GetBucketLifecycle(ctx, bucketName)
+	if minio.ToErrorResponse(err).Code == "NoSuchLifecycleConfiguration" {
+		return lifecycle.NewConfiguration(), nil
+	}
+	return config, err
+}
+
+func toRule(r core.LifecycleRule) lifecycle.Rule {
+	rule := lifecycle.Rule{
+		ID:     r.ID,
+		Status: "Enabled",
+		Expiration: lifecycle.Expiration{
+			Days: lifecycle.ExpirationDays(r.ExpirationDays),
+		},
+		NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+			NoncurrentDays: lifecycle.ExpirationDays(r.NoncurrentExpirationDays),
+		},
+		AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: lifecycle.ExpirationDays(r.AbortIncompleteUploadDays),
+		},
+	}
+	if r.Disabled {
+		rule.Status = "Disabled"
+	}
+	if r.Transition != nil {
+		rule.Transition = lifecycle.Transition{
+			Days:         lifecycle.ExpirationDays(r.Transition.Days),
+			StorageClass: r.Transition.StorageClass,
+		}
+	}
+
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]lifecycle.Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, lifecycle.Tag{Key: k, Value: r.Tags[k]})
+	}
+	switch {
+	case len(tags) == 0:
+		rule.RuleFilter.Prefix = r.Prefix
+	case len(tags) == 1 && r.Prefix == "":
+		rule.RuleFilter.Tag = tags[0]
+	default:
+		rule.RuleFilter.And = lifecycle.And{Prefix: r.Prefix, Tags: tags}
+	}
+	return rule
+}
+
+func fromRule(r lifecycle.Rule) core.LifecycleRule {
+	rule := core.LifecycleRule{
+		ID:                        r.ID,
+		Disabled:                  r.Status == "Disabled",
+		Prefix:                    r.Prefix,
+		ExpirationDays:            int(r.Expiration.Days),
+		NoncurrentExpirationDays:  int(r.NoncurrentVersionExpiration.NoncurrentDays),
+		AbortIncompleteUploadDays: int(r.AbortIncompleteMultipartUpload.DaysAfterInitiation),
+	}
+	if r.Transition.StorageClass != "" {
+		rule.Transition = &core.LifecycleTransition{
+			Days:         int(r.Transition.Days),
+			StorageClass: r.Transition.StorageClass,
+		}
+	}
+
+	filter := r.RuleFilter
+	tags := filter.And.Tags
+	switch {
+	case !filter.And.IsEmpty():
+		rule.Prefix = filter.And.Prefix
+	case filter.Prefix != "":
+		rule.Prefix = filter.Prefix
+	}
+	if !filter.Tag.IsEmpty() {
+		tags = append(tags, filter.Tag)
+	}
+	for _, t := range tags {
+		if rule.Tags == nil {
+			rule.Tags = map[string]string{}
+		}
+		rule.Tags[t.Key] = t.Value
+	}
+	return rule
+}
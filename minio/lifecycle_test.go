@@ -0,0 +1,48 @@
+package minio
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleRules(t *testing.T) {
+	rules := []core.LifecycleRule{
+		{ID: "tmp", Prefix: "tmp/", ExpirationDays: 7},
+		{ID: "one-tag", Tags: map[string]string{"class": "log"}, ExpirationDays: 30},
+		{
+			ID:                        "archive",
+			Disabled:                  true,
+			Prefix:                    "logs/",
+			Tags:                      map[string]string{"b": "2", "a": "1"},
+			Transition:                &core.LifecycleTransition{Days: 30, StorageClass: "GLACIER"},
+			NoncurrentExpirationDays:  90,
+			AbortIncompleteUploadDays: 3,
+		},
+	}
+	for _, r := range rules {
+		rule := toRule(r)
+		assert.Equal(t, r, fromRule(rule))
+
+		// The rule survives the XML round trip to the server.
+		content, err := xml.Marshal(rule)
+		assert.NoError(t, err)
+		var decoded lifecycle.Rule
+		assert.NoError(t, xml.Unmarshal(content, &decoded))
+		assert.Equal(t, r, fromRule(decoded))
+	}
+
+	and := toRule(rules[2]).RuleFilter.And
+	assert.Equal(t, "logs/", and.Prefix)
+	assert.Equal(t, []lifecycle.Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}, and.Tags)
+
+	// Rules saved before IDs were merged keep the prefix at the top level.
+	legacy := lifecycle.Rule{ID: "old", Status: "Enabled", Prefix: "a/"}
+	legacy.Expiration.Days = 1
+	want := core.LifecycleRule{ID: "old", Prefix: "a/", ExpirationDays: 1}
+	assert.Equal(t, want, fromRule(legacy))
+}
@@ -3,61 +3,88 @@ package minio
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/appleboy/go-storage/core"
 
 	"github.com/cheggaaa/pb/v3"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
-	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/minio/minio-go/v7/pkg/s3utils"
 )
 
-var _ core.Storage = (*Minio)(nil)
+var (
+	_ core.Storage          = (*Minio)(nil)
+	_ core.Stater           = (*Minio)(nil)
+	_ core.Lister           = (*Minio)(nil)
+	_ core.Versioner        = (*Minio)(nil)
+	_ core.LifecycleManager = (*Minio)(nil)
+	_ core.Locker           = (*Minio)(nil)
+	_ core.ObjectReader     = (*Minio)(nil)
+	_ core.Binder           = (*Minio)(nil)
+)
+
+// streamPartSize is the part size of uploads of unknown length. minio-go
+// otherwise buffers parts sized for a 5 TiB object, about 576 MiB each; this
+// still allows objects up to 640 GiB.
+const streamPartSize = 64 << 20
 
 // Minio client
 type Minio struct {
-	client *minio.Client
-	core   *minio.Core
+	client     *minio.Client
+	core       *minio.Core
+	encryption *core.Encryption
+	opts       core.Options
 }
 
-// NewEngine struct
+// NewEngine struct. Without keys it uses the IAM role of the host.
 func NewEngine(
 	endpoint, accessID, secretKey string,
 	ssl, insecureSkipVerify bool,
 	region string,
 ) (*Minio, error) {
+	provider := StaticCredentials(accessID, secretKey, "")
+	// Fetching from IAM roles assigned to an EC2 instance.
+	if accessID == "" && secretKey == "" {
+		provider = IAMCredentials("")
+	}
+	return NewEngineWithOptions(
+		endpoint,
+		WithSSL(ssl),
+		WithInsecureSkipVerify(insecureSkipVerify),
+		WithRegion(region),
+		WithCredentials(provider),
+	)
+}
+
+// NewEngineWithOptions struct. Credentials default to DefaultCredentials.
+func NewEngineWithOptions(endpoint string, opts ...Option) (*Minio, error) {
 	if endpoint == "" {
 		return nil, errors.New("endpoint can't be empty")
 	}
-	opts := new(minio.Options)
-	opts.Region = region
-	opts.Secure = ssl
-	opts.Creds = credentials.NewStaticV4(accessID, secretKey, "")
-	opts.Transport = &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    30 * time.Second,
-		DisableCompression: true,
-		/* #nosec */
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipVerify},
+	o := &options{providers: DefaultCredentials()}
+	for _, opt := range opts {
+		opt(o)
 	}
-	// Fetching from IAM roles assigned to an EC2 instance.
-	if accessID == "" && secretKey == "" {
-		opts.Creds = credentials.NewIAM("")
+
+	mopts := new(minio.Options)
+	mopts.Region = o.region
+	mopts.Secure = o.ssl
+	mopts.Creds = credentials.NewChainCredentials(o.providers)
+	if len(o.providers) == 1 {
+		mopts.Creds = credentials.New(o.providers[0])
 	}
+	mopts.Transport = o.newTransport()
 
 	// Core embeds *minio.Client, so a single NewCore call provides both the
 	// high-level client and the lower-level core primitives.
-	core, err := minio.NewCore(endpoint, opts)
+	core, err := minio.NewCore(endpoint, mopts)
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +95,63 @@ func NewEngine(
 	}, nil
 }
 
+// SetEncryption sets the default server-side encryption for every call that
+// does not override it with core.Options. Call it before the engine is
+// shared between goroutines.
+func (m *Minio) SetEncryption(enc *core.Encryption) error {
+	if err := enc.Validate(); err != nil {
+		return err
+	}
+	m.encryption = enc
+	return nil
+}
+
+// With returns a copy of m that applies opts to every call.
+func (m *Minio) With(opts core.Options) (core.Storage, error) {
+	c := *m
+	c.opts = c.opts.Merge(opts)
+	return &c, nil
+}
+
+// serverSide resolves the encryption in effect into a minio-go value.
+func (m *Minio) serverSide() (encrypt.ServerSide, error) {
+	return newServerSide(m.opts.EncryptionOr(m.encryption))
+}
+
+func newServerSide(enc *core.Encryption) (encrypt.ServerSide, error) {
+	if err := enc.Validate(); err != nil {
+		return nil, errInvalidArgument(err.Error())
+	}
+	if enc == nil {
+		return nil, nil
+	}
+	switch enc.Type {
+	case core.EncryptionNone:
+		return nil, nil
+	case core.EncryptionS3:
+		return encrypt.NewSSE(), nil
+	case core.EncryptionKMS:
+		var kmsContext interface{}
+		if len(enc.KMSContext) > 0 {
+			kmsContext = enc.KMSContext
+		}
+		return encrypt.NewSSEKMS(enc.KMSKeyID, kmsContext)
+	case core.EncryptionCustomer:
+		return encrypt.NewSSEC(enc.CustomerKey)
+	default:
+		return nil, errInvalidArgument("unknown encryption type")
+	}
+}
+
+// customerKey keeps only SSE-C settings, the one mode where reads and copy
+// sources must resend the key; SSE-S3 and SSE-KMS headers are rejected there.
+func customerKey(sse encrypt.ServerSide) encrypt.ServerSide {
+	if sse != nil && sse.Type() == encrypt.SSEC {
+		return sse
+	}
+	return nil
+}
+
 // UploadFile to s3 server
 func (m *Minio) UploadFile(
 	ctx context.Context,
@@ -75,15 +159,25 @@ func (m *Minio) UploadFile(
 	content []byte,
 	reader io.Reader,
 ) error {
+	sse, err := m.serverSide()
+	if err != nil {
+		return err
+	}
 	opts := minio.PutObjectOptions{
-		ContentType: core.DetectContentType(content),
+		ContentType:          core.DetectContentType(content),
+		ServerSideEncryption: sse,
+	}
+	if uploadOpts := m.opts.Upload; uploadOpts != nil {
+		opts.UserMetadata = uploadOpts.Metadata
+		opts.CacheControl = uploadOpts.CacheControl
+		opts.ContentEncoding = uploadOpts.ContentEncoding
 	}
 	if reader != nil {
 		opts.Progress = reader
 	}
 
 	// Upload the zip file with FPutObject
-	_, err := m.client.PutObject(
+	_, err = m.client.PutObject(
 		ctx,
 		bucketName,
 		objectName,
@@ -103,6 +197,10 @@ func (m *Minio) UploadFileByReader(
 	contentType string,
 	length int64,
 ) error {
+	sse, err := m.serverSide()
+	if err != nil {
+		return err
+	}
 	if contentType == "" {
 		buffer := make([]byte, 512)
 		// Read up to a full 512-byte sniff window; a single Read may return
@@ -118,11 +216,20 @@ func (m *Minio) UploadFileByReader(
 	}
 
 	opts := minio.PutObjectOptions{
-		ContentType: contentType,
+		ContentType:          contentType,
+		ServerSideEncryption: sse,
+	}
+	if uploadOpts := m.opts.Upload; uploadOpts != nil {
+		opts.UserMetadata = uploadOpts.Metadata
+		opts.CacheControl = uploadOpts.CacheControl
+		opts.ContentEncoding = uploadOpts.ContentEncoding
+	}
+	if length < 0 {
+		opts.PartSize = streamPartSize
 	}
 
 	// Upload the zip file with FPutObject
-	_, err := m.client.PutObject(
+	_, err = m.client.PutObject(
 		ctx,
 		bucketName,
 		objectName,
@@ -145,7 +252,10 @@ func (m *Minio) CreateBucket(ctx context.Context, bucketName, region string) err
 		return nil
 	}
 
-	return m.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: region})
+	return m.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{
+		Region:        region,
+		ObjectLocking: m.opts.ObjectLock,
+	})
 }
 
 // FilePath for store path + file name
@@ -155,7 +265,10 @@ func (m *Minio) FilePath(_, fileName string) string {
 
 // DeleteFile delete file
 func (m *Minio) DeleteFile(ctx context.Context, bucketName, fileName string) error {
-	return m.client.RemoveObject(ctx, bucketName, fileName, minio.RemoveObjectOptions{})
+	return notExist(m.client.RemoveObject(ctx, bucketName, fileName, minio.RemoveObjectOptions{
+		VersionID:        m.opts.VersionID,
+		GovernanceBypass: m.opts.GovernanceBypass,
+	}))
 }
 
 // GetFileURL for storage host + bucket + filename
@@ -165,7 +278,14 @@ func (m *Minio) GetFileURL(bucketName, fileName string) string {
 
 // DownloadFile downloads and saves the object as a file in the local filesystem.
 func (m *Minio) DownloadFile(ctx context.Context, bucketName, fileName, target string) error {
-	return m.client.FGetObject(ctx, bucketName, fileName, target, minio.GetObjectOptions{})
+	sse, err := m.serverSide()
+	if err != nil {
+		return err
+	}
+	return notExist(m.client.FGetObject(ctx, bucketName, fileName, target, minio.GetObjectOptions{
+		ServerSideEncryption: customerKey(sse),
+		VersionID:            m.opts.VersionID,
+	}))
 }
 
 // DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
@@ -182,7 +302,14 @@ func (m *Minio) DownloadFileByProgress(
 		return err
 	}
 
-	opts := minio.GetObjectOptions{}
+	sse, err := m.serverSide()
+	if err != nil {
+		return err
+	}
+	opts := minio.GetObjectOptions{
+		ServerSideEncryption: customerKey(sse),
+		VersionID:            m.opts.VersionID,
+	}
 
 	// Verify if destination already exists.
 	st, err := os.Stat(filePath)
@@ -212,7 +339,7 @@ func (m *Minio) DownloadFileByProgress(
 	// Gather md5sum.
 	objectStat, err := m.core.StatObject(ctx, bucketName, objectName, opts)
 	if err != nil {
-		return err
+		return notExist(err)
 	}
 
 	// Write to a temporary file "fileName.part.minio" before saving.
@@ -275,13 +402,21 @@ func (m *Minio) DownloadFileByProgress(
 
 // GetContent for storage bucket + filename
 func (m *Minio) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
-	object, err := m.client.GetObject(ctx, bucketName, fileName, minio.GetObjectOptions{})
+	sse, err := m.serverSide()
 	if err != nil {
 		return nil, err
 	}
+	object, err := m.client.GetObject(ctx, bucketName, fileName, minio.GetObjectOptions{
+		ServerSideEncryption: customerKey(sse),
+		VersionID:            m.opts.VersionID,
+	})
+	if err != nil {
+		return nil, notExist(err)
+	}
 	defer object.Close()
 
-	return io.ReadAll(object)
+	content, err := io.ReadAll(object)
+	return content, notExist(err)
 }
 
 // CopyFile copy src to dest
@@ -289,18 +424,26 @@ func (m *Minio) CopyFile(
 	ctx context.Context,
 	srcBucket, srcPath, destBucket, destPath string,
 ) error {
+	// The same settings decrypt an SSE-C source and encrypt the destination.
+	sse, err := m.serverSide()
+	if err != nil {
+		return err
+	}
 	src := minio.CopySrcOptions{
-		Bucket: srcBucket,
-		Object: srcPath,
+		Bucket:     srcBucket,
+		Object:     srcPath,
+		VersionID:  m.opts.VersionID,
+		Encryption: customerKey(sse),
 	}
 	// Destination object
 	dst := minio.CopyDestOptions{
-		Bucket: destBucket,
-		Object: destPath,
+		Bucket:     destBucket,
+		Object:     destPath,
+		Encryption: sse,
 	}
 	// Copy object call
-	_, err := m.client.CopyObject(ctx, dst, src)
-	return err
+	_, err = m.client.CopyObject(ctx, dst, src)
+	return notExist(err)
 }
 
 // BucketExists Checks if a bucket exists.
@@ -310,10 +453,122 @@ func (m *Minio) BucketExists(ctx context.Context, bucketName string) (found bool
 
 // FileExist check object exist. bucket + filename
 func (m *Minio) FileExist(ctx context.Context, bucketName, fileName string) bool {
-	_, err := m.client.StatObject(ctx, bucketName, fileName, minio.StatObjectOptions{})
+	sse, err := m.serverSide()
+	if err != nil {
+		return false
+	}
+	_, err = m.client.StatObject(ctx, bucketName, fileName, minio.StatObjectOptions{
+		ServerSideEncryption: customerKey(sse),
+		VersionID:            m.opts.VersionID,
+	})
 	return err == nil
 }
 
+// StatFile returns the object attributes. bucket + filename
+func (m *Minio) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	sse, err := m.serverSide()
+	if err != nil {
+		return nil, err
+	}
+	info, err := m.client.StatObject(ctx, bucketName, fileName, minio.StatObjectOptions{
+		ServerSideEncryption: customerKey(sse),
+		VersionID:            m.opts.VersionID,
+	})
+	if err != nil {
+		return nil, notExist(err)
+	}
+	return objectInfo(bucketName, info), nil
+}
+
+// NewReader streams the object with the attributes of the same GET
+// response.
+func (m *Minio) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	sse, err := m.serverSide()
+	if err != nil {
+		return nil, nil, err
+	}
+	body, info, _, err := m.core.GetObject(ctx, bucketName, fileName, minio.GetObjectOptions{
+		ServerSideEncryption: customerKey(sse),
+		VersionID:            m.opts.VersionID,
+	})
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	return body, objectInfo(bucketName, info), nil
+}
+
+func objectInfo(bucketName string, info minio.ObjectInfo) *core.ObjectInfo {
+	return &core.ObjectInfo{
+		Bucket:          bucketName,
+		Name:            info.Key,
+		Size:            info.Size,
+		ContentType:     info.ContentType,
+		CacheControl:    info.Metadata.Get("Cache-Control"),
+		ETag:            info.ETag,
+		LastModified:    info.LastModified,
+		Metadata:        core.LowerKeys(info.UserMetadata),
+		VersionID:       info.VersionID,
+		ContentEncoding: info.Metadata.Get("Content-Encoding"),
+		Encryption:      encryptionOf(info.Metadata),
+	}
+}
+
+// notExist marks the errors of missing objects, versions and buckets for
+// core.IsNotExist.
+func notExist(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket", "NoSuchVersion":
+		return core.NotExist(err)
+	}
+	return err
+}
+
+// encryptionOf reads the server-side encryption from object headers.
+func encryptionOf(header http.Header) core.EncryptionType {
+	if header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return core.EncryptionCustomer
+	}
+	switch header.Get("X-Amz-Server-Side-Encryption") {
+	case "aws:kms", "aws:kms:dsse":
+		return core.EncryptionKMS
+	case "AES256":
+		return core.EncryptionS3
+	}
+	return core.EncryptionNone
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (m *Minio) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	var objects []core.ObjectInfo
+	for info := range m.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, notExist(info.Err)
+		}
+		objects = append(objects, core.ObjectInfo{
+			Bucket:       bucketName,
+			Name:         info.Key,
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+			Metadata:     core.LowerKeys(info.UserMetadata),
+		})
+	}
+	return objects, nil
+}
+
 // Client get disk client
 func (m *Minio) Client() interface{} {
 	return m.client
@@ -329,23 +584,30 @@ func (m *Minio) SignedURL(
 		return "", errInvalidArgument("opts cannot be nil")
 	}
 
+	// An SSE-C object can only be inspected with its key. The presigned URL
+	// itself cannot carry the key: whoever fetches it must send the SSE-C
+	// headers.
+	sse, err := m.serverSide()
+	if err != nil {
+		return "", err
+	}
+
 	// Check if file exists
 	if _, err := m.client.StatObject(
 		ctx,
 		bucketName,
 		filename,
-		minio.StatObjectOptions{},
+		minio.StatObjectOptions{
+			ServerSideEncryption: customerKey(sse),
+			VersionID:            opts.VersionID,
+		},
 	); err != nil {
 		return "", err
 	}
 
-	var reqParams url.Values
-	if opts.DefaultFilename != "" {
-		reqParams = make(url.Values)
-		reqParams.Set(
-			"response-content-disposition",
-			`attachment; filename="`+opts.DefaultFilename+`"`,
-		)
+	reqParams := opts.ResponseParams()
+	if opts.VersionID != "" {
+		reqParams.Set("versionId", opts.VersionID)
 	}
 
 	url, err := m.client.PresignedGetObject(ctx, bucketName, filename, opts.Expiry, reqParams)
@@ -356,37 +618,6 @@ func (m *Minio) SignedURL(
 	return url.String(), nil
 }
 
-// SetLifeCycle set lifecycle on bucket or an object prefix.
-func (m *Minio) SetLifeCycle(
-	ctx context.Context,
-	bucketName string,
-	opts *core.LifecycleConfig,
-) error {
-	if opts == nil {
-		return errInvalidArgument("opts cannot be nil")
-	}
-	if opts.Days <= 0 {
-		return errInvalidArgument("Days must be greater than 0")
-	}
-	config := lifecycle.NewConfiguration()
-	rule := lifecycle.Rule{
-		ID:     bucketName + "-lifecycle-rule",
-		Status: "Enabled",
-		Expiration: lifecycle.Expiration{
-			Days: lifecycle.ExpirationDays(opts.Days),
-		},
-	}
-
-	if opts.Prefix != "" {
-		rule.RuleFilter = lifecycle.Filter{
-			Prefix: opts.Prefix,
-		}
-	}
-	config.Rules = []lifecycle.Rule{rule}
-
-	return m.client.SetBucketLifecycle(ctx, bucketName, config)
-}
-
 // errInvalidArgument - Invalid argument response.
 func errInvalidArgument(message string) error {
 	return minio.ErrorResponse{
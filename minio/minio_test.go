@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go/modules/minio"
 )
@@ -33,6 +37,95 @@ func TestSignedURLNilOpts(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestNewServerSide(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), core.CustomerKeySize)
+	tests := []struct {
+		name    string
+		enc     *core.Encryption
+		want    encrypt.Type
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "nil", enc: nil, wantNil: true},
+		{name: "none", enc: &core.Encryption{}, wantNil: true},
+		{name: "sse-s3", enc: &core.Encryption{Type: core.EncryptionS3}, want: encrypt.S3},
+		{
+			name: "sse-kms",
+			enc:  &core.Encryption{Type: core.EncryptionKMS, KMSKeyID: "my-key"},
+			want: encrypt.KMS,
+		},
+		{
+			name:    "sse-kms without key id",
+			enc:     &core.Encryption{Type: core.EncryptionKMS},
+			wantErr: true,
+		},
+		{
+			name: "sse-c",
+			enc:  &core.Encryption{Type: core.EncryptionCustomer, CustomerKey: key},
+			want: encrypt.SSEC,
+		},
+		{
+			name:    "sse-c short key",
+			enc:     &core.Encryption{Type: core.EncryptionCustomer, CustomerKey: []byte("short")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sse, err := newServerSide(tt.enc)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, sse)
+				return
+			}
+			assert.Equal(t, tt.want, sse.Type())
+		})
+	}
+}
+
+func TestEncryptionOptions(t *testing.T) {
+	client, err := NewEngine("localhost:9000", "minioadmin", "minioadmin", false, true, "us-east-1")
+	assert.NoError(t, err)
+	assert.NoError(t, client.SetEncryption(&core.Encryption{Type: core.EncryptionS3}))
+
+	// The engine default applies when the call does not override it.
+	sse, err := client.serverSide()
+	assert.NoError(t, err)
+	assert.Equal(t, encrypt.S3, sse.Type())
+	assert.Nil(t, customerKey(sse))
+
+	// A bound SSE-C key wins over the engine default and is resent on reads.
+	bound, err := client.With(core.Options{Encryption: &core.Encryption{
+		Type:        core.EncryptionCustomer,
+		CustomerKey: bytes.Repeat([]byte("k"), core.CustomerKeySize),
+	}})
+	assert.NoError(t, err)
+	sse, err = bound.(*Minio).serverSide()
+	assert.NoError(t, err)
+	assert.Equal(t, encrypt.SSEC, sse.Type())
+	assert.Equal(t, sse, customerKey(sse))
+}
+
+func TestEncryptionOf(t *testing.T) {
+	tests := map[string]core.EncryptionType{
+		"":        core.EncryptionNone,
+		"AES256":  core.EncryptionS3,
+		"aws:kms": core.EncryptionKMS,
+	}
+	for value, want := range tests {
+		header := http.Header{}
+		header.Set("X-Amz-Server-Side-Encryption", value)
+		assert.Equal(t, want, encryptionOf(header), value)
+	}
+	header := http.Header{}
+	header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	assert.Equal(t, core.EncryptionCustomer, encryptionOf(header))
+}
+
 func TestCreateBucket(t *testing.T) {
 	minioContainer, err := getMinio()
 	assert.NoError(t, err)
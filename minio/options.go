@@ -0,0 +1,303 @@
+package minio
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// DefaultSTSEndpoint is used by the STS providers when no endpoint is given.
+const DefaultSTSEndpoint = "https://sts.amazonaws.com"
+
+// Option configures the engine built by NewEngineWithOptions.
+type Option func(*options)
+
+type options struct {
+	region             string
+	ssl                bool
+	insecureSkipVerify bool
+	providers          []credentials.Provider
+	tlsConfig          *tls.Config
+	proxy              *url.URL
+	transportOptions   TransportOptions
+	transport          http.RoundTripper
+}
+
+// WithRegion sets the bucket region. Empty looks it up per bucket.
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithSSL connects over https.
+func WithSSL(ssl bool) Option {
+	return func(o *options) {
+		o.ssl = ssl
+	}
+}
+
+// WithInsecureSkipVerify skips TLS certificate verification.
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(o *options) {
+		o.insecureSkipVerify = skip
+	}
+}
+
+// WithTLSConfig sets the TLS client config, for a private CA bundle or
+// client certificates. See LoadTLSConfig.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithProxy sends requests through an HTTP(S) proxy. Without it the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply.
+func WithProxy(proxy *url.URL) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// TransportOptions tunes the connection pool and timeouts. Zero fields keep
+// the defaults.
+type TransportOptions struct {
+	// MaxIdleConns defaults to 10.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout defaults to 30s.
+	IdleConnTimeout time.Duration
+	// DialTimeout defaults to 30s.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout defaults to 10s.
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+}
+
+// WithTransportOptions tunes the connection pool and timeouts.
+func WithTransportOptions(t TransportOptions) Option {
+	return func(o *options) {
+		o.transportOptions = t
+	}
+}
+
+// WithTransport replaces the HTTP transport. The TLS, proxy and transport
+// options are then ignored.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// LoadTLSConfig builds a TLS client config that trusts the PEM certificates
+// in caFile, in addition to the system pool, and presents the client
+// certificate in certFile and keyFile for mTLS. Empty names are skipped.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("go-storage: %s: no PEM certificates found", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("go-storage: client certificate needs a cert and key file")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// newTransport builds the HTTP transport from the options.
+func (o *options) newTransport() http.RoundTripper {
+	if o.transport != nil {
+		return o.transport
+	}
+	t := o.transportOptions
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.tlsConfig != nil {
+		tlsConfig = o.tlsConfig.Clone()
+	}
+	if o.insecureSkipVerify {
+		/* #nosec */
+		tlsConfig.InsecureSkipVerify = true
+	}
+	proxy := http.ProxyFromEnvironment
+	if o.proxy != nil {
+		proxy = http.ProxyURL(o.proxy)
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   orDefault(t.DialTimeout, 30*time.Second),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          orDefault(t.MaxIdleConns, 10),
+		MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+		IdleConnTimeout:       orDefault(t.IdleConnTimeout, 30*time.Second),
+		TLSHandshakeTimeout:   orDefault(t.TLSHandshakeTimeout, 10*time.Second),
+		ResponseHeaderTimeout: t.ResponseHeaderTimeout,
+		DisableCompression:    true,
+		TLSClientConfig:       tlsConfig,
+	}
+}
+
+func orDefault[T int | time.Duration](v, def T) T {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// WithCredentials sets the credential providers, tried in order until one
+// returns keys. Without it the engine uses DefaultCredentials.
+func WithCredentials(providers ...credentials.Provider) Option {
+	return func(o *options) {
+		o.providers = providers
+	}
+}
+
+// DefaultCredentials is the chain used when no credentials are given:
+// environment variables, the shared credentials file, then IAM, which also
+// covers ECS task roles and EKS web identity (IRSA).
+func DefaultCredentials() []credentials.Provider {
+	return []credentials.Provider{
+		EnvCredentials(),
+		FileCredentials("", ""),
+		IAMCredentials(""),
+	}
+}
+
+// StaticCredentials returns fixed keys. Empty keys fall through to the next
+// provider in a chain.
+func StaticCredentials(accessID, secretKey, sessionToken string) credentials.Provider {
+	return &credentials.Static{Value: credentials.Value{
+		AccessKeyID:     accessID,
+		SecretAccessKey: secretKey,
+		SessionToken:    sessionToken,
+		SignerType:      credentials.SignatureV4,
+	}}
+}
+
+// EnvCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, then MINIO_ROOT_USER and MINIO_ROOT_PASSWORD.
+func EnvCredentials() credentials.Provider {
+	return &credentials.Chain{Providers: []credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+	}}
+}
+
+// FileCredentials reads a profile from an AWS shared credentials file.
+// Empty filename means $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials;
+// empty profile means $AWS_PROFILE or "default".
+func FileCredentials(filename, profile string) credentials.Provider {
+	return &credentials.FileAWSCredentials{Filename: filename, Profile: profile}
+}
+
+// IAMCredentials fetches role credentials from the EC2 metadata service, the
+// ECS container endpoint, or STS with the EKS web identity token, whichever
+// the environment provides. Empty endpoint uses the AWS default.
+func IAMCredentials(endpoint string) credentials.Provider {
+	return &credentials.IAM{Endpoint: endpoint}
+}
+
+// AssumeRoleOptions for AssumeRoleCredentials
+type AssumeRoleOptions struct {
+	// STSEndpoint defaults to DefaultSTSEndpoint.
+	STSEndpoint string
+	// AccessID, SecretKey and SessionToken are the caller's own keys.
+	AccessID        string
+	SecretKey       string
+	SessionToken    string
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	// Region of the STS endpoint.
+	Region string
+	// DurationSeconds defaults to one hour.
+	DurationSeconds int
+}
+
+// AssumeRoleCredentials exchanges the caller's keys for temporary role
+// credentials with STS AssumeRole.
+func AssumeRoleCredentials(opts AssumeRoleOptions) (credentials.Provider, error) {
+	if opts.AccessID == "" || opts.SecretKey == "" {
+		return nil, errors.New("go-storage: assume role needs an access key and secret key")
+	}
+	return &credentials.STSAssumeRole{
+		STSEndpoint: stsEndpoint(opts.STSEndpoint),
+		Options: credentials.STSAssumeRoleOptions{
+			AccessKey:       opts.AccessID,
+			SecretKey:       opts.SecretKey,
+			SessionToken:    opts.SessionToken,
+			Location:        opts.Region,
+			DurationSeconds: opts.DurationSeconds,
+			RoleARN:         opts.RoleARN,
+			RoleSessionName: opts.RoleSessionName,
+			ExternalID:      opts.ExternalID,
+		},
+	}, nil
+}
+
+// WebIdentityCredentials exchanges the OIDC token in tokenFile for role
+// credentials with STS AssumeRoleWithWebIdentity. The file is read on every
+// refresh, so rotated Kubernetes service account tokens are picked up.
+// Empty tokenFile and roleARN fall back to $AWS_WEB_IDENTITY_TOKEN_FILE and
+// $AWS_ROLE_ARN, as set by EKS.
+func WebIdentityCredentials(
+	endpoint, roleARN, tokenFile string,
+) (credentials.Provider, error) {
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	if roleARN == "" {
+		roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+	if tokenFile == "" {
+		return nil, errors.New("go-storage: web identity needs a token file")
+	}
+	return &credentials.STSWebIdentity{
+		STSEndpoint: stsEndpoint(endpoint),
+		RoleARN:     roleARN,
+		GetWebIDTokenExpiry: func() (*credentials.WebIdentityToken, error) {
+			token, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return nil, err
+			}
+			return &credentials.WebIdentityToken{
+				Token: strings.TrimSpace(string(token)),
+			}, nil
+		},
+	}, nil
+}
+
+func stsEndpoint(endpoint string) string {
+	if endpoint == "" {
+		return DefaultSTSEndpoint
+	}
+	return endpoint
+}
@@ -0,0 +1,101 @@
+package minio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	storage "github.com/appleboy/go-storage"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialChain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(file, []byte(
+		"[ci]\naws_access_key_id = file-id\naws_secret_access_key = file-secret\n",
+	), 0o600))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", file)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("MINIO_ROOT_USER", "")
+	t.Setenv("MINIO_ROOT_PASSWORD", "")
+
+	providers, err := providersFromConfig(storage.Config{
+		Credentials: []string{"static", "env", "file"},
+		Profile:     "ci",
+	})
+	assert.NoError(t, err)
+	value, err := credentials.NewChainCredentials(providers).Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "file-id", value.AccessKeyID)
+
+	// Environment keys win once set, as they come first.
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "env-token")
+	value, err = credentials.NewChainCredentials(providers).Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "env-id", value.AccessKeyID)
+	assert.Equal(t, "env-token", value.SessionToken)
+}
+
+func TestProvidersFromConfig(t *testing.T) {
+	providers, err := providersFromConfig(storage.Config{
+		AccessID: "id", SecretKey: "secret", SessionToken: "token",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StaticCredentials("id", "secret", "token"), providers[0])
+
+	providers, err = providersFromConfig(storage.Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, &credentials.IAM{}, providers[0])
+
+	providers, err = providersFromConfig(storage.Config{
+		Credentials: []string{"assume_role"},
+		AccessID:    "id",
+		SecretKey:   "secret",
+		RoleARN:     "arn:aws:iam::1:role/uploader",
+	})
+	assert.NoError(t, err)
+	role := providers[0].(*credentials.STSAssumeRole)
+	assert.Equal(t, DefaultSTSEndpoint, role.STSEndpoint)
+	assert.Equal(t, "arn:aws:iam::1:role/uploader", role.Options.RoleARN)
+
+	_, err = providersFromConfig(storage.Config{Credentials: []string{"assume_role"}})
+	assert.Error(t, err)
+
+	token := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(token, []byte("jwt\n"), 0o600))
+	providers, err = providersFromConfig(storage.Config{
+		Credentials:          []string{"web_identity"},
+		WebIdentityTokenFile: token,
+		RoleARN:              "arn:aws:iam::1:role/pod",
+	})
+	assert.NoError(t, err)
+	web := providers[0].(*credentials.STSWebIdentity)
+	got, err := web.GetWebIDTokenExpiry()
+	assert.NoError(t, err)
+	assert.Equal(t, "jwt", got.Token)
+
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	_, err = providersFromConfig(storage.Config{Credentials: []string{"web_identity"}})
+	assert.Error(t, err)
+
+	_, err = providersFromConfig(storage.Config{Credentials: []string{"vault"}})
+	assert.ErrorContains(t, err, `unknown credential source "vault"`)
+}
+
+func TestNewEngineWithOptions(t *testing.T) {
+	_, err := NewEngineWithOptions("")
+	assert.Error(t, err)
+
+	engine, err := NewEngineWithOptions(
+		"localhost:9000",
+		WithRegion("us-east-1"),
+		WithCredentials(StaticCredentials("id", "secret", "")),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "http", engine.client.EndpointURL().Scheme)
+}
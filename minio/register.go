@@ -0,0 +1,126 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func init() {
+	storage.Register("s3", func(_ context.Context, cfg storage.Config) (core.Storage, error) {
+		providers, err := providersFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := transportFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			WithSSL(cfg.SSL),
+			WithInsecureSkipVerify(cfg.InsecureSkipVerify),
+			WithRegion(cfg.Region),
+			WithCredentials(providers...),
+		)
+		engine, err := NewEngineWithOptions(cfg.Endpoint, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := engine.SetEncryption(cfg.Encryption); err != nil {
+			return nil, err
+		}
+		return engine, nil
+	})
+}
+
+// transportFromConfig builds the TLS, proxy and pool options.
+func transportFromConfig(cfg storage.Config) ([]Option, error) {
+	opts := []Option{WithTransportOptions(TransportOptions{
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       time.Duration(cfg.IdleConnTimeout),
+		DialTimeout:           time.Duration(cfg.DialTimeout),
+		TLSHandshakeTimeout:   time.Duration(cfg.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(cfg.ResponseHeaderTimeout),
+	})}
+	if cfg.CAFile != "" || cfg.CertFile != "" || cfg.KeyFile != "" {
+		tlsConfig, err := LoadTLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLSConfig(tlsConfig))
+	}
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			// url.Error quotes the input, which may hold a password.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return nil, fmt.Errorf("go-storage: invalid proxy: %w", err)
+		}
+		opts = append(opts, WithProxy(proxy))
+	}
+	return opts, nil
+}
+
+// providersFromConfig builds the credential chain named by cfg.Credentials.
+func providersFromConfig(cfg storage.Config) ([]credentials.Provider, error) {
+	sources := cfg.Credentials
+	if len(sources) == 0 {
+		sources = []string{"static"}
+		if cfg.AccessID == "" && cfg.SecretKey == "" {
+			sources = []string{"iam"}
+		}
+	}
+
+	providers := make([]credentials.Provider, 0, len(sources))
+	for _, source := range sources {
+		var provider credentials.Provider
+		var err error
+		switch source {
+		case "static":
+			provider = StaticCredentials(cfg.AccessID, cfg.SecretKey, cfg.SessionToken)
+		case "env":
+			provider = EnvCredentials()
+		case "file":
+			provider = FileCredentials("", cfg.Profile)
+		case "iam":
+			provider = IAMCredentials("")
+		case "assume_role":
+			provider, err = AssumeRoleCredentials(AssumeRoleOptions{
+				STSEndpoint:     cfg.STSEndpoint,
+				AccessID:        cfg.AccessID,
+				SecretKey:       cfg.SecretKey,
+				SessionToken:    cfg.SessionToken,
+				RoleARN:         cfg.RoleARN,
+				RoleSessionName: cfg.RoleSessionName,
+				ExternalID:      cfg.ExternalID,
+				Region:          cfg.Region,
+			})
+		case "web_identity":
+			provider, err = WebIdentityCredentials(
+				cfg.STSEndpoint, cfg.RoleARN, cfg.WebIdentityTokenFile,
+			)
+		default:
+			err = fmt.Errorf(
+				"go-storage: unknown credential source %q, want static, env, file, iam, "+
+					"assume_role or web_identity",
+				source,
+			)
+		}
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
@@ -0,0 +1,119 @@
+package minio
+
+import (
+	"context"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SetBucketRetention sets the default retention of new objects. The bucket
+// must have been created with core.Options.ObjectLock.
+func (m *Minio) SetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+	retention *core.BucketRetention,
+) error {
+	if retention == nil {
+		return m.client.SetObjectLockConfig(ctx, bucketName, nil, nil, nil)
+	}
+	if err := retention.Validate(); err != nil {
+		return err
+	}
+	mode := minio.RetentionMode(retention.Mode)
+	validity, unit := uint(retention.Days), minio.Days
+	if retention.Years > 0 {
+		validity, unit = uint(retention.Years), minio.Years
+	}
+	return m.client.SetObjectLockConfig(ctx, bucketName, &mode, &validity, &unit)
+}
+
+// GetBucketRetention returns the default retention, or nil when there is
+// none.
+func (m *Minio) GetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+) (*core.BucketRetention, error) {
+	_, mode, validity, unit, err := m.client.GetObjectLockConfig(ctx, bucketName)
+	if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+		return nil, nil
+	}
+	if err != nil || mode == nil || validity == nil || unit == nil {
+		return nil, err
+	}
+	retention := &core.BucketRetention{Mode: core.RetentionMode(*mode)}
+	if *unit == minio.Years {
+		retention.Years = int(*validity)
+	} else {
+		retention.Days = int(*validity)
+	}
+	return retention, nil
+}
+
+// SetObjectRetention locks an object version until a date. Removing or
+// shortening governance retention needs core.Options.GovernanceBypass.
+func (m *Minio) SetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+	retention *core.ObjectRetention,
+) error {
+	opts := minio.PutObjectRetentionOptions{
+		GovernanceBypass: m.opts.GovernanceBypass,
+		VersionID:        m.opts.VersionID,
+	}
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+		mode := minio.RetentionMode(retention.Mode)
+		opts.Mode, opts.RetainUntilDate = &mode, &retention.RetainUntil
+	}
+	return m.client.PutObjectRetention(ctx, bucketName, fileName, opts)
+}
+
+// GetObjectRetention returns the object retention, or nil when there is
+// none.
+func (m *Minio) GetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectRetention, error) {
+	mode, until, err := m.client.GetObjectRetention(
+		ctx, bucketName, fileName, m.opts.VersionID)
+	if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+		return nil, nil
+	}
+	if err != nil || mode == nil || *mode == "" || until == nil {
+		return nil, err
+	}
+	return &core.ObjectRetention{
+		Mode:        core.RetentionMode(*mode),
+		RetainUntil: until.In(time.UTC),
+	}, nil
+}
+
+// SetLegalHold places or releases a legal hold.
+func (m *Minio) SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error {
+	status := minio.LegalHoldDisabled
+	if hold {
+		status = minio.LegalHoldEnabled
+	}
+	return m.client.PutObjectLegalHold(ctx, bucketName, fileName, minio.PutObjectLegalHoldOptions{
+		VersionID: m.opts.VersionID,
+		Status:    &status,
+	})
+}
+
+// GetLegalHold reports whether an object version is under legal hold.
+func (m *Minio) GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error) {
+	status, err := m.client.GetObjectLegalHold(ctx, bucketName, fileName,
+		minio.GetObjectLegalHoldOptions{VersionID: m.opts.VersionID})
+	if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+		return false, nil
+	}
+	if err != nil || status == nil {
+		return false, err
+	}
+	return *status == minio.LegalHoldEnabled, nil
+}
@@ -0,0 +1,69 @@
+package minio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectLock(t *testing.T) {
+	minioContainer, err := getMinio()
+	assert.NoError(t, err)
+	defer func() {
+		err := minioContainer.Terminate(context.Background())
+		assert.NoError(t, err)
+	}()
+
+	conStr, err := minioContainer.ConnectionString(context.Background())
+	assert.NoError(t, err)
+	client, err := NewEngine(conStr, "minioadmin", "minioadmin", false, true, "us-east-1")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	locking, err := client.With(core.Options{ObjectLock: true})
+	assert.NoError(t, err)
+	assert.NoError(t, locking.CreateBucket(ctx, "records", "us-east-1"))
+	retention, err := client.GetBucketRetention(ctx, "records")
+	assert.NoError(t, err)
+	assert.Nil(t, retention)
+	want := &core.BucketRetention{Mode: core.RetentionGovernance, Days: 1}
+	assert.NoError(t, client.SetBucketRetention(ctx, "records", want))
+	retention, err = client.GetBucketRetention(ctx, "records")
+	assert.NoError(t, err)
+	assert.Equal(t, want, retention)
+
+	// New objects get the default retention.
+	assert.NoError(t, client.UploadFile(ctx, "records", "a.txt", []byte("a"), nil))
+	info, err := client.StatFile(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	bound, err := client.With(core.Options{VersionID: info.VersionID})
+	assert.NoError(t, err)
+	version := bound.(*Minio)
+	objectRetention, err := version.GetObjectRetention(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, core.RetentionGovernance, objectRetention.Mode)
+	assert.Error(t, version.DeleteFile(ctx, "records", "a.txt"))
+
+	assert.NoError(t, version.SetLegalHold(ctx, "records", "a.txt", true))
+	hold, err := version.GetLegalHold(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	assert.True(t, hold)
+	bound, err = version.With(core.Options{GovernanceBypass: true})
+	assert.NoError(t, err)
+	bypass := bound.(*Minio)
+	assert.Error(t, bypass.DeleteFile(ctx, "records", "a.txt"))
+	assert.NoError(t, version.SetLegalHold(ctx, "records", "a.txt", false))
+
+	// Governance retention gives way to the bypass.
+	assert.NoError(t, bypass.SetObjectRetention(ctx, "records", "a.txt",
+		&core.ObjectRetention{
+			Mode:        core.RetentionGovernance,
+			RetainUntil: time.Now().Add(time.Minute),
+		}))
+	assert.NoError(t, bypass.DeleteFile(ctx, "records", "a.txt"))
+	assert.NoError(t, client.SetBucketRetention(ctx, "records", nil))
+}
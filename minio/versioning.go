@@ -0,0 +1,64 @@
+package minio
+
+import (
+	"context"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// EnableVersioning keeps every version of the bucket's objects.
+func (m *Minio) EnableVersioning(ctx context.Context, bucketName string) error {
+	return m.client.EnableVersioning(ctx, bucketName)
+}
+
+// SuspendVersioning stops keeping new versions.
+func (m *Minio) SuspendVersioning(ctx context.Context, bucketName string) error {
+	return m.client.SuspendVersioning(ctx, bucketName)
+}
+
+// GetVersioning returns the bucket versioning status.
+func (m *Minio) GetVersioning(
+	ctx context.Context,
+	bucketName string,
+) (core.VersioningStatus, error) {
+	cfg, err := m.client.GetBucketVersioning(ctx, bucketName)
+	if err != nil {
+		return core.VersioningOff, err
+	}
+	return core.VersioningStatus(cfg.Status), nil
+}
+
+// ListObjectVersions returns every version of the objects whose name starts
+// with prefix, delete markers included.
+func (m *Minio) ListObjectVersions(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectVersion, error) {
+	var versions []core.ObjectVersion
+	for info := range m.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		versions = append(versions, core.ObjectVersion{
+			ObjectInfo: core.ObjectInfo{
+				Bucket:       bucketName,
+				Name:         info.Key,
+				Size:         info.Size,
+				ContentType:  info.ContentType,
+				ETag:         info.ETag,
+				LastModified: info.LastModified,
+				Metadata:     core.LowerKeys(info.UserMetadata),
+				VersionID:    info.VersionID,
+			},
+			IsLatest:     info.IsLatest,
+			DeleteMarker: info.IsDeleteMarker,
+		})
+	}
+	return versions, nil
+}
@@ -0,0 +1,67 @@
+package minio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersioning(t *testing.T) {
+	minioContainer, err := getMinio()
+	assert.NoError(t, err)
+	defer func() {
+		err := minioContainer.Terminate(context.Background())
+		assert.NoError(t, err)
+	}()
+
+	conStr, err := minioContainer.ConnectionString(context.Background())
+	assert.NoError(t, err)
+	client, err := NewEngine(conStr, "minioadmin", "minioadmin", false, true, "us-east-1")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, client.CreateBucket(ctx, "testbucket", "us-east-1"))
+	status, err := client.GetVersioning(ctx, "testbucket")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningOff, status)
+	assert.NoError(t, client.EnableVersioning(ctx, "testbucket"))
+	status, err = client.GetVersioning(ctx, "testbucket")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningEnabled, status)
+
+	assert.NoError(t, client.UploadFile(ctx, "testbucket", "a.txt", []byte("v1"), nil))
+	first, err := client.StatFile(ctx, "testbucket", "a.txt")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first.VersionID)
+	assert.NoError(t, client.UploadFile(ctx, "testbucket", "a.txt", []byte("v2"), nil))
+
+	v1, err := client.With(core.Options{VersionID: first.VersionID})
+	assert.NoError(t, err)
+	content, err := v1.GetContent(ctx, "testbucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	// A delete leaves a delete marker on top of both versions.
+	assert.NoError(t, client.DeleteFile(ctx, "testbucket", "a.txt"))
+	versions, err := client.ListObjectVersions(ctx, "testbucket", "")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.True(t, versions[0].DeleteMarker)
+	assert.True(t, versions[0].IsLatest)
+
+	// Restore by copying the old version over the object.
+	assert.NoError(t, v1.CopyFile(ctx, "testbucket", "a.txt", "testbucket", "a.txt"))
+	content, err = client.GetContent(ctx, "testbucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	assert.NoError(t, v1.DeleteFile(ctx, "testbucket", "a.txt"))
+	assert.False(t, v1.FileExist(ctx, "testbucket", "a.txt"))
+	assert.NoError(t, client.SuspendVersioning(ctx, "testbucket"))
+	status, err = client.GetVersioning(ctx, "testbucket")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningSuspended, status)
+}
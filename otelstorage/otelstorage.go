@@ -0,0 +1,390 @@
+// Package otelstorage wraps a core.Storage with OpenTelemetry tracing and
+// metrics.
+//
+// Every operation gets a span named "storage.<Operation>" and is recorded in
+// three instruments:
+//
+//   - storage.operation.duration: latency histogram, in seconds
+//   - storage.operation.throughput: transfer rate histogram, in bytes per second
+//   - storage.operation.errors: counter of failed operations
+package otelstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/cheggaaa/pb/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	_ core.Storage      = (*Storage)(nil)
+	_ core.Stater       = (*Storage)(nil)
+	_ core.Lister       = (*Storage)(nil)
+	_ core.ObjectReader = (*Storage)(nil)
+	_ core.Binder       = (*Storage)(nil)
+)
+
+// ScopeName is the instrumentation scope of the tracer and meter.
+const ScopeName = "github.com/appleboy/go-storage/otelstorage"
+
+// Attribute keys set on spans and metrics.
+const (
+	DriverKey    = attribute.Key("storage.driver")
+	OperationKey = attribute.Key("storage.operation")
+	BucketKey    = attribute.Key("storage.bucket")
+	ObjectKey    = attribute.Key("storage.object")
+	BytesKey     = attribute.Key("storage.bytes")
+)
+
+// Config for instrumentation
+type Config struct {
+	// Driver names the wrapped backend, e.g. "s3", "gcs" or "disk".
+	Driver string
+	// TracerProvider defaults to the global provider.
+	TracerProvider trace.TracerProvider
+	// MeterProvider defaults to the global provider.
+	MeterProvider metric.MeterProvider
+	// HashObjectKeys records a SHA-256 of object keys instead of the raw
+	// key, for keys that may carry personal data.
+	HashObjectKeys bool
+}
+
+// Storage instrumented wrapper
+type Storage struct {
+	core.Storage
+	driver     string
+	hashKeys   bool
+	tracer     trace.Tracer
+	duration   metric.Float64Histogram
+	throughput metric.Float64Histogram
+	errors     metric.Int64Counter
+}
+
+// NewEngine struct
+func NewEngine(next core.Storage, cfg Config) (*Storage, error) {
+	if next == nil {
+		return nil, errors.New("go-storage: otelstorage needs a storage to wrap")
+	}
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := cfg.MeterProvider.Meter(ScopeName)
+
+	duration, err := meter.Float64Histogram(
+		"storage.operation.duration",
+		metric.WithDescription("Duration of storage operations."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	throughput, err := meter.Float64Histogram(
+		"storage.operation.throughput",
+		metric.WithDescription("Transfer rate of storage operations that move object data."),
+		metric.WithUnit("By/s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	errCounter, err := meter.Int64Counter(
+		"storage.operation.errors",
+		metric.WithDescription("Number of failed storage operations."),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		Storage:    next,
+		driver:     cfg.Driver,
+		hashKeys:   cfg.HashObjectKeys,
+		tracer:     cfg.TracerProvider.Tracer(ScopeName),
+		duration:   duration,
+		throughput: throughput,
+		errors:     errCounter,
+	}, nil
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() core.Storage {
+	return s.Storage
+}
+
+// With returns a copy of s over the wrapped storage bound to opts.
+func (s *Storage) With(opts core.Options) (core.Storage, error) {
+	next, err := core.With(s.Storage, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *s
+	c.Storage = next
+	return &c, nil
+}
+
+// op is one instrumented call.
+type op struct {
+	s     *Storage
+	span  trace.Span
+	start time.Time
+	attrs []attribute.KeyValue
+}
+
+func (s *Storage) begin(
+	ctx context.Context,
+	name, bucketName, objectName string,
+) (context.Context, *op) {
+	attrs := []attribute.KeyValue{
+		DriverKey.String(s.driver),
+		OperationKey.String(name),
+		BucketKey.String(bucketName),
+	}
+	spanAttrs := attrs
+	if objectName != "" {
+		spanAttrs = append(spanAttrs, ObjectKey.String(s.objectKey(objectName)))
+	}
+	ctx, span := s.tracer.Start(
+		ctx,
+		"storage."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(spanAttrs...),
+	)
+	return ctx, &op{s: s, span: span, start: time.Now(), attrs: attrs}
+}
+
+// end records the outcome. Pass a negative size when no object data moved.
+func (o *op) end(ctx context.Context, err error, size int64) {
+	elapsed := time.Since(o.start)
+	set := metric.WithAttributes(o.attrs...)
+
+	if size >= 0 {
+		o.span.SetAttributes(BytesKey.Int64(size))
+	}
+	if err != nil {
+		o.span.RecordError(err)
+		o.span.SetStatus(codes.Error, err.Error())
+		o.s.errors.Add(ctx, 1, set)
+	} else if size >= 0 && elapsed > 0 {
+		o.s.throughput.Record(ctx, float64(size)/elapsed.Seconds(), set)
+	}
+	o.s.duration.Record(ctx, elapsed.Seconds(), set)
+	o.span.End()
+}
+
+func (s *Storage) objectKey(name string) string {
+	if !s.hashKeys {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func fileSize(name string) int64 {
+	st, err := os.Stat(name)
+	if err != nil {
+		return -1
+	}
+	return st.Size()
+}
+
+// CreateBucket create bucket
+func (s *Storage) CreateBucket(ctx context.Context, bucketName, region string) error {
+	ctx, o := s.begin(ctx, "CreateBucket", bucketName, "")
+	err := s.Storage.CreateBucket(ctx, bucketName, region)
+	o.end(ctx, err, -1)
+	return err
+}
+
+// BucketExists Checks if a bucket exists.
+func (s *Storage) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	ctx, o := s.begin(ctx, "BucketExists", bucketName, "")
+	found, err := s.Storage.BucketExists(ctx, bucketName)
+	o.end(ctx, err, -1)
+	return found, err
+}
+
+// UploadFile to storage
+func (s *Storage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	ctx, o := s.begin(ctx, "UploadFile", bucketName, objectName)
+	err := s.Storage.UploadFile(ctx, bucketName, objectName, content, reader)
+	o.end(ctx, err, int64(len(content)))
+	return err
+}
+
+// ReaderIsBody reports whether the wrapped storage uploads the reader
+// passed to UploadFile.
+func (s *Storage) ReaderIsBody() bool {
+	return core.ReaderIsBody(s.Storage)
+}
+
+// UploadFileByReader to storage
+func (s *Storage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	ctx, o := s.begin(ctx, "UploadFileByReader", bucketName, objectName)
+	err := s.Storage.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+	o.end(ctx, err, length)
+	return err
+}
+
+// DeleteFile delete file
+func (s *Storage) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	ctx, o := s.begin(ctx, "DeleteFile", bucketName, fileName)
+	err := s.Storage.DeleteFile(ctx, bucketName, fileName)
+	o.end(ctx, err, -1)
+	return err
+}
+
+// DownloadFile downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFile(ctx context.Context, bucketName, objectName, filePath string) error {
+	ctx, o := s.begin(ctx, "DownloadFile", bucketName, objectName)
+	err := s.Storage.DownloadFile(ctx, bucketName, objectName, filePath)
+	size := int64(-1)
+	if err == nil {
+		size = fileSize(filePath)
+	}
+	o.end(ctx, err, size)
+	return err
+}
+
+// DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFileByProgress(
+	ctx context.Context,
+	bucketName, objectName, filePath string,
+	bar *pb.ProgressBar,
+) error {
+	ctx, o := s.begin(ctx, "DownloadFileByProgress", bucketName, objectName)
+	err := s.Storage.DownloadFileByProgress(ctx, bucketName, objectName, filePath, bar)
+	size := int64(-1)
+	if err == nil {
+		size = fileSize(filePath)
+	}
+	o.end(ctx, err, size)
+	return err
+}
+
+// FileExist check object exist. bucket + filename
+func (s *Storage) FileExist(ctx context.Context, bucketName, fileName string) bool {
+	ctx, o := s.begin(ctx, "FileExist", bucketName, fileName)
+	found := s.Storage.FileExist(ctx, bucketName, fileName)
+	o.span.SetAttributes(attribute.Bool("storage.found", found))
+	o.end(ctx, nil, -1)
+	return found
+}
+
+// StatFile returns the object attributes. bucket + filename
+func (s *Storage) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	ctx, o := s.begin(ctx, "StatFile", bucketName, fileName)
+	info, err := core.StatFile(ctx, s.Storage, bucketName, fileName)
+	o.end(ctx, err, -1)
+	return info, err
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (s *Storage) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	ctx, o := s.begin(ctx, "ListObjects", bucketName, "")
+	o.span.SetAttributes(attribute.String("storage.prefix", prefix))
+	objects, err := core.ListObjects(ctx, s.Storage, bucketName, prefix)
+	if err == nil {
+		o.span.SetAttributes(attribute.Int("storage.objects", len(objects)))
+	}
+	o.end(ctx, err, -1)
+	return objects, err
+}
+
+// GetContent for storage bucket + filename
+func (s *Storage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	ctx, o := s.begin(ctx, "GetContent", bucketName, fileName)
+	content, err := s.Storage.GetContent(ctx, bucketName, fileName)
+	size := int64(-1)
+	if err == nil {
+		size = int64(len(content))
+	}
+	o.end(ctx, err, size)
+	return content, err
+}
+
+// NewReader opens the object with its attributes. The span covers opening
+// it, not reading.
+func (s *Storage) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	ctx, o := s.begin(ctx, "NewReader", bucketName, fileName)
+	body, info, err := core.NewReader(ctx, s.Storage, bucketName, fileName)
+	size := int64(-1)
+	if err == nil {
+		size = info.Size
+	}
+	o.end(ctx, err, size)
+	return body, info, err
+}
+
+// CopyFile copy src to dest
+func (s *Storage) CopyFile(
+	ctx context.Context,
+	srcBucket, srcPath, destBucket, destPath string,
+) error {
+	ctx, o := s.begin(ctx, "CopyFile", destBucket, destPath)
+	o.span.SetAttributes(
+		attribute.String("storage.source.bucket", srcBucket),
+		attribute.String("storage.source.object", s.objectKey(srcPath)),
+	)
+	err := s.Storage.CopyFile(ctx, srcBucket, srcPath, destBucket, destPath)
+	o.end(ctx, err, -1)
+	return err
+}
+
+// SignedURL get signed URL.
+func (s *Storage) SignedURL(
+	ctx context.Context,
+	bucketName, filePath string,
+	opts *core.SignedURLOptions,
+) (string, error) {
+	ctx, o := s.begin(ctx, "SignedURL", bucketName, filePath)
+	signed, err := s.Storage.SignedURL(ctx, bucketName, filePath, opts)
+	o.end(ctx, err, -1)
+	return signed, err
+}
+
+// SetLifeCycle on bucket or an object prefix.
+func (s *Storage) SetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	ctx, o := s.begin(ctx, "SetLifeCycle", bucketName, "")
+	err := s.Storage.SetLifeCycle(ctx, bucketName, opts)
+	o.end(ctx, err, -1)
+	return err
+}
@@ -0,0 +1,99 @@
+package otelstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestEngine(t *testing.T, hashKeys bool) (
+	*Storage, *tracetest.SpanRecorder, *sdkmetric.ManualReader,
+) {
+	recorder := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{
+		Driver:         "disk",
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		HashObjectKeys: hashKeys,
+	})
+	assert.NoError(t, err)
+	return s, recorder, reader
+}
+
+func attrValue(attrs []attribute.KeyValue, key attribute.Key) attribute.Value {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestSpans(t *testing.T) {
+	s, recorder, _ := newTestEngine(t, false)
+	ctx := context.Background()
+
+	assert.NoError(t, s.UploadFile(ctx, "b", "a.txt", []byte("hello"), nil))
+	_, err := s.GetContent(ctx, "b", "missing.txt")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	upload := spans[0]
+	assert.Equal(t, "storage.UploadFile", upload.Name())
+	assert.Equal(t, "disk", attrValue(upload.Attributes(), DriverKey).AsString())
+	assert.Equal(t, "b", attrValue(upload.Attributes(), BucketKey).AsString())
+	assert.Equal(t, "a.txt", attrValue(upload.Attributes(), ObjectKey).AsString())
+	assert.Equal(t, int64(5), attrValue(upload.Attributes(), BytesKey).AsInt64())
+
+	get := spans[1]
+	assert.Equal(t, "storage.GetContent", get.Name())
+	assert.Equal(t, codes.Error, get.Status().Code)
+}
+
+func TestHashObjectKeys(t *testing.T) {
+	s, recorder, _ := newTestEngine(t, true)
+
+	assert.NoError(t, s.UploadFile(context.Background(), "b", "a.txt", []byte("hello"), nil))
+
+	key := attrValue(recorder.Ended()[0].Attributes(), ObjectKey).AsString()
+	assert.NotEqual(t, "a.txt", key)
+	assert.Len(t, key, 64)
+}
+
+func TestMetrics(t *testing.T) {
+	s, _, reader := newTestEngine(t, false)
+	ctx := context.Background()
+
+	assert.NoError(t, s.UploadFile(ctx, "b", "a.txt", []byte("hello"), nil))
+	assert.Error(t, s.DeleteFile(ctx, "b", "missing.txt"))
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(ctx, &rm))
+
+	found := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			found[m.Name] = true
+			if m.Name == "storage.operation.errors" {
+				sum := m.Data.(metricdata.Sum[int64])
+				assert.Len(t, sum.DataPoints, 1)
+				assert.Equal(t, int64(1), sum.DataPoints[0].Value)
+			}
+		}
+	}
+	assert.True(t, found["storage.operation.duration"])
+	assert.True(t, found["storage.operation.throughput"])
+	assert.True(t, found["storage.operation.errors"])
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// Factory builds an engine from cfg. Drivers pass one to Register.
+type Factory func(ctx context.Context, cfg Config) (core.Storage, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Factory{}
+)
+
+// Register makes a driver available by name to NewEngine and Open. Driver
+// packages call it from init, so a blank import is enough:
+//
+//	import _ "github.com/appleboy/go-storage/minio"
+//
+// Register panics if factory is nil or name is already registered.
+func Register(name string, factory Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if factory == nil {
+		panic("go-storage: Register factory is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("go-storage: Register called twice for driver " + name)
+	}
+	drivers[name] = factory
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupDriver(name string) (Factory, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	factory, ok := drivers[name]
+	return factory, ok
+}
@@ -0,0 +1,43 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	var got storage.Config
+	storage.Register("test-mem", func(_ context.Context, cfg storage.Config) (core.Storage, error) {
+		got = cfg
+		return memory.NewEngine(cfg.Addr), nil
+	})
+	assert.Contains(t, storage.Drivers(), "test-mem")
+	assert.Contains(t, storage.Drivers(), "mem")
+
+	engine, err := storage.NewEngine(storage.Config{Driver: "test-mem", Addr: "https://cdn"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cdn", got.Addr)
+	assert.Equal(t, engine, storage.S3) //nolint:staticcheck // still kept in sync
+
+	assert.Panics(t, func() {
+		storage.Register("test-mem", func(context.Context, storage.Config) (core.Storage, error) {
+			return nil, nil
+		})
+	})
+	assert.Panics(t, func() { storage.Register("test-nil", nil) })
+}
+
+func TestUnknownDriver(t *testing.T) {
+	_, err := storage.NewEngine(storage.Config{Driver: "s3"})
+	assert.ErrorContains(t, err, `forgotten import of "github.com/appleboy/go-storage/minio"`)
+	assert.Nil(t, storage.S3) //nolint:staticcheck // still kept in sync
+
+	_, err = storage.NewEngine(storage.Config{Driver: "ftp"})
+	assert.EqualError(t, err, `unknown storage driver: "ftp"`)
+}
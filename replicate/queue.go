@@ -0,0 +1,172 @@
+package replicate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// Op replication operation
+type Op string
+
+const (
+	// OpPut copies the object's current primary content to the secondary.
+	OpPut Op = "put"
+	// OpDelete removes the object from the secondary.
+	OpDelete Op = "delete"
+	// OpCreateBucket creates the bucket on the secondary.
+	OpCreateBucket Op = "create-bucket"
+	// OpLifecycle applies a lifecycle config on the secondary.
+	OpLifecycle Op = "lifecycle"
+	// OpDeleteLifecycle removes lifecycle rules from the secondary.
+	OpDeleteLifecycle Op = "delete-lifecycle"
+	// OpVersioning sets the versioning status of the secondary's bucket.
+	OpVersioning Op = "versioning"
+	// OpSync makes the secondary's object match the primary's current one,
+	// deleting it when the primary has none.
+	OpSync Op = "sync"
+	// OpBucketRetention sets the default retention of the secondary's bucket.
+	OpBucketRetention Op = "bucket-retention"
+	// OpRetention sets the retention of the secondary's object.
+	OpRetention Op = "retention"
+	// OpLegalHold places or releases a legal hold on the secondary's object.
+	OpLegalHold Op = "legal-hold"
+)
+
+// Task is a pending secondary write. Puts are replayed from the primary's
+// current content rather than from a stored payload, so the queue stays small
+// and a later overwrite on the primary is what finally lands.
+type Task struct {
+	ID uint64 `json:"id"`
+	Op Op     `json:"op"`
+	// Secondary is the index into the secondaries passed to NewEngine.
+	Secondary int    `json:"secondary"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key,omitempty"`
+	Region    string `json:"region,omitempty"`
+	// ObjectLock creates the bucket with core.Options.ObjectLock.
+	ObjectLock bool                  `json:"object_lock,omitempty"`
+	Lifecycle  *core.LifecycleConfig `json:"lifecycle,omitempty"`
+	// RuleIDs are the lifecycle rules an OpDeleteLifecycle removes; none
+	// removes them all.
+	RuleIDs []string `json:"rule_ids,omitempty"`
+	// Versioning is the status an OpVersioning sets.
+	Versioning core.VersioningStatus `json:"versioning,omitempty"`
+	// BucketRetention, Retention and LegalHold are what OpBucketRetention,
+	// OpRetention and OpLegalHold set. A nil retention removes it.
+	BucketRetention *core.BucketRetention `json:"bucket_retention,omitempty"`
+	Retention       *core.ObjectRetention `json:"retention,omitempty"`
+	LegalHold       bool                  `json:"legal_hold,omitempty"`
+	// GovernanceBypass replays the write with core.Options.GovernanceBypass.
+	GovernanceBypass bool   `json:"governance_bypass,omitempty"`
+	Attempts         int    `json:"attempts"`
+	LastError        string `json:"last_error,omitempty"`
+}
+
+// queue of tasks, persisted as a JSON file after every change when a path is
+// configured.
+type queue struct {
+	path  string
+	mu    sync.Mutex
+	tasks []Task
+	next  uint64
+}
+
+func openQueue(path string) (*queue, error) {
+	q := &queue{path: path}
+	if path == "" {
+		return q, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return q, nil
+	}
+	if err := json.Unmarshal(content, &q.tasks); err != nil {
+		return nil, err
+	}
+	for _, t := range q.tasks {
+		q.next = max(q.next, t.ID)
+	}
+	return q, nil
+}
+
+// persist writes the queue through a temporary file so a crash never leaves
+// a truncated queue behind. The caller holds q.mu.
+func (q *queue) persist() error {
+	if q.path == "" {
+		return nil
+	}
+	content, err := json.Marshal(q.tasks)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o750); err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+func (q *queue) push(tasks ...Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range tasks {
+		q.next++
+		t.ID = q.next
+		q.tasks = append(q.tasks, t)
+	}
+	return q.persist()
+}
+
+// snapshot returns a copy of the queued tasks. They stay queued, and on disk,
+// until complete reports them done.
+func (q *queue) snapshot() []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Task(nil), q.tasks...)
+}
+
+// complete drops the tasks that succeeded and records the attempt on those
+// that failed.
+func (q *queue) complete(processed []Task, failed map[uint64]string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	done := make(map[uint64]bool, len(processed))
+	for _, t := range processed {
+		done[t.ID] = true
+	}
+	kept := q.tasks[:0]
+	for _, t := range q.tasks {
+		if !done[t.ID] {
+			kept = append(kept, t)
+			continue
+		}
+		if msg, ok := failed[t.ID]; ok {
+			t.Attempts++
+			t.LastError = msg
+			kept = append(kept, t)
+		}
+	}
+	q.tasks = kept
+	return q.persist()
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
@@ -0,0 +1,142 @@
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// DriftKind difference between the primary and a secondary
+type DriftKind string
+
+const (
+	// Missing objects exist only on the primary.
+	Missing DriftKind = "missing"
+	// Changed objects differ between the primary and the secondary.
+	Changed DriftKind = "changed"
+	// Extra objects exist only on the secondary.
+	Extra DriftKind = "extra"
+)
+
+// Drift one object out of sync
+type Drift struct {
+	Secondary int
+	Key       string
+	Kind      DriftKind
+	// Fixed reports whether Reconcile repaired it.
+	Fixed bool
+	// Err is the repair error, if any.
+	Err error
+}
+
+// ReconcileOptions for Reconcile
+type ReconcileOptions struct {
+	// Fix repairs the drift; otherwise Reconcile only reports it.
+	Fix bool
+	// CompareETag also treats differing ETags as a change. Only enable it
+	// when all replicas compute ETags the same way (e.g. all S3-compatible,
+	// without multipart uploads); disk ETags are plain MD5s like S3's, GCS
+	// ETags never match.
+	CompareETag bool
+	// CompareContent downloads same-size objects from both sides and
+	// compares the bytes. Thorough, but reads the whole prefix twice.
+	CompareContent bool
+}
+
+// Reconcile compares every object under bucket/prefix on the primary with
+// each secondary and reports, and optionally fixes, the differences: missing
+// and changed objects are copied from the primary, extra ones deleted.
+func (s *Storage) Reconcile(
+	ctx context.Context,
+	bucketName, prefix string,
+	opts ReconcileOptions,
+) ([]Drift, error) {
+	primary, err := core.ListObjects(ctx, s.Storage, bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for i, secondary := range s.secondaries {
+		objects, err := core.ListObjects(ctx, secondary, bucketName, prefix)
+		if err != nil && !core.IsNotExist(err) {
+			return drifts, err
+		}
+		remote := make(map[string]int, len(objects))
+		for j, o := range objects {
+			remote[o.Name] = j
+		}
+
+		for _, local := range primary {
+			j, ok := remote[local.Name]
+			kind := Missing
+			if ok {
+				delete(remote, local.Name)
+				changed, err := s.changed(ctx, secondary, local, objects[j], opts)
+				if err != nil {
+					return drifts, err
+				}
+				if !changed {
+					continue
+				}
+				kind = Changed
+			}
+			d := Drift{Secondary: i, Key: local.Name, Kind: kind}
+			if opts.Fix {
+				d.Err = s.copyFromPrimary(ctx, secondary, bucketName, local.Name)
+				d.Fixed = d.Err == nil
+			}
+			drifts = append(drifts, d)
+		}
+
+		for _, o := range objects {
+			if _, extra := remote[o.Name]; !extra {
+				continue
+			}
+			d := Drift{Secondary: i, Key: o.Name, Kind: Extra}
+			if opts.Fix {
+				d.Err = secondary.DeleteFile(ctx, bucketName, o.Name)
+				d.Fixed = d.Err == nil
+			}
+			drifts = append(drifts, d)
+		}
+	}
+
+	var errs []error
+	for _, d := range drifts {
+		if d.Err != nil {
+			errs = append(errs, d.Err)
+		}
+	}
+	return drifts, errors.Join(errs...)
+}
+
+func (s *Storage) changed(
+	ctx context.Context,
+	secondary core.Storage,
+	local, remote core.ObjectInfo,
+	opts ReconcileOptions,
+) (bool, error) {
+	if local.Size != remote.Size {
+		return true, nil
+	}
+	if opts.CompareETag && local.ETag != "" && remote.ETag != "" &&
+		strings.Trim(local.ETag, `"`) != strings.Trim(remote.ETag, `"`) {
+		return true, nil
+	}
+	if !opts.CompareContent {
+		return false, nil
+	}
+	localContent, err := s.Storage.GetContent(ctx, local.Bucket, local.Name)
+	if err != nil {
+		return false, err
+	}
+	remoteContent, err := secondary.GetContent(ctx, remote.Bucket, remote.Name)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(localContent, remoteContent), nil
+}
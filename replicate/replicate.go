@@ -0,0 +1,841 @@
+// Package replicate mirrors a primary core.Storage onto N secondaries.
+//
+// Writes and deletes go to the primary first; only once it succeeds are they
+// applied to the secondaries, either before the call returns (Sync) or from a
+// background queue (Async). Secondary writes that fail are kept in a retry
+// queue, persisted to disk when Config.QueuePath is set. Reads are served by
+// the primary and fall back to the secondaries, in order, when it fails.
+//
+// Version IDs are assigned by each backend, so calls on a version bound
+// with core.Options.VersionID are served by the primary alone; the
+// secondaries are then brought in line with the primary's current object.
+package replicate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+var (
+	_ core.Storage          = (*Storage)(nil)
+	_ core.Stater           = (*Storage)(nil)
+	_ core.Lister           = (*Storage)(nil)
+	_ core.Versioner        = (*Storage)(nil)
+	_ core.LifecycleManager = (*Storage)(nil)
+	_ core.Locker           = (*Storage)(nil)
+	_ core.ObjectReader     = (*Storage)(nil)
+	_ core.Binder           = (*Storage)(nil)
+)
+
+// Mode replication mode
+type Mode int
+
+const (
+	// Sync writes the secondaries before returning.
+	Sync Mode = iota
+	// Async queues secondary writes for the background worker.
+	Async
+)
+
+// DefaultRetryInterval between background drains of the queue.
+const DefaultRetryInterval = 30 * time.Second
+
+// Config for replication
+type Config struct {
+	Mode Mode
+	// QueuePath persists the retry queue as JSON. Empty keeps it in memory.
+	// Tasks refer to secondaries by index, so keep their order stable
+	// across restarts.
+	QueuePath string
+	// RetryInterval is how often Start drains the queue.
+	RetryInterval time.Duration
+	// OnError is called for every failed secondary write.
+	OnError func(task Task, err error)
+}
+
+// Storage replicating wrapper. The embedded core.Storage is the primary.
+type Storage struct {
+	core.Storage
+	// current is the primary without the bound version ID, for calls on
+	// the current object.
+	current     core.Storage
+	secondaries []core.Storage
+	opts        core.Options
+	*worker
+}
+
+// worker holds the queue and background state shared by the copies With
+// returns.
+type worker struct {
+	// root is the Storage NewEngine returned, which replays queued tasks.
+	root     *Storage
+	mode     Mode
+	interval time.Duration
+	onError  func(Task, error)
+	queue    *queue
+
+	drainMu sync.Mutex
+	wake    chan struct{}
+
+	runMu sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewEngine struct
+func NewEngine(primary core.Storage, secondaries []core.Storage, cfg Config) (*Storage, error) {
+	if primary == nil {
+		return nil, errors.New("go-storage: replicate needs a primary storage")
+	}
+	for _, s := range secondaries {
+		if s == nil {
+			return nil, errors.New("go-storage: replicate secondary cannot be nil")
+		}
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	q, err := openQueue(cfg.QueuePath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Storage{
+		Storage:     primary,
+		current:     primary,
+		secondaries: secondaries,
+		worker: &worker{
+			mode:     cfg.Mode,
+			interval: cfg.RetryInterval,
+			onError:  cfg.OnError,
+			queue:    q,
+			wake:     make(chan struct{}, 1),
+		},
+	}
+	s.root = s
+	return s, nil
+}
+
+// Unwrap returns the primary.
+func (s *Storage) Unwrap() core.Storage {
+	return s.Storage
+}
+
+// With returns a copy of s over the primary and secondaries bound to opts,
+// sharing the queue. A version ID is only bound on the primary. Queued tasks
+// are replayed without opts.
+func (s *Storage) With(opts core.Options) (core.Storage, error) {
+	c := *s
+	c.opts = s.opts.Merge(opts)
+	opts.VersionID = ""
+	var err error
+	if c.current, err = core.With(s.current, opts); err != nil {
+		return nil, err
+	}
+	c.Storage = c.current
+	if c.opts.VersionID != "" {
+		c.Storage, err = core.With(c.current, core.Options{VersionID: c.opts.VersionID})
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.secondaries = make([]core.Storage, len(s.secondaries))
+	for i, secondary := range s.secondaries {
+		if c.secondaries[i], err = core.With(secondary, opts); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// Start drains the queue in the background, every RetryInterval and right
+// after each Async write.
+func (s *Storage) Start() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(s.stop, s.done)
+}
+
+func (s *Storage) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		_ = s.Drain(context.Background())
+	}
+}
+
+// Close stops the background worker. Queued tasks stay in the queue file.
+func (s *Storage) Close() error {
+	s.runMu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.runMu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
+
+// Pending returns the queued secondary writes.
+func (s *Storage) Pending() []Task {
+	return s.queue.snapshot()
+}
+
+// Drain applies every queued task once, in order, and returns the errors of
+// those that failed again.
+func (s *Storage) Drain(ctx context.Context) error {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	tasks := s.queue.snapshot()
+	if len(tasks) == 0 {
+		return nil
+	}
+	failed := map[uint64]string{}
+	var errs []error
+	for _, t := range tasks {
+		if err := s.root.apply(ctx, t); err != nil {
+			failed[t.ID] = err.Error()
+			errs = append(errs, err)
+			s.reportError(t, err)
+		}
+	}
+	if err := s.queue.complete(tasks, failed); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Storage) reportError(t Task, err error) {
+	if s.onError != nil {
+		s.onError(t, err)
+	}
+}
+
+// apply runs a queued task against its secondary.
+func (s *Storage) apply(ctx context.Context, t Task) error {
+	if t.Secondary < 0 || t.Secondary >= len(s.secondaries) {
+		// The secondaries changed since the task was queued; drop it.
+		return nil
+	}
+	target, err := core.With(s.secondaries[t.Secondary], core.Options{
+		ObjectLock:       t.ObjectLock,
+		GovernanceBypass: t.GovernanceBypass,
+	})
+	if err != nil {
+		return err
+	}
+	switch t.Op {
+	case OpPut:
+		return s.copyFromPrimary(ctx, target, t.Bucket, t.Key)
+	case OpDelete:
+		err := target.DeleteFile(ctx, t.Bucket, t.Key)
+		if core.IsNotExist(err) {
+			return nil
+		}
+		return err
+	case OpCreateBucket:
+		return target.CreateBucket(ctx, t.Bucket, t.Region)
+	case OpLifecycle:
+		return target.SetLifeCycle(ctx, t.Bucket, t.Lifecycle)
+	case OpDeleteLifecycle:
+		return core.DeleteLifeCycle(ctx, target, t.Bucket, t.RuleIDs...)
+	case OpVersioning:
+		return setVersioning(ctx, target, t.Bucket, t.Versioning)
+	case OpSync:
+		return s.syncFromPrimary(ctx, target, t.Bucket, t.Key)
+	case OpBucketRetention:
+		return core.LockerOf(target).SetBucketRetention(ctx, t.Bucket, t.BucketRetention)
+	case OpRetention:
+		return core.LockerOf(target).SetObjectRetention(ctx, t.Bucket, t.Key, t.Retention)
+	case OpLegalHold:
+		return core.LockerOf(target).SetLegalHold(ctx, t.Bucket, t.Key, t.LegalHold)
+	default:
+		return errors.New("go-storage: unknown replicate op " + string(t.Op))
+	}
+}
+
+// copyFromPrimary streams the primary's current object to target, with its
+// attributes. An object since deleted from the primary is skipped; its
+// delete task follows.
+func (s *Storage) copyFromPrimary(
+	ctx context.Context,
+	target core.Storage,
+	bucketName, objectName string,
+) error {
+	body, info, err := core.NewReader(ctx, s.current, bucketName, objectName)
+	if core.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	target, err = core.With(target, core.Options{Upload: info.UploadOptions()})
+	if err != nil {
+		return err
+	}
+	// An empty content type is detected by target.
+	return target.UploadFileByReader(
+		ctx, bucketName, objectName, body, info.ContentType, info.Size,
+	)
+}
+
+// syncFromPrimary makes target's object match the primary's current one,
+// removing it when the primary has none.
+func (s *Storage) syncFromPrimary(
+	ctx context.Context,
+	target core.Storage,
+	bucketName, objectName string,
+) error {
+	info, err := core.StatFile(ctx, s.current, bucketName, objectName)
+	if info != nil {
+		return s.copyFromPrimary(ctx, target, bucketName, objectName)
+	}
+	if !core.IsNotExist(err) {
+		return err
+	}
+	err = target.DeleteFile(ctx, bucketName, objectName)
+	if core.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func setVersioning(
+	ctx context.Context,
+	target core.Storage,
+	bucketName string,
+	status core.VersioningStatus,
+) error {
+	if status == core.VersioningEnabled {
+		return core.VersionerOf(target).EnableVersioning(ctx, bucketName)
+	}
+	return core.VersionerOf(target).SuspendVersioning(ctx, bucketName)
+}
+
+// currentVersion returns the version ID of the primary's current object, or
+// "" when there is none. ok is false when it cannot be told.
+func (s *Storage) currentVersion(
+	ctx context.Context,
+	bucketName, fileName string,
+) (versionID string, ok bool) {
+	info, err := core.StatFile(ctx, s.current, bucketName, fileName)
+	if core.IsNotExist(err) {
+		return "", true
+	}
+	if err != nil || info.VersionID == "" {
+		return "", false
+	}
+	return info.VersionID, true
+}
+
+// replicate applies fn to every secondary in Sync mode, queueing failures,
+// or queues one task per secondary in Async mode.
+func (s *Storage) replicate(task Task, fn func(core.Storage) error) error {
+	if s.mode == Async {
+		tasks := make([]Task, len(s.secondaries))
+		for i := range s.secondaries {
+			tasks[i] = task
+			tasks[i].Secondary = i
+		}
+		if err := s.queue.push(tasks...); err != nil {
+			return err
+		}
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	var failed []Task
+	for i, secondary := range s.secondaries {
+		if err := fn(secondary); err != nil {
+			t := task
+			t.Secondary = i
+			t.Attempts = 1
+			t.LastError = err.Error()
+			s.reportError(t, err)
+			failed = append(failed, t)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return s.queue.push(failed...)
+}
+
+// CreateBucket on the primary and every secondary.
+func (s *Storage) CreateBucket(ctx context.Context, bucketName, region string) error {
+	if err := s.Storage.CreateBucket(ctx, bucketName, region); err != nil {
+		return err
+	}
+	task := Task{
+		Op:         OpCreateBucket,
+		Bucket:     bucketName,
+		Region:     region,
+		ObjectLock: s.opts.ObjectLock,
+	}
+	return s.replicate(task, func(target core.Storage) error {
+		return target.CreateBucket(ctx, bucketName, region)
+	})
+}
+
+// spool keeps a copy of the body the primary reads in a temporary file, so
+// the secondaries can be sent the same bytes without holding them in memory.
+type spool struct {
+	file *os.File
+}
+
+func newSpool() (*spool, error) {
+	file, err := os.CreateTemp("", "go-storage-replicate-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spool{file: file}, nil
+}
+
+// tee returns a reader that copies what it reads from reader to the spool.
+func (p *spool) tee(reader io.Reader) io.Reader {
+	return io.TeeReader(reader, p.file)
+}
+
+// body returns a fresh reader over the spooled bytes and their length.
+func (p *spool) body() (io.Reader, int64, error) {
+	st, err := p.file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NewSectionReader(p.file, 0, st.Size()), st.Size(), nil
+}
+
+func (p *spool) Close() {
+	_ = p.file.Close()
+	_ = os.Remove(p.file.Name())
+}
+
+// UploadFile to the primary and every secondary.
+func (s *Storage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	// When the primary uploads reader instead of content, the bytes it
+	// reads are spooled in Sync mode and sent to the secondaries.
+	var body *spool
+	if reader != nil && core.ReaderIsBody(s.Storage) && s.mode == Sync && len(s.secondaries) > 0 {
+		var err error
+		if body, err = newSpool(); err != nil {
+			return err
+		}
+		defer body.Close()
+		reader = body.tee(reader)
+	}
+	if err := s.Storage.UploadFile(ctx, bucketName, objectName, content, reader); err != nil {
+		return err
+	}
+	task := Task{
+		Op:               OpPut,
+		Bucket:           bucketName,
+		Key:              objectName,
+		GovernanceBypass: s.opts.GovernanceBypass,
+	}
+	return s.replicate(task, func(target core.Storage) error {
+		if body == nil {
+			return target.UploadFile(ctx, bucketName, objectName, content, nil)
+		}
+		// content is only the head of the body; it sets the content type.
+		r, length, err := body.body()
+		if err != nil {
+			return err
+		}
+		contentType := core.DetectContentType(content)
+		return target.UploadFileByReader(ctx, bucketName, objectName, r, contentType, length)
+	})
+}
+
+// ReaderIsBody reports whether the primary uploads the reader passed to
+// UploadFile.
+func (s *Storage) ReaderIsBody() bool {
+	return core.ReaderIsBody(s.Storage)
+}
+
+// UploadFileByReader to the primary and every secondary. In Sync mode the
+// body is spooled to a temporary file while the primary reads it, so the
+// secondaries can be sent the same bytes.
+func (s *Storage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	var body *spool
+	if s.mode == Sync && len(s.secondaries) > 0 {
+		var err error
+		if body, err = newSpool(); err != nil {
+			return err
+		}
+		defer body.Close()
+		reader = body.tee(reader)
+	}
+	if err := s.Storage.UploadFileByReader(
+		ctx, bucketName, objectName, reader, contentType, length,
+	); err != nil {
+		return err
+	}
+	task := Task{
+		Op:               OpPut,
+		Bucket:           bucketName,
+		Key:              objectName,
+		GovernanceBypass: s.opts.GovernanceBypass,
+	}
+	return s.replicate(task, func(target core.Storage) error {
+		r, length, err := body.body()
+		if err != nil {
+			return err
+		}
+		return target.UploadFileByReader(ctx, bucketName, objectName, r, contentType, length)
+	})
+}
+
+// DeleteFile from the primary and every secondary. Deleting a version
+// removes it from the primary, then syncs the secondaries with whatever
+// version is current there, unless that did not change.
+func (s *Storage) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	versioned := s.opts.VersionID != ""
+	var before string
+	var known bool
+	if versioned {
+		before, known = s.currentVersion(ctx, bucketName, fileName)
+	}
+	if err := s.Storage.DeleteFile(ctx, bucketName, fileName); err != nil {
+		return err
+	}
+	bypass := s.opts.GovernanceBypass
+	if versioned {
+		// A noncurrent version only lived on the primary.
+		after, ok := s.currentVersion(ctx, bucketName, fileName)
+		if known && ok && after == before {
+			return nil
+		}
+		task := Task{Op: OpSync, Bucket: bucketName, Key: fileName, GovernanceBypass: bypass}
+		return s.replicate(task, func(target core.Storage) error {
+			return s.syncFromPrimary(ctx, target, bucketName, fileName)
+		})
+	}
+	task := Task{Op: OpDelete, Bucket: bucketName, Key: fileName, GovernanceBypass: bypass}
+	return s.replicate(task, func(target core.Storage) error {
+		err := target.DeleteFile(ctx, bucketName, fileName)
+		if core.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// CopyFile on the primary and every secondary. A secondary missing the
+// source, or asked for a version of it, gets the destination copied over
+// from the primary instead.
+func (s *Storage) CopyFile(
+	ctx context.Context,
+	srcBucket, srcPath, destBucket, destPath string,
+) error {
+	if err := s.Storage.CopyFile(ctx, srcBucket, srcPath, destBucket, destPath); err != nil {
+		return err
+	}
+	versioned := s.opts.VersionID != ""
+	task := Task{
+		Op:               OpPut,
+		Bucket:           destBucket,
+		Key:              destPath,
+		GovernanceBypass: s.opts.GovernanceBypass,
+	}
+	return s.replicate(task, func(target core.Storage) error {
+		if versioned {
+			return s.copyFromPrimary(ctx, target, destBucket, destPath)
+		}
+		if err := target.CopyFile(ctx, srcBucket, srcPath, destBucket, destPath); err == nil {
+			return nil
+		}
+		return s.copyFromPrimary(ctx, target, destBucket, destPath)
+	})
+}
+
+// SetLifeCycle on the primary and every secondary.
+func (s *Storage) SetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	if err := s.Storage.SetLifeCycle(ctx, bucketName, opts); err != nil {
+		return err
+	}
+	task := Task{Op: OpLifecycle, Bucket: bucketName, Lifecycle: opts}
+	return s.replicate(task, func(target core.Storage) error {
+		return target.SetLifeCycle(ctx, bucketName, opts)
+	})
+}
+
+// GetLifeCycle returns the primary's bucket lifecycle rules.
+func (s *Storage) GetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+) (*core.LifecycleConfig, error) {
+	return core.GetLifeCycle(ctx, s.Storage, bucketName)
+}
+
+// DeleteLifeCycle on the primary and every secondary.
+func (s *Storage) DeleteLifeCycle(ctx context.Context, bucketName string, ids ...string) error {
+	if err := core.DeleteLifeCycle(ctx, s.Storage, bucketName, ids...); err != nil {
+		return err
+	}
+	task := Task{Op: OpDeleteLifecycle, Bucket: bucketName, RuleIDs: ids}
+	return s.replicate(task, func(target core.Storage) error {
+		return core.DeleteLifeCycle(ctx, target, bucketName, ids...)
+	})
+}
+
+// EnableVersioning on the primary and every secondary.
+func (s *Storage) EnableVersioning(ctx context.Context, bucketName string) error {
+	return s.versioning(ctx, bucketName, core.VersioningEnabled)
+}
+
+// SuspendVersioning on the primary and every secondary.
+func (s *Storage) SuspendVersioning(ctx context.Context, bucketName string) error {
+	return s.versioning(ctx, bucketName, core.VersioningSuspended)
+}
+
+func (s *Storage) versioning(
+	ctx context.Context,
+	bucketName string,
+	status core.VersioningStatus,
+) error {
+	if err := setVersioning(ctx, s.Storage, bucketName, status); err != nil {
+		return err
+	}
+	task := Task{Op: OpVersioning, Bucket: bucketName, Versioning: status}
+	return s.replicate(task, func(target core.Storage) error {
+		return setVersioning(ctx, target, bucketName, status)
+	})
+}
+
+// SetBucketRetention on the primary and every secondary.
+func (s *Storage) SetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+	retention *core.BucketRetention,
+) error {
+	if err := core.LockerOf(s.Storage).SetBucketRetention(ctx, bucketName, retention); err != nil {
+		return err
+	}
+	task := Task{Op: OpBucketRetention, Bucket: bucketName, BucketRetention: retention}
+	return s.replicate(task, func(target core.Storage) error {
+		return core.LockerOf(target).SetBucketRetention(ctx, bucketName, retention)
+	})
+}
+
+// SetObjectRetention on the primary and every secondary. The retention of a
+// version is set on the primary alone.
+func (s *Storage) SetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+	retention *core.ObjectRetention,
+) error {
+	err := core.LockerOf(s.Storage).SetObjectRetention(ctx, bucketName, fileName, retention)
+	if err != nil || s.opts.VersionID != "" {
+		return err
+	}
+	task := Task{
+		Op:               OpRetention,
+		Bucket:           bucketName,
+		Key:              fileName,
+		Retention:        retention,
+		GovernanceBypass: s.opts.GovernanceBypass,
+	}
+	return s.replicate(task, func(target core.Storage) error {
+		return core.LockerOf(target).SetObjectRetention(ctx, bucketName, fileName, retention)
+	})
+}
+
+// SetLegalHold on the primary and every secondary. The legal hold of a
+// version is set on the primary alone.
+func (s *Storage) SetLegalHold(ctx context.Context, bucketName, fileName string, hold bool) error {
+	err := core.LockerOf(s.Storage).SetLegalHold(ctx, bucketName, fileName, hold)
+	if err != nil || s.opts.VersionID != "" {
+		return err
+	}
+	task := Task{Op: OpLegalHold, Bucket: bucketName, Key: fileName, LegalHold: hold}
+	return s.replicate(task, func(target core.Storage) error {
+		return core.LockerOf(target).SetLegalHold(ctx, bucketName, fileName, hold)
+	})
+}
+
+// read runs fn on the primary, then on each secondary in turn while it
+// fails. A missing object is an answer, not a failure, and is not retried
+// elsewhere: a secondary may still hold an object deleted on the primary.
+// Reads of a version are served by the primary alone.
+func read[T any](ctx context.Context, s *Storage, fn func(core.Storage) (T, error)) (T, error) {
+	v, err := fn(s.Storage)
+	if err == nil || core.IsNotExist(err) || s.opts.VersionID != "" {
+		return v, err
+	}
+	for _, secondary := range s.secondaries {
+		if sv, serr := fn(secondary); serr == nil {
+			return sv, nil
+		}
+	}
+	return v, err
+}
+
+// BucketExists Checks if a bucket exists.
+func (s *Storage) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return read(ctx, s, func(target core.Storage) (bool, error) {
+		return target.BucketExists(ctx, bucketName)
+	})
+}
+
+// DownloadFile downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFile(ctx context.Context, bucketName, objectName, filePath string) error {
+	_, err := read(ctx, s, func(target core.Storage) (struct{}, error) {
+		return struct{}{}, target.DownloadFile(ctx, bucketName, objectName, filePath)
+	})
+	return err
+}
+
+// DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFileByProgress(
+	ctx context.Context,
+	bucketName, objectName, filePath string,
+	bar *pb.ProgressBar,
+) error {
+	_, err := read(ctx, s, func(target core.Storage) (struct{}, error) {
+		return struct{}{}, target.DownloadFileByProgress(ctx, bucketName, objectName, filePath, bar)
+	})
+	return err
+}
+
+// StatFile returns the object attributes. bucket + filename
+func (s *Storage) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	return read(ctx, s, func(target core.Storage) (*core.ObjectInfo, error) {
+		return core.StatFile(ctx, target, bucketName, fileName)
+	})
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (s *Storage) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	return read(ctx, s, func(target core.Storage) ([]core.ObjectInfo, error) {
+		return core.ListObjects(ctx, target, bucketName, prefix)
+	})
+}
+
+// GetContent for storage bucket + filename
+func (s *Storage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	return read(ctx, s, func(target core.Storage) ([]byte, error) {
+		return target.GetContent(ctx, bucketName, fileName)
+	})
+}
+
+// NewReader opens the object with its attributes, from a secondary when the
+// primary fails.
+func (s *Storage) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	type opened struct {
+		body io.ReadCloser
+		info *core.ObjectInfo
+	}
+	o, err := read(ctx, s, func(target core.Storage) (opened, error) {
+		body, info, err := core.NewReader(ctx, target, bucketName, fileName)
+		return opened{body, info}, err
+	})
+	return o.body, o.info, err
+}
+
+// GetBucketRetention returns the default retention of new objects.
+func (s *Storage) GetBucketRetention(
+	ctx context.Context,
+	bucketName string,
+) (*core.BucketRetention, error) {
+	return read(ctx, s, func(target core.Storage) (*core.BucketRetention, error) {
+		return core.LockerOf(target).GetBucketRetention(ctx, bucketName)
+	})
+}
+
+// GetObjectRetention returns the object retention.
+func (s *Storage) GetObjectRetention(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectRetention, error) {
+	return read(ctx, s, func(target core.Storage) (*core.ObjectRetention, error) {
+		return core.LockerOf(target).GetObjectRetention(ctx, bucketName, fileName)
+	})
+}
+
+// GetLegalHold reports whether an object version is under legal hold.
+func (s *Storage) GetLegalHold(ctx context.Context, bucketName, fileName string) (bool, error) {
+	return read(ctx, s, func(target core.Storage) (bool, error) {
+		return core.LockerOf(target).GetLegalHold(ctx, bucketName, fileName)
+	})
+}
+
+// GetVersioning returns the primary's bucket versioning status.
+func (s *Storage) GetVersioning(
+	ctx context.Context,
+	bucketName string,
+) (core.VersioningStatus, error) {
+	return core.VersionerOf(s.Storage).GetVersioning(ctx, bucketName)
+}
+
+// ListObjectVersions lists the primary's versions, whose IDs are the ones
+// the other calls accept.
+func (s *Storage) ListObjectVersions(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectVersion, error) {
+	return core.VersionerOf(s.Storage).ListObjectVersions(ctx, bucketName, prefix)
+}
+
+// SignedURL get signed URL.
+func (s *Storage) SignedURL(
+	ctx context.Context,
+	bucketName, filePath string,
+	opts *core.SignedURLOptions,
+) (string, error) {
+	if opts != nil && opts.VersionID != "" {
+		return s.Storage.SignedURL(ctx, bucketName, filePath, opts)
+	}
+	return read(ctx, s, func(target core.Storage) (string, error) {
+		return target.SignedURL(ctx, bucketName, filePath, opts)
+	})
+}
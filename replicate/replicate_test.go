@@ -0,0 +1,351 @@
+package replicate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errDown = errors.New("backend down")
+
+// outage is a disk engine that can be taken offline, with the copies With
+// returns.
+type outage struct {
+	*disk.Disk
+	*state
+}
+
+type state struct {
+	down bool
+}
+
+func (o *outage) With(opts core.Options) (core.Storage, error) {
+	bound, err := o.Disk.With(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &outage{Disk: bound.(*disk.Disk), state: o.state}, nil
+}
+
+func (o *outage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	if o.down {
+		return errDown
+	}
+	return o.Disk.UploadFile(ctx, bucketName, objectName, content, reader)
+}
+
+func (o *outage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	if o.down {
+		return errDown
+	}
+	return o.Disk.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+}
+
+func (o *outage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	if o.down {
+		return nil, errDown
+	}
+	return o.Disk.GetContent(ctx, bucketName, fileName)
+}
+
+func newOutage(t *testing.T) *outage {
+	return &outage{Disk: disk.NewEngine("", t.TempDir()), state: &state{}}
+}
+
+func TestSyncReplication(t *testing.T) {
+	primary, a, b := newOutage(t), newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{a, b}, Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("hello"), nil))
+	assert.NoError(t, s.CopyFile(ctx, "bucket", "a.txt", "bucket", "b.txt"))
+	for _, target := range []*outage{a, b} {
+		content, err := target.GetContent(ctx, "bucket", "b.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(content))
+	}
+
+	assert.NoError(t, s.DeleteFile(ctx, "bucket", "a.txt"))
+	assert.False(t, a.FileExist(ctx, "bucket", "a.txt"))
+	assert.False(t, b.FileExist(ctx, "bucket", "a.txt"))
+
+	rules := []core.LifecycleRule{
+		{ID: "tmp", Prefix: "tmp/", ExpirationDays: 1},
+		{ID: "logs", Prefix: "logs/", ExpirationDays: 30},
+	}
+	assert.NoError(t, s.SetLifeCycle(ctx, "bucket", &core.LifecycleConfig{Rules: rules}))
+	assert.NoError(t, s.DeleteLifeCycle(ctx, "bucket", "tmp"))
+	for _, target := range []*outage{a, b} {
+		cfg, err := target.GetLifeCycle(ctx, "bucket")
+		assert.NoError(t, err)
+		assert.Equal(t, rules[1:], cfg.Rules)
+	}
+	assert.Empty(t, s.Pending())
+}
+
+func TestVersionedReplication(t *testing.T) {
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, s.CreateBucket(ctx, "bucket", ""))
+	assert.NoError(t, s.EnableVersioning(ctx, "bucket"))
+	status, err := secondary.GetVersioning(ctx, "bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, core.VersioningEnabled, status)
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("v1"), nil))
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("v2"), nil))
+
+	// Version IDs are the primary's; secondaries get the resulting object.
+	versions, err := s.ListObjectVersions(ctx, "bucket", "")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	v1, err := s.With(core.Options{VersionID: versions[1].VersionID})
+	assert.NoError(t, err)
+	assert.NoError(t, v1.CopyFile(ctx, "bucket", "a.txt", "bucket", "a.txt"))
+	content, err := secondary.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	// Deleting the current version brings v2 back on the primary.
+	info, err := s.StatFile(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	current, err := s.With(core.Options{VersionID: info.VersionID})
+	assert.NoError(t, err)
+	assert.NoError(t, current.DeleteFile(ctx, "bucket", "a.txt"))
+	content, err = secondary.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(content))
+	assert.Empty(t, s.Pending())
+
+	// Deleting a noncurrent version leaves the secondaries alone.
+	versions, err = s.ListObjectVersions(ctx, "bucket", "")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	assert.False(t, versions[1].IsLatest)
+	secondary.down = true
+	noncurrent, err := s.With(core.Options{VersionID: versions[1].VersionID})
+	assert.NoError(t, err)
+	assert.NoError(t, noncurrent.DeleteFile(ctx, "bucket", "a.txt"))
+	assert.Empty(t, s.Pending())
+}
+
+func TestObjectLockReplication(t *testing.T) {
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{Mode: Async})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	locking, err := s.With(core.Options{ObjectLock: true})
+	assert.NoError(t, err)
+	assert.NoError(t, locking.CreateBucket(ctx, "records", ""))
+	assert.NoError(t, s.UploadFile(ctx, "records", "a.txt", []byte("a"), nil))
+	retention := &core.ObjectRetention{
+		Mode:        core.RetentionGovernance,
+		RetainUntil: time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, s.SetObjectRetention(ctx, "records", "a.txt", retention))
+	assert.NoError(t, s.SetLegalHold(ctx, "records", "a.txt", true))
+	assert.NoError(t, s.Drain(ctx))
+	hold, err := secondary.GetLegalHold(ctx, "records", "a.txt")
+	assert.NoError(t, err)
+	assert.True(t, hold)
+	assert.ErrorIs(t, secondary.DeleteFile(ctx, "records", "a.txt"), core.ErrObjectLocked)
+
+	// The queued delete keeps the bypass of the original call.
+	assert.NoError(t, s.SetLegalHold(ctx, "records", "a.txt", false))
+	bypass, err := s.With(core.Options{GovernanceBypass: true})
+	assert.NoError(t, err)
+	assert.NoError(t, bypass.DeleteFile(ctx, "records", "a.txt"))
+	assert.NoError(t, s.Drain(ctx))
+	assert.False(t, secondary.FileExist(ctx, "records", "a.txt"))
+	assert.Empty(t, s.Pending())
+}
+
+func TestFailedSecondaryIsQueued(t *testing.T) {
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{QueuePath: queuePath})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	var reported []Task
+	s.onError = func(task Task, _ error) { reported = append(reported, task) }
+
+	secondary.down = true
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("hello"), nil))
+	assert.Len(t, reported, 1)
+	assert.Error(t, s.Drain(ctx))
+
+	// The queue survives a restart.
+	s, err = NewEngine(primary, []core.Storage{secondary}, Config{QueuePath: queuePath})
+	assert.NoError(t, err)
+	pending := s.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, OpPut, pending[0].Op)
+	assert.Equal(t, 2, pending[0].Attempts)
+
+	secondary.down = false
+	assert.NoError(t, s.Drain(ctx))
+	assert.Empty(t, s.Pending())
+	content, err := secondary.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+}
+
+func TestAsyncReplication(t *testing.T) {
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{Mode: Async})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("v1"), nil))
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("v2"), nil))
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "gone.txt", []byte("x"), nil))
+	assert.NoError(t, s.DeleteFile(ctx, "bucket", "gone.txt"))
+	assert.Len(t, s.Pending(), 4)
+	assert.False(t, secondary.FileExist(ctx, "bucket", "a.txt"))
+
+	assert.NoError(t, s.Drain(ctx))
+	content, err := secondary.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(content))
+	assert.False(t, secondary.FileExist(ctx, "bucket", "gone.txt"))
+}
+
+func TestAsyncKeepsAttributes(t *testing.T) {
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{Mode: Async})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	upload := &core.UploadOptions{
+		Metadata:        map[string]string{"owner": "alice"},
+		CacheControl:    "no-cache",
+		ContentEncoding: "gzip",
+	}
+	bound, err := s.With(core.Options{Upload: upload})
+	assert.NoError(t, err)
+	assert.NoError(t, bound.UploadFile(ctx, "bucket", "a.json", []byte(`{"a":1}`), nil))
+	assert.NoError(t, s.Drain(ctx))
+
+	info, err := secondary.StatFile(ctx, "bucket", "a.json")
+	assert.NoError(t, err)
+	assert.Equal(t, upload, info.UploadOptions())
+	stored, err := primary.StatFile(ctx, "bucket", "a.json")
+	assert.NoError(t, err)
+	assert.Equal(t, stored.ContentType, info.ContentType)
+}
+
+// bodyDisk uploads the reader passed to UploadFile, as the gcs driver does.
+type bodyDisk struct {
+	*disk.Disk
+}
+
+func (b *bodyDisk) ReaderIsBody() bool {
+	return true
+}
+
+func (b *bodyDisk) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	if reader == nil {
+		return b.Disk.UploadFile(ctx, bucketName, objectName, content, nil)
+	}
+	return b.Disk.UploadFileByReader(ctx, bucketName, objectName, reader, "", -1)
+}
+
+func TestUploadFileReaderBody(t *testing.T) {
+	primary := &bodyDisk{Disk: disk.NewEngine("", t.TempDir())}
+	secondary := newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// content is only the sniff prefix; the secondary gets the whole body.
+	err = s.UploadFile(ctx, "bucket", "a.txt", []byte("he"), strings.NewReader("hello"))
+	assert.NoError(t, err)
+	content, err := secondary.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+}
+
+func TestReadFallback(t *testing.T) {
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, s.UploadFile(ctx, "bucket", "a.txt", []byte("hello"), nil))
+	primary.down = true
+	content, err := s.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// A missing object is an answer and is not looked up on the secondaries.
+	primary.down = false
+	assert.NoError(t, secondary.UploadFile(ctx, "bucket", "stale.txt", []byte("x"), nil))
+	_, err = s.GetContent(ctx, "bucket", "stale.txt")
+	assert.Error(t, err)
+}
+
+func TestReconcile(t *testing.T) {
+	primary, secondary := newOutage(t), newOutage(t)
+	s, err := NewEngine(primary, []core.Storage{secondary}, Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, primary.UploadFile(ctx, "bucket", "missing.txt", []byte("m"), nil))
+	assert.NoError(t, primary.UploadFile(ctx, "bucket", "changed.txt", []byte("new"), nil))
+	assert.NoError(t, secondary.UploadFile(ctx, "bucket", "changed.txt", []byte("old"), nil))
+	assert.NoError(t, primary.UploadFile(ctx, "bucket", "same.txt", []byte("s"), nil))
+	assert.NoError(t, secondary.UploadFile(ctx, "bucket", "same.txt", []byte("s"), nil))
+	assert.NoError(t, secondary.UploadFile(ctx, "bucket", "extra.txt", []byte("e"), nil))
+
+	// Same size: only a content comparison catches the change.
+	drifts, err := s.Reconcile(ctx, "bucket", "", ReconcileOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 2)
+
+	drifts, err = s.Reconcile(ctx, "bucket", "", ReconcileOptions{CompareContent: true, Fix: true})
+	assert.NoError(t, err)
+	kinds := map[string]DriftKind{}
+	for _, d := range drifts {
+		kinds[d.Key] = d.Kind
+		assert.True(t, d.Fixed)
+	}
+	assert.Equal(t, map[string]DriftKind{
+		"missing.txt": Missing,
+		"changed.txt": Changed,
+		"extra.txt":   Extra,
+	}, kinds)
+
+	drifts, err = s.Reconcile(ctx, "bucket", "", ReconcileOptions{CompareContent: true})
+	assert.NoError(t, err)
+	assert.Empty(t, drifts)
+}
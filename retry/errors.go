@@ -0,0 +1,80 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/minio/minio-go/v7"
+	"google.golang.org/api/googleapi"
+)
+
+// minioRetryableCodes are S3 error codes worth another attempt.
+var minioRetryableCodes = map[string]bool{
+	"InternalError":              true,
+	"RequestTimeout":             true,
+	"ServiceUnavailable":         true,
+	"SlowDown":                   true,
+	"SlowDownRead":               true,
+	"SlowDownWrite":              true,
+	"XMinioServerNotInitialized": true,
+}
+
+// IsRetryable reports whether err is a transient failure: throttling or 5xx
+// responses from S3/MinIO or GCS, timeouts and dropped connections. Context
+// cancellation is never retried.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var minioErr minio.ErrorResponse
+	if errors.As(err, &minioErr) {
+		return IsMinioRetryable(minioErr)
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return IsGoogleRetryable(googleErr)
+	}
+
+	// A per-attempt timeout surfaces as DeadlineExceeded; the retry loop
+	// separately stops once the caller's own context is done.
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsMinioRetryable classifies an S3/MinIO error response.
+func IsMinioRetryable(err minio.ErrorResponse) bool {
+	if minioRetryableCodes[err.Code] {
+		return true
+	}
+	return isRetryableStatus(err.StatusCode)
+}
+
+// IsGoogleRetryable classifies a GCS JSON API error.
+func IsGoogleRetryable(err *googleapi.Error) bool {
+	return isRetryableStatus(err.Code)
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
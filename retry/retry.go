@@ -0,0 +1,403 @@
+// Package retry wraps a core.Storage and retries transient failures with
+// exponential backoff and jitter.
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+var (
+	_ core.Storage      = (*Storage)(nil)
+	_ core.Stater       = (*Storage)(nil)
+	_ core.Lister       = (*Storage)(nil)
+	_ core.ObjectReader = (*Storage)(nil)
+	_ core.Binder       = (*Storage)(nil)
+)
+
+// Defaults used for zero Config fields.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultMultiplier     = 2
+	DefaultJitter         = 0.5
+	DefaultMaxBufferSize  = 8 << 20
+)
+
+// Config for retries
+type Config struct {
+	// MaxAttempts counts the first try. Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each attempt.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each backoff that is
+	// randomized so that clients do not retry in lockstep. Set a negative
+	// value to disable jitter.
+	Jitter float64
+	// AttemptTimeout bounds each attempt; zero means only the caller's
+	// context applies.
+	AttemptTimeout time.Duration
+	// Retryable classifies errors. Defaults to IsRetryable.
+	Retryable func(error) bool
+	// MaxBufferSize is how much of a non-seekable upload reader is buffered
+	// in memory so it can be replayed; larger or unknown-length bodies are
+	// spooled to a temporary file instead.
+	MaxBufferSize int64
+}
+
+// Storage retrying wrapper
+type Storage struct {
+	core.Storage
+	cfg Config
+}
+
+// NewEngine struct
+func NewEngine(next core.Storage, cfg Config) (*Storage, error) {
+	if next == nil {
+		return nil, errors.New("go-storage: retry needs a storage to wrap")
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = DefaultMultiplier
+	}
+	switch {
+	case cfg.Jitter == 0:
+		cfg.Jitter = DefaultJitter
+	case cfg.Jitter < 0:
+		cfg.Jitter = 0
+	case cfg.Jitter > 1:
+		cfg.Jitter = 1
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = IsRetryable
+	}
+	if cfg.MaxBufferSize <= 0 {
+		cfg.MaxBufferSize = DefaultMaxBufferSize
+	}
+
+	return &Storage{
+		Storage: next,
+		cfg:     cfg,
+	}, nil
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() core.Storage {
+	return s.Storage
+}
+
+// With returns a copy of s over the wrapped storage bound to opts.
+func (s *Storage) With(opts core.Options) (core.Storage, error) {
+	next, err := core.With(s.Storage, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *s
+	c.Storage = next
+	return &c, nil
+}
+
+// backoff returns the wait after the given attempt (1-based).
+func (s *Storage) backoff(attempt int) time.Duration {
+	d := float64(s.cfg.InitialBackoff) * math.Pow(s.cfg.Multiplier, float64(attempt-1))
+	if d > float64(s.cfg.MaxBackoff) {
+		d = float64(s.cfg.MaxBackoff)
+	}
+	// #nosec G404 -- jitter does not need a cryptographic source.
+	d -= d * s.cfg.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// do runs fn until it succeeds, fails permanently or runs out of attempts,
+// and returns the last error.
+func (s *Storage) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := doValue(ctx, s, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+func doValue[T any](
+	ctx context.Context,
+	s *Storage,
+	fn func(ctx context.Context) (T, error),
+) (T, error) {
+	for attempt := 1; ; attempt++ {
+		v, err := attemptValue(ctx, s.cfg.AttemptTimeout, fn)
+		if err == nil ||
+			attempt >= s.cfg.MaxAttempts ||
+			ctx.Err() != nil ||
+			!s.cfg.Retryable(err) {
+			return v, err
+		}
+
+		timer := time.NewTimer(s.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return v, err
+		case <-timer.C:
+		}
+	}
+}
+
+func attemptValue[T any](
+	ctx context.Context,
+	timeout time.Duration,
+	fn func(ctx context.Context) (T, error),
+) (T, error) {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// replayable makes reader safe to send more than once. Seekable readers are
+// rewound to their current offset; anything else is buffered in memory or,
+// past MaxBufferSize, spooled to a temporary file. The returned cleanup must
+// be called once the upload is done.
+func (s *Storage) replayable(
+	reader io.Reader,
+	length int64,
+) (io.ReadSeeker, int64, func(), error) {
+	noop := func() {}
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		offset, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return rs, offset, noop, nil
+		}
+	}
+
+	if length >= 0 && length <= s.cfg.MaxBufferSize {
+		content, err := io.ReadAll(io.LimitReader(reader, length))
+		if err != nil {
+			return nil, 0, noop, err
+		}
+		return bytes.NewReader(content), 0, noop, nil
+	}
+
+	f, err := os.CreateTemp("", "go-storage-retry-*")
+	if err != nil {
+		return nil, 0, noop, err
+	}
+	cleanup := func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	src := reader
+	if length >= 0 {
+		src = io.LimitReader(reader, length)
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		cleanup()
+		return nil, 0, noop, err
+	}
+	return f, 0, cleanup, nil
+}
+
+// CreateBucket create bucket
+func (s *Storage) CreateBucket(ctx context.Context, bucketName, region string) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.Storage.CreateBucket(ctx, bucketName, region)
+	})
+}
+
+// BucketExists Checks if a bucket exists.
+func (s *Storage) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return doValue(ctx, s, func(ctx context.Context) (bool, error) {
+		return s.Storage.BucketExists(ctx, bucketName)
+	})
+}
+
+// UploadFile to storage. When the wrapped storage uploads the reader, as
+// reported by core.ReaderIsBody, it is made replayable first, as in
+// UploadFileByReader. Otherwise the reader is passed through: for minio it
+// is a progress hook, not the body.
+func (s *Storage) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	if reader == nil || s.cfg.MaxAttempts == 1 || !core.ReaderIsBody(s.Storage) {
+		return s.do(ctx, func(ctx context.Context) error {
+			return s.Storage.UploadFile(ctx, bucketName, objectName, content, reader)
+		})
+	}
+
+	body, offset, cleanup, err := s.replayable(reader, -1)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return s.do(ctx, func(ctx context.Context) error {
+		if _, err := body.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		return s.Storage.UploadFile(ctx, bucketName, objectName, content, body)
+	})
+}
+
+// ReaderIsBody reports whether the wrapped storage uploads the reader
+// passed to UploadFile.
+func (s *Storage) ReaderIsBody() bool {
+	return core.ReaderIsBody(s.Storage)
+}
+
+// UploadFileByReader to storage. The reader is rewound or buffered first so
+// that every attempt sends the full body.
+func (s *Storage) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	if s.cfg.MaxAttempts == 1 {
+		return s.Storage.UploadFileByReader(
+			ctx, bucketName, objectName, reader, contentType, length,
+		)
+	}
+
+	body, offset, cleanup, err := s.replayable(reader, length)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return s.do(ctx, func(ctx context.Context) error {
+		if _, err := body.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		return s.Storage.UploadFileByReader(
+			ctx, bucketName, objectName, body, contentType, length,
+		)
+	})
+}
+
+// DeleteFile delete file
+func (s *Storage) DeleteFile(ctx context.Context, bucketName, fileName string) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.Storage.DeleteFile(ctx, bucketName, fileName)
+	})
+}
+
+// DownloadFile downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFile(ctx context.Context, bucketName, objectName, filePath string) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.Storage.DownloadFile(ctx, bucketName, objectName, filePath)
+	})
+}
+
+// DownloadFileByProgress downloads and saves the object as a file in the local filesystem.
+func (s *Storage) DownloadFileByProgress(
+	ctx context.Context,
+	bucketName, objectName, filePath string,
+	bar *pb.ProgressBar,
+) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.Storage.DownloadFileByProgress(ctx, bucketName, objectName, filePath, bar)
+	})
+}
+
+// StatFile returns the object attributes. bucket + filename
+func (s *Storage) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	return doValue(ctx, s, func(ctx context.Context) (*core.ObjectInfo, error) {
+		return core.StatFile(ctx, s.Storage, bucketName, fileName)
+	})
+}
+
+// ListObjects returns every object whose name starts with prefix.
+func (s *Storage) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	return doValue(ctx, s, func(ctx context.Context) ([]core.ObjectInfo, error) {
+		return core.ListObjects(ctx, s.Storage, bucketName, prefix)
+	})
+}
+
+// GetContent for storage bucket + filename
+func (s *Storage) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	return doValue(ctx, s, func(ctx context.Context) ([]byte, error) {
+		return s.Storage.GetContent(ctx, bucketName, fileName)
+	})
+}
+
+// NewReader retries opening the object. AttemptTimeout does not apply, as
+// it would cancel the read.
+func (s *Storage) NewReader(
+	ctx context.Context,
+	bucketName, fileName string,
+) (io.ReadCloser, *core.ObjectInfo, error) {
+	type opened struct {
+		body io.ReadCloser
+		info *core.ObjectInfo
+	}
+	o, err := doValue(ctx, s, func(context.Context) (opened, error) {
+		body, info, err := core.NewReader(ctx, s.Storage, bucketName, fileName)
+		return opened{body, info}, err
+	})
+	return o.body, o.info, err
+}
+
+// CopyFile copy src to dest
+func (s *Storage) CopyFile(
+	ctx context.Context,
+	srcBucket, srcPath, destBucket, destPath string,
+) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.Storage.CopyFile(ctx, srcBucket, srcPath, destBucket, destPath)
+	})
+}
+
+// SignedURL get signed URL.
+func (s *Storage) SignedURL(
+	ctx context.Context,
+	bucketName, filePath string,
+	opts *core.SignedURLOptions,
+) (string, error) {
+	return doValue(ctx, s, func(ctx context.Context) (string, error) {
+		return s.Storage.SignedURL(ctx, bucketName, filePath, opts)
+	})
+}
+
+// SetLifeCycle on bucket or an object prefix.
+func (s *Storage) SetLifeCycle(
+	ctx context.Context,
+	bucketName string,
+	opts *core.LifecycleConfig,
+) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.Storage.SetLifeCycle(ctx, bucketName, opts)
+	})
+}
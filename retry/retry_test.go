@@ -0,0 +1,241 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// flaky is a disk engine whose uploads and reads fail a set number of times.
+type flaky struct {
+	*disk.Disk
+	failures   int
+	err        error
+	calls      int
+	readerBody bool
+}
+
+func (f *flaky) fail() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flaky) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	// Consume part of the body before failing, like a dropped connection.
+	if err := f.fail(); err != nil {
+		_, _ = io.CopyN(io.Discard, reader, 3)
+		return err
+	}
+	return f.Disk.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+}
+
+// UploadFile fails like UploadFileByReader. With readerBody set it stores
+// what it reads from reader, like the gcs driver; otherwise it stores
+// content and leaves the reader alone, like a minio progress hook.
+func (f *flaky) UploadFile(
+	ctx context.Context,
+	bucketName, objectName string,
+	content []byte,
+	reader io.Reader,
+) error {
+	if err := f.fail(); err != nil {
+		if f.readerBody {
+			_, _ = io.CopyN(io.Discard, reader, 3)
+		}
+		return err
+	}
+	if !f.readerBody {
+		return f.Disk.UploadFile(ctx, bucketName, objectName, content, nil)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return f.Disk.UploadFile(ctx, bucketName, objectName, content, nil)
+}
+
+func (f *flaky) ReaderIsBody() bool {
+	return f.readerBody
+}
+
+func (f *flaky) GetContent(ctx context.Context, bucketName, fileName string) ([]byte, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.Disk.GetContent(ctx, bucketName, fileName)
+}
+
+func newFlaky(t *testing.T, failures int, err error) (*flaky, *Storage) {
+	f := &flaky{Disk: disk.NewEngine("", t.TempDir()), failures: failures, err: err}
+	s, nerr := NewEngine(f, Config{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+	assert.NoError(t, nerr)
+	return f, s
+}
+
+var slowDown = minio.ErrorResponse{
+	StatusCode: http.StatusServiceUnavailable,
+	Code:       "SlowDown",
+}
+
+func TestRetriesNonSeekableReader(t *testing.T) {
+	f, s := newFlaky(t, 2, slowDown)
+	ctx := context.Background()
+
+	// io.MultiReader hides Seek, so the wrapper has to buffer the body.
+	body := io.MultiReader(strings.NewReader("hello world"))
+	err := s.UploadFileByReader(ctx, "b", "o.txt", body, "text/plain", 11)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, f.calls)
+
+	content, err := f.Disk.GetContent(ctx, "b", "o.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+}
+
+func TestUploadFileReplaysReader(t *testing.T) {
+	f, s := newFlaky(t, 1, slowDown)
+	f.readerBody = true
+	ctx := context.Background()
+
+	// The first attempt consumes part of the stream before failing.
+	body := io.MultiReader(strings.NewReader("hello world"))
+	err := s.UploadFile(ctx, "b", "o.txt", nil, body)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.calls)
+
+	content, err := f.Disk.GetContent(ctx, "b", "o.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+}
+
+func TestUploadFilePassesProgressReader(t *testing.T) {
+	f, s := newFlaky(t, 1, slowDown)
+	ctx := context.Background()
+
+	// A progress hook never reaches EOF; it must not be read ahead.
+	progress, w := io.Pipe()
+	defer w.Close()
+	err := s.UploadFile(ctx, "b", "o.txt", []byte("hello world"), progress)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.calls)
+
+	content, err := f.Disk.GetContent(ctx, "b", "o.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+}
+
+func TestRetriesUnknownLength(t *testing.T) {
+	f, s := newFlaky(t, 1, slowDown)
+	ctx := context.Background()
+
+	body := io.MultiReader(strings.NewReader("spooled to a temp file"))
+	err := s.UploadFileByReader(ctx, "b", "o.txt", body, "text/plain", -1)
+	assert.NoError(t, err)
+
+	content, err := f.Disk.GetContent(ctx, "b", "o.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "spooled to a temp file", string(content))
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	f, s := newFlaky(t, 5, &googleapi.Error{Code: http.StatusServiceUnavailable})
+
+	_, err := s.GetContent(context.Background(), "b", "o.txt")
+	assert.Error(t, err)
+	assert.Equal(t, 3, f.calls)
+}
+
+func TestDoesNotRetryPermanentErrors(t *testing.T) {
+	f, s := newFlaky(t, 5, minio.ErrorResponse{
+		StatusCode: http.StatusNotFound,
+		Code:       "NoSuchKey",
+	})
+
+	_, err := s.GetContent(context.Background(), "b", "o.txt")
+	assert.Error(t, err)
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestStopsWhenContextIsDone(t *testing.T) {
+	f := &flaky{Disk: disk.NewEngine("", t.TempDir()), failures: 5, err: slowDown}
+	s, err := NewEngine(f, Config{MaxAttempts: 5, InitialBackoff: time.Hour})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.GetContent(ctx, "b", "o.txt")
+	assert.True(t, errors.As(err, new(minio.ErrorResponse)))
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(errors.New("boom")))
+	assert.True(t, IsRetryable(context.DeadlineExceeded))
+	assert.True(t, IsRetryable(io.ErrUnexpectedEOF))
+	assert.True(t, IsRetryable(slowDown))
+	assert.True(t, IsRetryable(minio.ErrorResponse{Code: "InternalError"}))
+	assert.False(t, IsRetryable(minio.ErrorResponse{StatusCode: http.StatusForbidden}))
+	assert.True(t, IsRetryable(&googleapi.Error{Code: http.StatusTooManyRequests}))
+	assert.False(t, IsRetryable(&googleapi.Error{Code: http.StatusNotFound}))
+}
+
+func TestBackoff(t *testing.T) {
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         -1,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 100*time.Millisecond, s.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, s.backoff(2))
+	assert.Equal(t, time.Second, s.backoff(10))
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewEngine(disk.NewEngine("", t.TempDir()), Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateBucket(ctx, "b", ""))
+	v, ok := core.AsVersioner(s)
+	assert.True(t, ok)
+	assert.NoError(t, v.EnableVersioning(ctx, "b"))
+
+	// Embedding core.Storage hides the disk engine's optional interfaces.
+	plain := struct{ core.Storage }{disk.NewEngine("", t.TempDir())}
+	s, err = NewEngine(plain, Config{})
+	assert.NoError(t, err)
+	_, ok = core.AsVersioner(s)
+	assert.False(t, ok)
+	assert.ErrorIs(t, core.VersionerOf(s).EnableVersioning(ctx, "b"), core.ErrNotSupported)
+	_, ok = core.AsLocker(s)
+	assert.False(t, ok)
+	_, err = core.LockerOf(s).GetLegalHold(ctx, "b", "a.txt")
+	assert.ErrorIs(t, err, core.ErrNotSupported)
+}
@@ -1,86 +1,174 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/appleboy/go-storage/core"
-	"github.com/appleboy/go-storage/disk"
-	"github.com/appleboy/go-storage/minio"
 )
 
-// S3 for storage interface
+// S3 for storage interface. NewEngine sets it to the last engine built.
+//
+// Deprecated: it is racy and holds one engine per process. Keep the engine
+// NewEngine returns, or use a Manager for several.
 var S3 core.Storage
 
 // Config for storage
 type Config struct {
-	Endpoint           string
-	AccessID           string
-	SecretKey          string
-	SSL                bool
-	InsecureSkipVerify bool
-	Region             string
-	Path               string
-	Bucket             string
-	Addr               string
-	Driver             string
+	// Endpoint is the s3 host:port, or a gcs JSON API URL override such as
+	// a fake-gcs-server address.
+	Endpoint           string `json:"endpoint,omitempty"`
+	AccessID           string `json:"access_id,omitempty"`
+	SecretKey          string `json:"secret_key,omitempty"`
+	SSL                bool   `json:"ssl,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	Region             string `json:"region,omitempty"`
+	Path               string `json:"path,omitempty"`
+	Bucket             string `json:"bucket,omitempty"`
+	Addr               string `json:"addr,omitempty"`
+	Driver             string `json:"driver,omitempty"`
+	// SessionToken for temporary s3 keys in AccessID and SecretKey.
+	SessionToken string `json:"session_token,omitempty"`
+	// Credentials lists the s3 credential sources tried in order: static,
+	// env, file, iam, assume_role and web_identity. Empty uses the static
+	// keys, or iam without them.
+	Credentials []string `json:"credentials,omitempty"`
+	// Profile in the AWS shared credentials file, for the file source.
+	Profile string `json:"profile,omitempty"`
+	// RoleARN, RoleSessionName, ExternalID and STSEndpoint configure the
+	// assume_role and web_identity sources. STSEndpoint defaults to AWS STS.
+	RoleARN         string `json:"role_arn,omitempty"`
+	RoleSessionName string `json:"role_session_name,omitempty"`
+	ExternalID      string `json:"external_id,omitempty"`
+	STSEndpoint     string `json:"sts_endpoint,omitempty"`
+	// WebIdentityTokenFile for the web_identity source. Defaults to
+	// $AWS_WEB_IDENTITY_TOKEN_FILE.
+	WebIdentityTokenFile string `json:"web_identity_token_file,omitempty"`
+	// CAFile is a PEM bundle trusted for s3 TLS, on top of the system pool.
+	// CertFile and KeyFile hold a client certificate for mTLS.
+	CAFile   string `json:"ca_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// Proxy is the s3 HTTP(S) proxy URL. Defaults to $HTTPS_PROXY and friends.
+	Proxy string `json:"proxy,omitempty"`
+	// Connection pool and timeouts for s3. Zero keeps the defaults.
+	MaxIdleConns          int      `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost   int      `json:"max_idle_conns_per_host,omitempty"`
+	IdleConnTimeout       Duration `json:"idle_conn_timeout,omitempty"`
+	DialTimeout           Duration `json:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   Duration `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout Duration `json:"response_header_timeout,omitempty"`
+	// ProjectID for the gcs driver, which signs URLs as AccessID with the
+	// PEM private key in SecretKey, or through IAM signBlob without one.
+	ProjectID string `json:"project_id,omitempty"`
+	// CredentialsFile is a Google credentials JSON file for the gcs driver.
+	// A service account key in it also signs URLs. Defaults to Application
+	// Default Credentials. CredentialsJSON holds the same inline.
+	CredentialsFile string `json:"credentials_file,omitempty"`
+	CredentialsJSON string `json:"credentials_json,omitempty"`
+	// UserProject bills gcs requests to a project, for requester-pays
+	// buckets.
+	UserProject string `json:"user_project,omitempty"`
+	// Encryption is the default server-side encryption for the s3 and gcs
+	// drivers.
+	Encryption *core.Encryption `json:"encryption,omitempty"`
 }
 
-// NewEngine return storage interface
+// Duration is a time.Duration written as a string such as "30s" in JSON.
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// NewEngine return storage interface for the registered driver named by
+// cfg.Driver.
 func NewEngine(cfg Config) (core.Storage, error) {
-	switch cfg.Driver {
-	case "s3":
-		engine, err := minio.NewEngine(
-			cfg.Endpoint,
-			cfg.AccessID,
-			cfg.SecretKey,
-			cfg.SSL,
-			cfg.InsecureSkipVerify,
-			cfg.Region,
-		)
-		if err != nil {
-			return nil, err
-		}
-		S3 = engine
-		return engine, nil
-	case "disk":
-		engine := disk.NewEngine(
-			cfg.Addr,
-			cfg.Path,
-		)
-		S3 = engine
-		return engine, nil
-	default:
+	return newEngine(context.Background(), cfg)
+}
+
+// builtin maps the bundled driver names to their packages, for the hint
+// in the unknown driver error.
+var builtin = map[string]string{
+	"s3":   "minio",
+	"gcs":  "gcs",
+	"disk": "disk",
+	"mem":  "memory",
+}
+
+func newEngine(ctx context.Context, cfg Config) (core.Storage, error) {
+	if _, ok := lookupDriver(cfg.Driver); !ok {
 		// Clear any engine from a previous call so callers that ignore this
 		// error cannot keep using a stale global.
 		S3 = nil
+	}
+	engine, err := build(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	S3 = engine
+	return engine, nil
+}
+
+// build runs the factory registered for cfg.Driver.
+func build(ctx context.Context, cfg Config) (core.Storage, error) {
+	factory, ok := lookupDriver(cfg.Driver)
+	if !ok {
+		if pkg, ok := builtin[cfg.Driver]; ok {
+			return nil, fmt.Errorf(
+				"unknown storage driver: %q (forgotten import of %q?)",
+				cfg.Driver, "github.com/appleboy/go-storage/"+pkg,
+			)
+		}
 		return nil, fmt.Errorf("unknown storage driver: %q", cfg.Driver)
 	}
+	return factory(ctx, cfg)
 }
 
-// NewS3Engine return storage interface
+// NewS3Engine return storage interface. It needs the minio driver
+// registered.
+//
+// Deprecated: use minio.NewEngine, or NewEngine with the minio driver
+// imported. Unlike older releases, this fails unless the minio package is
+// imported, for example blank.
 func NewS3Engine(
 	endPoint, accessID, secretKey string,
 	ssl, insecureSkipVerify bool,
 	region string,
 ) (core.Storage, error) {
-	engine, err := minio.NewEngine(
-		endPoint,
-		accessID,
-		secretKey,
-		ssl,
-		insecureSkipVerify,
-		region,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return engine, nil
+	return build(context.Background(), Config{
+		Driver:             "s3",
+		Endpoint:           endPoint,
+		AccessID:           accessID,
+		SecretKey:          secretKey,
+		SSL:                ssl,
+		InsecureSkipVerify: insecureSkipVerify,
+		Region:             region,
+	})
 }
 
-// NewDiskEngine return storage interface
+// NewDiskEngine return storage interface. It needs the disk driver
+// registered.
+//
+// Deprecated: use disk.NewEngine, or NewEngine with the disk driver
+// imported. Unlike older releases, this fails unless the disk package is
+// imported, for example blank.
 func NewDiskEngine(host, folder string) (core.Storage, error) {
-	return disk.NewEngine(
-		host,
-		folder,
-	), nil
+	return build(context.Background(), Config{
+		Driver: "disk",
+		Addr:   host,
+		Path:   folder,
+	})
 }
@@ -0,0 +1,129 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// checkpoint is an append-only JSON lines file. The first line is the job,
+// each following line a finished source key. A nil checkpoint records
+// nothing.
+type checkpoint struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+	keys map[string]bool
+}
+
+func openCheckpoint(path string, job Job) (*checkpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+	cp := &checkpoint{path: path, keys: map[string]bool{}}
+
+	if err := cp.load(job); err != nil {
+		return nil, err
+	}
+
+	fresh := len(cp.keys) == 0
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if fresh {
+		flag |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flag, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	cp.file = file
+	if fresh {
+		if err := cp.writeLine(job); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	return cp, nil
+}
+
+// load reads the finished keys of an earlier run of the same job.
+func (cp *checkpoint) load(job Job) error {
+	file, err := os.Open(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return scanner.Err()
+	}
+	var saved Job
+	if err := json.Unmarshal(scanner.Bytes(), &saved); err != nil {
+		return err
+	}
+	if saved != job {
+		return errors.New("go-storage: checkpoint " + cp.path + " belongs to another job")
+	}
+	for scanner.Scan() {
+		var key string
+		// A line cut short by a crash is ignored; its object is redone.
+		if json.Unmarshal(scanner.Bytes(), &key) == nil {
+			cp.keys[key] = true
+		}
+	}
+	return scanner.Err()
+}
+
+func (cp *checkpoint) writeLine(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = cp.file.Write(append(line, '\n'))
+	return err
+}
+
+func (cp *checkpoint) done(key string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.keys[key]
+}
+
+func (cp *checkpoint) mark(key string) error {
+	if cp == nil {
+		return nil
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.keys[key] = true
+	return cp.writeLine(key)
+}
+
+func (cp *checkpoint) close() {
+	if cp == nil {
+		return
+	}
+	_ = cp.file.Close()
+}
+
+// remove deletes the checkpoint of a finished job.
+func (cp *checkpoint) remove() error {
+	if cp == nil {
+		return nil
+	}
+	_ = cp.file.Close()
+	return os.Remove(cp.path)
+}
@@ -0,0 +1,459 @@
+package transfer
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // S3 reports MD5 ETags; it is not used for security.
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// Compare selects how SyncUp and SyncDown decide a file is unchanged.
+type Compare int
+
+const (
+	// CompareSize treats files of the same size as unchanged.
+	CompareSize Compare = iota
+	// CompareModTime also needs the destination to be no older than the
+	// source. SyncDown sets downloaded files to the object's modification
+	// time so the next run agrees.
+	CompareModTime
+	// CompareChecksum also needs the MD5 of both sides to match. An object
+	// whose ETag is not a plain MD5, such as a multipart upload, is
+	// downloaded to hash it.
+	CompareChecksum
+)
+
+// DirOptions for SyncUp and SyncDown
+type DirOptions struct {
+	Compare Compare
+	// Include limits the sync to files matching one of the glob patterns.
+	// A pattern without a "/" matches the file name at any depth; one with
+	// a "/" matches the path relative to the synced directory, where "**"
+	// matches any number of directories.
+	Include []string
+	// Exclude skips files matching one of the glob patterns. It wins over
+	// Include.
+	Exclude []string
+	// Delete removes destination files missing from the source. Excluded
+	// files are never deleted.
+	Delete bool
+	// DryRun records the planned actions in the report without performing
+	// them.
+	DryRun bool
+	// Concurrency is the number of files transferred in parallel.
+	// Defaults to DefaultConcurrency.
+	Concurrency int
+	// OnResult is called after every file, from the worker goroutines.
+	OnResult func(Result)
+}
+
+// entry is one file on either side of a directory sync.
+type entry struct {
+	rel     string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// plan is one action of a directory sync.
+type plan struct {
+	rel    string
+	action Action
+	size   int64
+	// modTime of the object, applied to downloaded files.
+	modTime time.Time
+	// check is set when only the checksums are left to compare.
+	check bool
+	// err from comparing the checksums.
+	err error
+}
+
+// dirSync holds the state shared by SyncUp and SyncDown.
+type dirSync struct {
+	storage core.Storage
+	bucket  string
+	prefix  string
+	dir     string
+	opts    DirOptions
+	// up is true for SyncUp, where the local side is the source.
+	up bool
+}
+
+func newDirSync(
+	storage core.Storage,
+	bucketName, prefix, localDir string,
+	opts DirOptions,
+	up bool,
+) (*dirSync, error) {
+	if storage == nil {
+		return nil, errors.New("go-storage: directory sync needs a storage")
+	}
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	return &dirSync{
+		storage: storage,
+		bucket:  bucketName,
+		prefix:  prefix,
+		dir:     localDir,
+		opts:    opts,
+		up:      up,
+	}, nil
+}
+
+// SyncUp makes bucketName/prefix mirror localDir.
+func SyncUp(
+	ctx context.Context,
+	localDir string,
+	storage core.Storage,
+	bucketName, prefix string,
+	opts DirOptions,
+) (*Report, error) {
+	d, err := newDirSync(storage, bucketName, prefix, localDir, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return d.run(ctx)
+}
+
+// SyncDown makes localDir mirror bucketName/prefix.
+func SyncDown(
+	ctx context.Context,
+	storage core.Storage,
+	bucketName, prefix string,
+	localDir string,
+	opts DirOptions,
+) (*Report, error) {
+	d, err := newDirSync(storage, bucketName, prefix, localDir, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	return d.run(ctx)
+}
+
+func (d *dirSync) run(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	report := &Report{DryRun: d.opts.DryRun}
+
+	local, err := d.listLocal()
+	if err != nil {
+		return report, err
+	}
+	remote, err := d.listRemote(ctx)
+	if err != nil {
+		return report, err
+	}
+	src, dst := local, remote
+	if !d.up {
+		src, dst = remote, local
+	}
+
+	plans := d.plan(src, dst)
+	d.verify(ctx, plans, remote)
+
+	// A dry run does no I/O; one worker keeps Planned in order.
+	workers := d.opts.Concurrency
+	if d.opts.DryRun {
+		workers = 1
+	}
+	record := newRecorder(report, d.opts.OnResult)
+	each(ctx, workers, plans, func(_ int, p plan) {
+		res := Result{Key: p.rel, Action: p.action, Size: p.size, Err: p.err}
+		if res.Err == nil && !d.opts.DryRun && p.action != Skipped {
+			res.Err = d.apply(ctx, p)
+		}
+		if res.Err != nil {
+			res.Action = Failed
+		}
+		record(res)
+	})
+
+	report.Duration = time.Since(start)
+	return report, report.err(ctx)
+}
+
+func (d *dirSync) match(rel string) bool {
+	if len(d.opts.Include) > 0 && !matchAny(d.opts.Include, rel) {
+		return false
+	}
+	return !matchAny(d.opts.Exclude, rel)
+}
+
+func (d *dirSync) listLocal() (map[string]entry, error) {
+	files := map[string]entry{}
+	err := filepath.WalkDir(d.dir, func(name string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == d.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !d.match(rel) {
+			return nil
+		}
+		st, err := de.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = entry{rel: rel, size: st.Size(), modTime: st.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+func (d *dirSync) listRemote(ctx context.Context) (map[string]entry, error) {
+	found, err := d.storage.BucketExists(ctx, d.bucket)
+	if err != nil || !found {
+		return map[string]entry{}, err
+	}
+	objects, err := core.ListObjects(ctx, d.storage, d.bucket, d.prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]entry, len(objects))
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Name, d.prefix)
+		// Skip folder placeholders and keys that would escape localDir.
+		if strings.HasSuffix(rel, "/") || !filepath.IsLocal(filepath.FromSlash(rel)) {
+			continue
+		}
+		if !d.match(rel) {
+			continue
+		}
+		files[rel] = entry{rel: rel, size: obj.Size, modTime: obj.LastModified, etag: obj.ETag}
+	}
+	return files, nil
+}
+
+// plan compares both sides, in sorted order for a stable dry-run listing.
+// Checksums are left to verify, which runs them in parallel.
+func (d *dirSync) plan(src, dst map[string]entry) []plan {
+	var plans []plan
+	for _, rel := range sortedKeys(src) {
+		s := src[rel]
+		p := plan{rel: rel, action: Copied, size: s.size, modTime: s.modTime}
+		if t, ok := dst[rel]; ok && d.unchanged(s, t) {
+			if d.opts.Compare == CompareChecksum {
+				p.check = true
+			} else {
+				p.action = Skipped
+			}
+		}
+		plans = append(plans, p)
+	}
+	if d.opts.Delete {
+		for _, rel := range sortedKeys(dst) {
+			if _, ok := src[rel]; !ok {
+				plans = append(plans, plan{rel: rel, action: Deleted, size: dst[rel].size})
+			}
+		}
+	}
+	return plans
+}
+
+// unchanged compares everything but checksums.
+func (d *dirSync) unchanged(src, dst entry) bool {
+	if src.size != dst.size {
+		return false
+	}
+	if d.opts.Compare == CompareModTime {
+		// Object stores keep whole seconds.
+		return !dst.modTime.Truncate(time.Second).Before(src.modTime.Truncate(time.Second))
+	}
+	return true
+}
+
+// verify compares the checksums of the plans that need them on the worker
+// pool, skipping the files that match.
+func (d *dirSync) verify(ctx context.Context, plans []plan, remote map[string]entry) {
+	var checks []int
+	for i, p := range plans {
+		if p.check {
+			checks = append(checks, i)
+		}
+	}
+	each(ctx, d.opts.Concurrency, checks, func(_ int, i int) {
+		p := &plans[i]
+		localSum, err := d.localMD5(p.rel)
+		if err != nil {
+			p.err = err
+			return
+		}
+		remoteSum, err := d.remoteMD5(ctx, remote[p.rel])
+		if err != nil {
+			p.err = err
+			return
+		}
+		if localSum == remoteSum {
+			p.action = Skipped
+		}
+	})
+}
+
+func (d *dirSync) localPath(rel string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(rel))
+}
+
+func (d *dirSync) localMD5(rel string) (string, error) {
+	file, err := os.Open(d.localPath(rel))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return md5Hex(file)
+}
+
+// remoteMD5 trusts an ETag that is a plain MD5 and otherwise hashes a
+// downloaded copy. SSE-KMS and SSE-C ETags look like an MD5 but are not the
+// content's, so encrypted objects are downloaded too.
+func (d *dirSync) remoteMD5(ctx context.Context, remote entry) (string, error) {
+	etag := strings.Trim(remote.etag, `"`)
+	if len(etag) == md5.Size*2 {
+		if _, err := hex.DecodeString(etag); err == nil {
+			info, err := core.StatFile(ctx, d.storage, d.bucket, d.prefix+remote.rel)
+			if err != nil {
+				return "", err
+			}
+			if info.Encryption != core.EncryptionKMS &&
+				info.Encryption != core.EncryptionCustomer {
+				return strings.ToLower(etag), nil
+			}
+		}
+	}
+
+	tmp, err := os.MkdirTemp("", "go-storage-sync-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	name := filepath.Join(tmp, "object")
+	if err := d.storage.DownloadFile(ctx, d.bucket, d.prefix+remote.rel, name); err != nil {
+		return "", err
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return md5Hex(file)
+}
+
+func md5Hex(r io.Reader) (string, error) {
+	h := md5.New() //nolint:gosec
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (d *dirSync) apply(ctx context.Context, p plan) error {
+	key := d.prefix + p.rel
+	local := d.localPath(p.rel)
+	switch {
+	case d.up && p.action == Deleted:
+		return d.storage.DeleteFile(ctx, d.bucket, key)
+	case d.up:
+		return d.upload(ctx, local, key)
+	case p.action == Deleted:
+		return os.Remove(local)
+	default:
+		if err := d.storage.DownloadFile(ctx, d.bucket, key, local); err != nil {
+			return err
+		}
+		if p.modTime.IsZero() {
+			return nil
+		}
+		return os.Chtimes(local, p.modTime, p.modTime)
+	}
+}
+
+func (d *dirSync) upload(ctx context.Context, local, key string) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	st, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	contentType, err := sniff(file)
+	if err != nil {
+		return err
+	}
+	return d.storage.UploadFileByReader(ctx, d.bucket, key, file, contentType, st.Size())
+}
+
+// matchAny reports whether rel matches one of the glob patterns.
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments, letting "**" stand for zero or more
+// of them.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func sortedKeys(m map[string]entry) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,269 @@
+package transfer
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLocal(t *testing.T, dir, rel, content string) {
+	name := filepath.Join(dir, filepath.FromSlash(rel))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0o750))
+	assert.NoError(t, os.WriteFile(name, []byte(content), 0o600))
+}
+
+func keys(results []Result, action Action) []string {
+	var out []string
+	for _, r := range results {
+		if r.Action == action {
+			out = append(out, r.Key)
+		}
+	}
+	return out
+}
+
+func TestSyncUp(t *testing.T) {
+	dir := t.TempDir()
+	writeLocal(t, dir, "index.html", "<html></html>")
+	writeLocal(t, dir, "css/site.css", "body{}")
+	writeLocal(t, dir, "tmp/debug.log", "noise")
+	remote := disk.NewEngine("", t.TempDir())
+	ctx := context.Background()
+	assert.NoError(t, remote.UploadFile(ctx, "site", "www/old.html", []byte("old"), nil))
+	assert.NoError(t, remote.UploadFile(ctx, "site", "www/keep.log", []byte("kept"), nil))
+
+	opts := DirOptions{Exclude: []string{"*.log"}, Delete: true, DryRun: true}
+	report, err := SyncUp(ctx, dir, remote, "site", "www", opts)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"css/site.css", "index.html"}, keys(report.Planned, Copied))
+	assert.Equal(t, []string{"old.html"}, keys(report.Planned, Deleted))
+	assert.False(t, remote.FileExist(ctx, "site", "www/index.html"))
+
+	opts.DryRun = false
+	report, err = SyncUp(ctx, dir, remote, "site", "www", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Copied)
+	assert.Equal(t, 1, report.Deleted)
+	assert.Empty(t, report.Planned)
+	assert.True(t, remote.FileExist(ctx, "site", "www/css/site.css"))
+	assert.False(t, remote.FileExist(ctx, "site", "www/old.html"))
+	assert.False(t, remote.FileExist(ctx, "site", "www/tmp/debug.log"))
+	// Excluded files are never deleted.
+	assert.True(t, remote.FileExist(ctx, "site", "www/keep.log"))
+
+	report, err = SyncUp(ctx, dir, remote, "site", "www", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Copied)
+	assert.Equal(t, 2, report.Skipped)
+}
+
+func TestSyncDown(t *testing.T) {
+	remote := disk.NewEngine("", t.TempDir())
+	ctx := context.Background()
+	assert.NoError(t, remote.UploadFile(ctx, "site", "www/a.txt", []byte("aaaa"), nil))
+	assert.NoError(t, remote.UploadFile(ctx, "site", "www/img/b.png", []byte("bbbb"), nil))
+	assert.NoError(t, remote.UploadFile(ctx, "site", "www/img/c.jpg", []byte("cccc"), nil))
+	dir := t.TempDir()
+	writeLocal(t, dir, "extra.txt", "extra")
+
+	opts := DirOptions{Include: []string{"img/**"}, Delete: true}
+	report, err := SyncDown(ctx, remote, "site", "www/", dir, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Copied)
+	// extra.txt is outside the include patterns, so it is left alone.
+	assert.Equal(t, 0, report.Deleted)
+	assert.FileExists(t, filepath.Join(dir, "img", "b.png"))
+	assert.NoFileExists(t, filepath.Join(dir, "a.txt"))
+	assert.FileExists(t, filepath.Join(dir, "extra.txt"))
+
+	// Downloads take the object's modification time.
+	info, err := remote.StatFile(ctx, "site", "www/img/b.png")
+	assert.NoError(t, err)
+	st, err := os.Stat(filepath.Join(dir, "img", "b.png"))
+	assert.NoError(t, err)
+	assert.True(t, st.ModTime().Equal(info.LastModified))
+}
+
+func TestSyncCompare(t *testing.T) {
+	dir := t.TempDir()
+	writeLocal(t, dir, "a.txt", "same size 1")
+	remote := disk.NewEngine("", t.TempDir())
+	ctx := context.Background()
+	assert.NoError(t, remote.UploadFile(ctx, "b", "a.txt", []byte("same size 2"), nil))
+
+	// The remote copy is newer than the local file.
+	past := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "a.txt"), past, past))
+
+	tests := []struct {
+		compare Compare
+		copied  int
+	}{
+		{CompareSize, 0},
+		{CompareModTime, 0},
+		{CompareChecksum, 1},
+	}
+	for _, tt := range tests {
+		opts := DirOptions{Compare: tt.compare, DryRun: true}
+		report, err := SyncUp(ctx, dir, remote, "b", "", opts)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.copied, report.Copied, "compare %d", tt.compare)
+	}
+
+	// A local file newer than the remote copy is uploaded by mtime.
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "a.txt"), future, future))
+	report, err := SyncUp(ctx, dir, remote, "b", "", DirOptions{Compare: CompareModTime})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, "same size 1", get(t, remote, "b", "a.txt"))
+}
+
+// sealed is a disk engine that reports every object as encrypted with
+// encryption and lists it with etag, like an SSE-KMS ETag that is not the
+// content MD5.
+type sealed struct {
+	*disk.Disk
+	etag       string
+	encryption core.EncryptionType
+}
+
+func (s *sealed) ListObjects(
+	ctx context.Context,
+	bucketName, prefix string,
+) ([]core.ObjectInfo, error) {
+	objects, err := s.Disk.ListObjects(ctx, bucketName, prefix)
+	for i := range objects {
+		objects[i].ETag = s.etag
+	}
+	return objects, err
+}
+
+func (s *sealed) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	info, err := s.Disk.StatFile(ctx, bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	info.ETag, info.Encryption = s.etag, s.encryption
+	return info, nil
+}
+
+func TestSyncChecksumEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	writeLocal(t, dir, "a.txt", "same size 1")
+	sum := md5.Sum([]byte("same size 1"))
+	remote := &sealed{Disk: disk.NewEngine("", t.TempDir()), etag: hex.EncodeToString(sum[:])}
+	ctx := context.Background()
+	assert.NoError(t, remote.UploadFile(ctx, "b", "a.txt", []byte("same size 2"), nil))
+
+	tests := []struct {
+		encryption core.EncryptionType
+		copied     int
+	}{
+		// The ETag is trusted as the MD5 of unencrypted and SSE-S3 objects.
+		{core.EncryptionNone, 0},
+		{core.EncryptionS3, 0},
+		// Otherwise the object is downloaded and hashed.
+		{core.EncryptionKMS, 1},
+		{core.EncryptionCustomer, 1},
+	}
+	for _, tt := range tests {
+		remote.encryption = tt.encryption
+		opts := DirOptions{Compare: CompareChecksum, DryRun: true}
+		report, err := SyncUp(ctx, dir, remote, "b", "", opts)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.copied, report.Copied, "encryption %q", tt.encryption)
+	}
+}
+
+// gated holds every StatFile call until n of them are in flight.
+type gated struct {
+	*sealed
+	arrive sync.WaitGroup
+	all    chan struct{}
+}
+
+func (g *gated) StatFile(
+	ctx context.Context,
+	bucketName, fileName string,
+) (*core.ObjectInfo, error) {
+	g.arrive.Done()
+	select {
+	case <-g.all:
+		return g.sealed.StatFile(ctx, bucketName, fileName)
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("checksums are not compared in parallel")
+	}
+}
+
+func TestSyncChecksumParallel(t *testing.T) {
+	const n = 4
+	dir := t.TempDir()
+	sum := md5.Sum([]byte("same"))
+	remote := &gated{
+		sealed: &sealed{Disk: disk.NewEngine("", t.TempDir()), etag: hex.EncodeToString(sum[:])},
+		all:    make(chan struct{}),
+	}
+	remote.arrive.Add(n)
+	go func() {
+		remote.arrive.Wait()
+		close(remote.all)
+	}()
+	ctx := context.Background()
+	for i := range n {
+		name := fmt.Sprintf("%d.txt", i)
+		writeLocal(t, dir, name, "same")
+		assert.NoError(t, remote.UploadFile(ctx, "b", name, []byte("same"), nil))
+	}
+
+	opts := DirOptions{Compare: CompareChecksum, Concurrency: n, DryRun: true}
+	report, err := SyncUp(ctx, dir, remote, "b", "", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, n, report.Skipped)
+}
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "deep/dir/a.log", true},
+		{"*.log", "a.txt", false},
+		{"img/*", "img/a.png", true},
+		{"img/*", "img/sub/a.png", false},
+		{"img/**", "img/sub/a.png", true},
+		{"**/*.png", "a.png", true},
+		{"**/*.png", "x/y/a.png", true},
+		{"docs/**/index.md", "docs/index.md", true},
+		{"docs/**/index.md", "docs/a/b/index.md", true},
+		{"docs/**/index.md", "blog/index.md", false},
+	}
+	for _, tt := range tests {
+		got := matchAny([]string{tt.pattern}, tt.rel)
+		assert.Equal(t, tt.want, got, "%s ~ %s", tt.pattern, tt.rel)
+	}
+}
+
+func TestBadPattern(t *testing.T) {
+	_, err := SyncUp(context.Background(), t.TempDir(), disk.NewEngine("", t.TempDir()),
+		"b", "", DirOptions{Include: []string{"[a-"}})
+	assert.Error(t, err)
+}
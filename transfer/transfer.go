@@ -0,0 +1,426 @@
+// Package transfer copies or syncs a bucket or prefix from one core.Storage to
+// another, such as disk to S3 or S3 to GCS.
+//
+// Objects stream through a temporary file, one per worker, so memory use does
+// not grow with object size. Content type and user metadata are carried over.
+// A checkpoint file lets an interrupted job resume where it stopped.
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// DefaultConcurrency is the number of objects in flight when
+// Config.Concurrency is unset.
+const DefaultConcurrency = 4
+
+// Config for transfer
+type Config struct {
+	// Concurrency is the number of objects transferred in parallel.
+	// Defaults to DefaultConcurrency.
+	Concurrency int
+	// Checkpoint is a file recording finished objects. Rerunning the same
+	// job skips them. The file is removed once a job finishes without
+	// failures.
+	Checkpoint string
+	// TempDir holds objects while they move between engines. Defaults to
+	// os.TempDir().
+	TempDir string
+	// Delete makes Sync remove destination objects missing from the source.
+	Delete bool
+	// IgnoreETag makes Sync compare sizes only. ETags are computed
+	// differently by each provider, so set it between unlike engines.
+	IgnoreETag bool
+	// OnResult is called after every object, from the worker goroutines.
+	OnResult func(Result)
+}
+
+// Job names the source and destination of a transfer. A source key
+// SrcPrefix+"x" is written to DstPrefix+"x".
+type Job struct {
+	SrcBucket string `json:"src_bucket"`
+	SrcPrefix string `json:"src_prefix"`
+	DstBucket string `json:"dst_bucket"`
+	DstPrefix string `json:"dst_prefix"`
+}
+
+func (j Job) dstKey(srcKey string) string {
+	return j.DstPrefix + strings.TrimPrefix(srcKey, j.SrcPrefix)
+}
+
+func (j Job) srcKey(dstKey string) string {
+	return j.SrcPrefix + strings.TrimPrefix(dstKey, j.DstPrefix)
+}
+
+// Action taken on one object
+type Action string
+
+const (
+	// Copied means the object was written to the destination.
+	Copied Action = "copied"
+	// Skipped means the destination already held the same object.
+	Skipped Action = "skipped"
+	// Resumed means the checkpoint recorded the object as done.
+	Resumed Action = "resumed"
+	// Deleted means the object was removed from the destination.
+	Deleted Action = "deleted"
+	// Failed means the object could not be transferred or deleted.
+	Failed Action = "failed"
+)
+
+// Result for one object. Key is the source key, or the destination key for
+// deletes.
+type Result struct {
+	Key    string
+	Action Action
+	Size   int64
+	Err    error
+}
+
+// Report summarizes a job.
+type Report struct {
+	Copied   int
+	Skipped  int
+	Resumed  int
+	Deleted  int
+	Failed   int
+	Bytes    int64
+	Duration time.Duration
+	// Failures lists every failed object.
+	Failures []Result
+	// DryRun is set when nothing was changed; Planned then lists every
+	// action that would have been taken.
+	DryRun  bool
+	Planned []Result
+}
+
+func (r *Report) add(res Result) {
+	if r.DryRun {
+		r.Planned = append(r.Planned, res)
+	}
+	switch res.Action {
+	case Copied:
+		r.Copied++
+		r.Bytes += res.Size
+	case Skipped:
+		r.Skipped++
+	case Resumed:
+		r.Resumed++
+	case Deleted:
+		r.Deleted++
+	case Failed:
+		r.Failed++
+		r.Failures = append(r.Failures, res)
+	}
+}
+
+// String formats the report as a one-line summary.
+func (r *Report) String() string {
+	return fmt.Sprintf(
+		"copied %d (%d bytes), skipped %d, resumed %d, deleted %d, failed %d in %s",
+		r.Copied, r.Bytes, r.Skipped, r.Resumed, r.Deleted, r.Failed,
+		r.Duration.Round(time.Millisecond),
+	)
+}
+
+// Manager transfers objects from src to dst.
+type Manager struct {
+	src core.Storage
+	dst core.Storage
+	cfg Config
+}
+
+// NewManager struct
+func NewManager(src, dst core.Storage, cfg Config) (*Manager, error) {
+	if src == nil || dst == nil {
+		return nil, errors.New("go-storage: transfer needs a source and a destination")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	return &Manager{src: src, dst: dst, cfg: cfg}, nil
+}
+
+// Copy writes every source object to the destination, overwriting what is
+// there.
+func (m *Manager) Copy(ctx context.Context, job Job) (*Report, error) {
+	return m.run(ctx, job, false)
+}
+
+// Sync copies new and changed objects only, and with Config.Delete removes
+// destination objects that are gone from the source. An object is unchanged
+// when the sizes match and, unless Config.IgnoreETag is set, the ETags match
+// where both sides report one.
+func (m *Manager) Sync(ctx context.Context, job Job) (*Report, error) {
+	return m.run(ctx, job, true)
+}
+
+func (m *Manager) run(ctx context.Context, job Job, mirror bool) (*Report, error) {
+	start := time.Now()
+	report := &Report{}
+
+	cp, err := openCheckpoint(m.cfg.Checkpoint, job)
+	if err != nil {
+		return report, err
+	}
+	defer cp.close()
+
+	objects, err := core.ListObjects(ctx, m.src, job.SrcBucket, job.SrcPrefix)
+	if err != nil {
+		return report, err
+	}
+
+	existing, err := m.prepareDestination(ctx, job, mirror)
+	if err != nil {
+		return report, err
+	}
+
+	tmpDir, err := os.MkdirTemp(m.cfg.TempDir, "go-storage-transfer-")
+	if err != nil {
+		return report, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	record := newRecorder(report, m.cfg.OnResult)
+	each(ctx, m.cfg.Concurrency, objects, func(worker int, obj core.ObjectInfo) {
+		tmpFile := filepath.Join(tmpDir, strconv.Itoa(worker))
+		record(m.transfer(ctx, job, obj, existing, cp, tmpFile))
+	})
+
+	if mirror && m.cfg.Delete && ctx.Err() == nil {
+		m.deleteExtra(ctx, job, objects, existing, record)
+	}
+
+	report.Duration = time.Since(start)
+	if err := report.err(ctx); err != nil {
+		return report, err
+	}
+	return report, cp.remove()
+}
+
+// err reports a cancelled context or the failed objects.
+func (r *Report) err(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.Failed > 0 {
+		return fmt.Errorf(
+			"go-storage: %d objects failed to transfer: %w",
+			r.Failed, r.Failures[0].Err,
+		)
+	}
+	return nil
+}
+
+// newRecorder returns a goroutine-safe func adding results to report and
+// passing them on to onResult.
+func newRecorder(report *Report, onResult func(Result)) func(Result) {
+	var mu sync.Mutex
+	return func(res Result) {
+		mu.Lock()
+		report.add(res)
+		mu.Unlock()
+		if onResult != nil {
+			onResult(res)
+		}
+	}
+}
+
+// each calls fn for every item from n workers, numbered 0 to n-1. It stops
+// handing out items once ctx is done.
+func each[T any](ctx context.Context, n int, items []T, fn func(worker int, item T)) {
+	work := make(chan T)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				fn(i, item)
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case work <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// prepareDestination creates a missing destination bucket and, when
+// mirroring, lists what is already there.
+func (m *Manager) prepareDestination(
+	ctx context.Context,
+	job Job,
+	mirror bool,
+) (map[string]core.ObjectInfo, error) {
+	found, err := m.dst.BucketExists(ctx, job.DstBucket)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if err := m.dst.CreateBucket(ctx, job.DstBucket, ""); err != nil {
+			return nil, err
+		}
+	}
+	if !mirror {
+		return nil, nil
+	}
+	existing := map[string]core.ObjectInfo{}
+	if !found {
+		return existing, nil
+	}
+	objects, err := core.ListObjects(ctx, m.dst, job.DstBucket, job.DstPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		existing[obj.Name] = obj
+	}
+	return existing, nil
+}
+
+func (m *Manager) transfer(
+	ctx context.Context,
+	job Job,
+	obj core.ObjectInfo,
+	existing map[string]core.ObjectInfo,
+	cp *checkpoint,
+	tmpFile string,
+) Result {
+	res := Result{Key: obj.Name, Size: obj.Size}
+	switch {
+	case cp.done(obj.Name):
+		res.Action = Resumed
+		return res
+	case existing != nil && m.unchanged(obj, existing[job.dstKey(obj.Name)]):
+		res.Action = Skipped
+	default:
+		size, err := m.copyObject(ctx, job, obj.Name, tmpFile)
+		if err != nil {
+			res.Action = Failed
+			res.Err = err
+			return res
+		}
+		res.Action = Copied
+		res.Size = size
+	}
+	if err := cp.mark(obj.Name); err != nil {
+		res.Action = Failed
+		res.Err = err
+	}
+	return res
+}
+
+func (m *Manager) unchanged(src, dst core.ObjectInfo) bool {
+	if dst.Name == "" || src.Size != dst.Size {
+		return false
+	}
+	if m.cfg.IgnoreETag || src.ETag == "" || dst.ETag == "" {
+		return true
+	}
+	return src.ETag == dst.ETag
+}
+
+// copyObject streams one object through tmpFile and returns its size.
+func (m *Manager) copyObject(ctx context.Context, job Job, key, tmpFile string) (int64, error) {
+	info, err := core.StatFile(ctx, m.src, job.SrcBucket, key)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.src.DownloadFile(ctx, job.SrcBucket, key, tmpFile); err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpFile)
+
+	file, err := os.Open(tmpFile)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	st, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		if contentType, err = sniff(file); err != nil {
+			return 0, err
+		}
+	}
+	dst := m.dst
+	if upload := info.UploadOptions(); len(upload.Metadata) > 0 ||
+		upload.CacheControl != "" || upload.ContentEncoding != "" {
+		if dst, err = core.With(m.dst, core.Options{Upload: upload}); err != nil {
+			return 0, err
+		}
+	}
+
+	err = dst.UploadFileByReader(
+		ctx,
+		job.DstBucket,
+		job.dstKey(key),
+		file,
+		contentType,
+		st.Size(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return st.Size(), nil
+}
+
+// sniff detects the content type from the head of file and rewinds it.
+func sniff(file *os.File) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return core.DetectContentType(head[:n]), nil
+}
+
+func (m *Manager) deleteExtra(
+	ctx context.Context,
+	job Job,
+	objects []core.ObjectInfo,
+	existing map[string]core.ObjectInfo,
+	record func(Result),
+) {
+	present := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		present[obj.Name] = true
+	}
+	for key, obj := range existing {
+		if present[job.srcKey(key)] || !strings.HasPrefix(key, job.DstPrefix) {
+			continue
+		}
+		res := Result{Key: key, Action: Deleted, Size: obj.Size}
+		if err := m.dst.DeleteFile(ctx, job.DstBucket, key); err != nil {
+			res.Action = Failed
+			res.Err = err
+		}
+		record(res)
+	}
+}
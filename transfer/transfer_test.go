@@ -0,0 +1,176 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/go-storage/core"
+	"github.com/appleboy/go-storage/disk"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failDisk is a disk engine that rejects uploads to the keys in fail.
+type failDisk struct {
+	*disk.Disk
+	fail map[string]bool
+}
+
+func newFailDisk(t *testing.T) *failDisk {
+	return &failDisk{
+		Disk: disk.NewEngine("", t.TempDir()),
+		fail: map[string]bool{},
+	}
+}
+
+func (f *failDisk) With(opts core.Options) (core.Storage, error) {
+	next, err := f.Disk.With(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &failDisk{Disk: next.(*disk.Disk), fail: f.fail}, nil
+}
+
+func (f *failDisk) UploadFileByReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	reader io.Reader,
+	contentType string,
+	length int64,
+) error {
+	if f.fail[objectName] {
+		return errors.New("upload rejected")
+	}
+	return f.Disk.UploadFileByReader(ctx, bucketName, objectName, reader, contentType, length)
+}
+
+func put(t *testing.T, s core.Storage, key, content string) {
+	assert.NoError(t, s.UploadFileByReader(
+		context.Background(), "src", key, strings.NewReader(content), "", int64(len(content)),
+	))
+}
+
+func get(t *testing.T, s core.Storage, bucket, key string) string {
+	content, err := s.GetContent(context.Background(), bucket, key)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestCopyPreservesAttributes(t *testing.T) {
+	src, dst := newFailDisk(t), newFailDisk(t)
+	owned, err := src.With(core.Options{Upload: &core.UploadOptions{
+		Metadata:     map[string]string{"Owner": "alice"},
+		CacheControl: "max-age=60",
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, owned.UploadFileByReader(
+		context.Background(), "src", "docs/a.json", strings.NewReader(`{"a":1}`), "application/json", 7,
+	))
+	put(t, src, "docs/b.txt", "hello world")
+	put(t, src, "other/c.txt", "not copied")
+
+	m, err := NewManager(src, dst, Config{Concurrency: 2})
+	assert.NoError(t, err)
+	report, err := m.Copy(context.Background(), Job{
+		SrcBucket: "src",
+		SrcPrefix: "docs/",
+		DstBucket: "dst",
+		DstPrefix: "backup/",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Copied)
+	assert.Equal(t, int64(18), report.Bytes)
+
+	assert.Equal(t, `{"a":1}`, get(t, dst, "dst", "backup/a.json"))
+	assert.Equal(t, "hello world", get(t, dst, "dst", "backup/b.txt"))
+	assert.False(t, dst.FileExist(context.Background(), "dst", "backup/c.txt"))
+
+	info, err := dst.StatFile(context.Background(), "dst", "backup/a.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", info.ContentType)
+	assert.Equal(t, map[string]string{"owner": "alice"}, info.Metadata)
+	assert.Equal(t, "max-age=60", info.CacheControl)
+
+	// Without a stored content type, it is detected from the content.
+	info, err = dst.StatFile(context.Background(), "dst", "backup/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+}
+
+func TestSync(t *testing.T) {
+	src, dst := newFailDisk(t), newFailDisk(t)
+	put(t, src, "same.txt", "same")
+	put(t, src, "changed.txt", "new content")
+	put(t, src, "new.txt", "new")
+	ctx := context.Background()
+	assert.NoError(t, dst.UploadFile(ctx, "dst", "same.txt", []byte("same"), nil))
+	assert.NoError(t, dst.UploadFile(ctx, "dst", "changed.txt", []byte("old"), nil))
+	assert.NoError(t, dst.UploadFile(ctx, "dst", "stale.txt", []byte("stale"), nil))
+
+	var results []Result
+	m, err := NewManager(src, dst, Config{
+		Concurrency: 1,
+		Delete:      true,
+		OnResult:    func(r Result) { results = append(results, r) },
+	})
+	assert.NoError(t, err)
+	report, err := m.Sync(ctx, Job{SrcBucket: "src", DstBucket: "dst"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Copied)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 1, report.Deleted)
+	assert.Len(t, results, 4)
+
+	assert.Equal(t, "new content", get(t, dst, "dst", "changed.txt"))
+	assert.Equal(t, "new", get(t, dst, "dst", "new.txt"))
+	assert.False(t, dst.FileExist(ctx, "dst", "stale.txt"))
+}
+
+func TestCheckpointResume(t *testing.T) {
+	src, dst := newFailDisk(t), newFailDisk(t)
+	for _, key := range []string{"a.txt", "b.txt", "c.txt"} {
+		put(t, src, key, key)
+	}
+	checkpoint := filepath.Join(t.TempDir(), "job.jsonl")
+	job := Job{SrcBucket: "src", DstBucket: "dst"}
+
+	dst.fail["b.txt"] = true
+	m, err := NewManager(src, dst, Config{Checkpoint: checkpoint})
+	assert.NoError(t, err)
+	report, err := m.Copy(context.Background(), job)
+	assert.Error(t, err)
+	assert.Equal(t, 2, report.Copied)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, "b.txt", report.Failures[0].Key)
+	assert.FileExists(t, checkpoint)
+
+	// The checkpoint is tied to its job.
+	_, err = m.Copy(context.Background(), Job{SrcBucket: "src", DstBucket: "elsewhere"})
+	assert.Error(t, err)
+
+	delete(dst.fail, "b.txt")
+	report, err = m.Copy(context.Background(), job)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, 2, report.Resumed)
+	assert.Equal(t, "b.txt", get(t, dst, "dst", "b.txt"))
+	_, err = os.Stat(checkpoint)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCancel(t *testing.T) {
+	src, dst := newFailDisk(t), newFailDisk(t)
+	put(t, src, "a.txt", "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m, err := NewManager(src, dst, Config{})
+	assert.NoError(t, err)
+	_, err = m.Copy(ctx, Job{SrcBucket: "src", DstBucket: "dst"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// Open returns the engine described by a storage URL. See ParseURL for the
+// forms it accepts.
+func Open(ctx context.Context, rawURL string) (core.Storage, error) {
+	cfg, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return newEngine(ctx, cfg)
+}
+
+// ParseURL turns a storage URL into a Config:
+//
+//	s3://key:secret@host:9000/bucket?ssl=true&insecure=false&region=us-east-1
+//	gs://project/bucket?credentials=/path/to/key.json
+//	file:///var/data?host=https://cdn.example.com
+//	mem://?host=https://cdn.example.com
+//
+// The bucket path segment is optional. An s3 URL without credentials uses
+// the IAM role of the host.
+func ParseURL(rawURL string) (Config, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// url.Error quotes the input, which may hold a secret.
+		return Config{}, fmt.Errorf("go-storage: invalid storage URL: %w", unwrapURLError(err))
+	}
+	query := u.Query()
+
+	var cfg Config
+	switch u.Scheme {
+	case "s3":
+		cfg.Driver = "s3"
+		if err := checkParams(u, query, "ssl", "insecure", "region"); err != nil {
+			return Config{}, err
+		}
+		if u.Host == "" {
+			return Config{}, fmt.Errorf("go-storage: %s: missing host", u.Redacted())
+		}
+		cfg.Endpoint = u.Host
+		if u.User != nil {
+			cfg.AccessID = u.User.Username()
+			cfg.SecretKey, _ = u.User.Password()
+		}
+		if cfg.Bucket, err = bucketFromPath(u); err != nil {
+			return Config{}, err
+		}
+		cfg.Region = query.Get("region")
+		if cfg.SSL, err = boolParam(u, query, "ssl"); err != nil {
+			return Config{}, err
+		}
+		if cfg.InsecureSkipVerify, err = boolParam(u, query, "insecure"); err != nil {
+			return Config{}, err
+		}
+	case "gs", "gcs":
+		cfg.Driver = "gcs"
+		if err := checkParams(u, query, "credentials"); err != nil {
+			return Config{}, err
+		}
+		if u.User != nil {
+			return Config{}, fmt.Errorf(
+				"go-storage: %s: gs URLs take a credentials file, not a user", u.Redacted(),
+			)
+		}
+		cfg.ProjectID = u.Host
+		cfg.CredentialsFile = query.Get("credentials")
+		if cfg.Bucket, err = bucketFromPath(u); err != nil {
+			return Config{}, err
+		}
+	case "file":
+		cfg.Driver = "disk"
+		if err := checkParams(u, query, "host"); err != nil {
+			return Config{}, err
+		}
+		// file://data/x is relative: "data" lands in the host part.
+		cfg.Path = u.Host + u.Path
+		if cfg.Path == "" {
+			return Config{}, fmt.Errorf("go-storage: %s: missing directory", u.Redacted())
+		}
+		cfg.Addr = query.Get("host")
+	case "mem":
+		cfg.Driver = "mem"
+		if err := checkParams(u, query, "host"); err != nil {
+			return Config{}, err
+		}
+		if u.Host != "" || strings.Trim(u.Path, "/") != "" {
+			return Config{}, fmt.Errorf(
+				"go-storage: %s: mem URLs take no host or path", u.Redacted(),
+			)
+		}
+		cfg.Addr = query.Get("host")
+	case "":
+		return Config{}, fmt.Errorf(
+			"go-storage: %q is not a storage URL, want s3://, gs://, file:// or mem://",
+			u.Redacted(),
+		)
+	default:
+		return Config{}, fmt.Errorf(
+			"go-storage: unsupported storage URL scheme %q, want s3, gs, file or mem",
+			u.Scheme,
+		)
+	}
+	return cfg, nil
+}
+
+// Redacted renders cfg as a storage URL with the secret key masked, for
+// logs. Encryption settings are left out.
+func (cfg Config) Redacted() string {
+	u := &url.URL{}
+	query := url.Values{}
+	switch cfg.Driver {
+	case "s3":
+		u.Scheme = "s3"
+		u.Host = cfg.Endpoint
+		if cfg.AccessID != "" || cfg.SecretKey != "" {
+			u.User = url.UserPassword(cfg.AccessID, cfg.SecretKey)
+		}
+		if cfg.Bucket != "" {
+			u.Path = "/" + cfg.Bucket
+		}
+		if cfg.SSL {
+			query.Set("ssl", "true")
+		}
+		if cfg.InsecureSkipVerify {
+			query.Set("insecure", "true")
+		}
+		if cfg.Region != "" {
+			query.Set("region", cfg.Region)
+		}
+	case "gcs":
+		u.Scheme = "gs"
+		u.Host = cfg.ProjectID
+		if cfg.Bucket != "" {
+			u.Path = "/" + cfg.Bucket
+		}
+		if cfg.CredentialsFile != "" {
+			query.Set("credentials", cfg.CredentialsFile)
+		}
+	case "disk":
+		u.Scheme = "file"
+		u.Path = cfg.Path
+		if !strings.HasPrefix(cfg.Path, "/") {
+			u.Host, u.Path, _ = strings.Cut(cfg.Path, "/")
+			if u.Path != "" {
+				u.Path = "/" + u.Path
+			}
+		}
+		if cfg.Addr != "" {
+			query.Set("host", cfg.Addr)
+		}
+	case "mem":
+		u.Scheme = "mem"
+		if cfg.Addr != "" {
+			query.Set("host", cfg.Addr)
+		}
+	default:
+		return cfg.Driver + "://"
+	}
+	u.RawQuery = query.Encode()
+	rendered := u.Redacted()
+	if u.Host == "" && u.Path == "" {
+		// url.URL drops the "//" without a host or path.
+		rendered = strings.Replace(rendered, ":", "://", 1)
+	}
+	return rendered
+}
+
+// checkParams rejects query parameters the scheme does not know, so a typo
+// does not silently fall back to a default.
+func checkParams(u *url.URL, query url.Values, known ...string) error {
+	var unknown []string
+	for key := range query {
+		found := false
+		for _, k := range known {
+			found = found || k == key
+		}
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf(
+		"go-storage: %s: unknown parameter %q, want one of %s",
+		u.Scheme+"://", unknown[0], strings.Join(known, ", "),
+	)
+}
+
+func boolParam(u *url.URL, query url.Values, key string) (bool, error) {
+	v := query.Get(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("go-storage: %s: %s=%q is not a boolean", u.Redacted(), key, v)
+	}
+	return b, nil
+}
+
+func bucketFromPath(u *url.URL) (string, error) {
+	bucket := strings.Trim(u.Path, "/")
+	if strings.Contains(bucket, "/") {
+		return "", fmt.Errorf(
+			"go-storage: %s: the path holds a bucket name only, got %q", u.Redacted(), bucket,
+		)
+	}
+	return bucket, nil
+}
+
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
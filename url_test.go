@@ -0,0 +1,114 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	storage "github.com/appleboy/go-storage"
+	_ "github.com/appleboy/go-storage/disk"
+	_ "github.com/appleboy/go-storage/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseURL(t *testing.T) {
+	cfg, err := storage.ParseURL("s3://key:secret@minio:9000/photos?ssl=true&region=eu-west-1")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Config{
+		Driver:    "s3",
+		Endpoint:  "minio:9000",
+		AccessID:  "key",
+		SecretKey: "secret",
+		Bucket:    "photos",
+		SSL:       true,
+		Region:    "eu-west-1",
+	}, cfg)
+
+	cfg, err = storage.ParseURL("gs://my-project/photos?credentials=/etc/key.json")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Config{
+		Driver:          "gcs",
+		ProjectID:       "my-project",
+		Bucket:          "photos",
+		CredentialsFile: "/etc/key.json",
+	}, cfg)
+
+	cfg, err = storage.ParseURL("file:///var/data?host=https://cdn.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Config{
+		Driver: "disk",
+		Path:   "/var/data",
+		Addr:   "https://cdn.example.com",
+	}, cfg)
+
+	cfg, err = storage.ParseURL("file://data/uploads")
+	assert.NoError(t, err)
+	assert.Equal(t, "data/uploads", cfg.Path)
+
+	cfg, err = storage.ParseURL("mem://")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Config{Driver: "mem"}, cfg)
+}
+
+func TestParseURLErrors(t *testing.T) {
+	for rawURL, want := range map[string]string{
+		"ftp://host/bucket":           "unsupported storage URL scheme",
+		"/var/data":                   "is not a storage URL",
+		"s3:///bucket":                "missing host",
+		"s3://host/bucket?sll=true":   `unknown parameter "sll"`,
+		"s3://host/bucket?ssl=maybe":  "is not a boolean",
+		"s3://host/a/b":               "bucket name only",
+		"gs://key:secret@project":     "not a user",
+		"file://":                     "missing directory",
+		"mem://host":                  "no host or path",
+		"s3://key:secret@host:port/b": "invalid storage URL",
+	} {
+		_, err := storage.ParseURL(rawURL)
+		if assert.Error(t, err, rawURL) {
+			assert.Contains(t, err.Error(), want, rawURL)
+			assert.NotContains(t, err.Error(), "secret", rawURL)
+		}
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	for _, rawURL := range []string{
+		"s3://key:secret@minio:9000/photos?region=eu-west-1&ssl=true",
+		"gs://my-project/photos?credentials=%2Fetc%2Fkey.json",
+		"file:///var/data?host=https%3A%2F%2Fcdn.example.com",
+		"file://data/uploads",
+		"mem://",
+	} {
+		cfg, err := storage.ParseURL(rawURL)
+		assert.NoError(t, err)
+		want := strings.Replace(rawURL, ":secret@", ":xxxxx@", 1)
+		assert.Equal(t, want, cfg.Redacted())
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	engine, err := storage.Open(ctx, "mem://?host=https://cdn.example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, engine.UploadFile(ctx, "bucket", "a.txt", []byte("hello"), nil))
+	content, err := engine.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	assert.Equal(t, "https://cdn.example.com/bucket/a.txt", engine.GetFileURL("bucket", "a.txt"))
+
+	_, err = storage.Open(ctx, "mem://?hots=x")
+	assert.Error(t, err)
+}
+
+func TestDurationJSON(t *testing.T) {
+	var cfg storage.Config
+	assert.NoError(t, json.Unmarshal([]byte(`{"dial_timeout":"5s"}`), &cfg))
+	assert.Equal(t, storage.Duration(5*time.Second), cfg.DialTimeout)
+	out, err := json.Marshal(storage.Config{IdleConnTimeout: storage.Duration(time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"idle_conn_timeout":"1m0s"}`, string(out))
+	assert.Error(t, json.Unmarshal([]byte(`{"dial_timeout":"soon"}`), &cfg))
+}
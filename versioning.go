@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/appleboy/go-storage/core"
+)
+
+// Restore makes an older version of an object current again, by copying it
+// over the object. The versions in between are kept on versioned buckets.
+// Restoring the current version does nothing.
+func Restore(
+	ctx context.Context,
+	engine core.Storage,
+	bucketName, fileName, versionID string,
+) error {
+	if versionID == "" {
+		return errors.New("go-storage: restore needs a version ID")
+	}
+	if info, err := core.StatFile(ctx, engine, bucketName, fileName); err == nil &&
+		info.VersionID == versionID {
+		return nil
+	}
+	versioned, err := core.With(engine, core.Options{VersionID: versionID})
+	if err != nil {
+		return err
+	}
+	return versioned.CopyFile(ctx, bucketName, fileName, bucketName, fileName)
+}
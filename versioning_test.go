@@ -0,0 +1,43 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	storage "github.com/appleboy/go-storage"
+	"github.com/appleboy/go-storage/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	m := memory.NewEngine("")
+	assert.NoError(t, m.CreateBucket(ctx, "bucket", ""))
+	assert.NoError(t, m.EnableVersioning(ctx, "bucket"))
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("v1"), nil))
+	first, err := m.StatFile(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, m.UploadFile(ctx, "bucket", "a.txt", []byte("v2"), nil))
+
+	assert.Error(t, storage.Restore(ctx, m, "bucket", "a.txt", ""))
+	assert.NoError(t, storage.Restore(ctx, m, "bucket", "a.txt", first.VersionID))
+	content, err := m.GetContent(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	// Every version is kept, and restoring the current one is a no-op.
+	versions, err := m.ListObjectVersions(ctx, "bucket", "")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	current, err := m.StatFile(ctx, "bucket", "a.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Restore(ctx, m, "bucket", "a.txt", current.VersionID))
+	versions, _ = m.ListObjectVersions(ctx, "bucket", "")
+	assert.Len(t, versions, 3)
+
+	// Deleted objects come back too.
+	assert.NoError(t, m.DeleteFile(ctx, "bucket", "a.txt"))
+	assert.NoError(t, storage.Restore(ctx, m, "bucket", "a.txt", first.VersionID))
+	assert.True(t, m.FileExist(ctx, "bucket", "a.txt"))
+}